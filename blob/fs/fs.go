@@ -0,0 +1,142 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// Store keeps blobs as files under a directory, it is also an http.Handler
+// serving them
+type Store struct {
+	dir     string
+	baseURL string
+	files   http.Handler
+}
+
+// New creates the directory if needed, blob URLs are the key appended to the
+// base URL, eg "/blobs"
+func New(dir, baseURL string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create blob dir %q", dir)
+	}
+
+	s := &Store{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files:   http.FileServer(http.Dir(dir)),
+	}
+
+	return s, nil
+}
+
+// Put writes the blob to a temporary file first so readers never see partial
+// files. The content type is inferred from the key extension when served.
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(p)
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create blob dir %q", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create blob %q", key)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to write blob %q", key)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to write blob %q", key)
+	}
+
+	err = os.Chmod(f.Name(), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write blob %q", key)
+	}
+
+	err = os.Rename(f.Name(), p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write blob %q", key)
+	}
+
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(primitives.ErrBlobNotFound, "failed to open blob %q", key)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open blob %q", key)
+	}
+
+	return f, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete blob %q", key)
+	}
+
+	return nil
+}
+
+func (s *Store) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// ServeHTTP serves the blobs by key, without directory listings
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") || strings.Contains(r.URL.Path, "/.tmp-") {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.files.ServeHTTP(w, r)
+}
+
+// path maps the key to a file inside the store directory
+func (s *Store) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+
+	if clean == "/" || clean != "/"+key {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
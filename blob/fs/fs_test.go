@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "blobs")
+	test.OK(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(dir, "/blobs/")
+	test.OK(t, err)
+
+	test.OK(t, s.Put(ctx, "cards/AB34.png", strings.NewReader("png"), "image/png"))
+
+	r, err := s.Get(ctx, "cards/AB34.png")
+	test.OK(t, err)
+
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	test.OK(t, err)
+	test.Equal(t, "blob", "png", string(body))
+
+	test.Equal(t, "url", "/blobs/cards/AB34.png", s.URL("cards/AB34.png"))
+
+	t.Run("serve", func(t *testing.T) {
+		testCases := []struct {
+			path string
+			code int
+		}{
+			{"/cards/AB34.png", http.StatusOK},
+			{"/cards/", http.StatusNotFound},
+			{"/cards/CD56.png", http.StatusNotFound},
+		}
+
+		for _, tc := range testCases {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+			test.Equal(t, tc.path, tc.code, w.Code)
+		}
+	})
+
+	test.OK(t, s.Delete(ctx, "cards/AB34.png"))
+	test.OK(t, s.Delete(ctx, "cards/AB34.png"))
+
+	_, err = s.Get(ctx, "cards/AB34.png")
+	test.Equal(t, "not found", primitives.ErrBlobNotFound, errors.Cause(err))
+
+	for _, key := range []string{"", "../secret", "cards/../../secret", "/cards/AB34.png"} {
+		test.Error(t, s.Put(ctx, key, strings.NewReader("png"), "image/png"))
+	}
+}
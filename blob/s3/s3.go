@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const service = "s3"
+
+// Config points to a bucket of an S3 compatible service, like AWS S3 or
+// MinIO. Objects are addressed with path style URLs,
+// <Endpoint>/<Bucket>/<key>.
+type Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PublicURL is the base of the blob URLs, eg a CDN, defaults to the
+	// bucket URL
+	PublicURL string
+
+	// Client defaults to a client with a 30 seconds timeout
+	Client *http.Client
+}
+
+type Store struct {
+	cfg    Config
+	bucket string
+	client *http.Client
+	signer *v4.Signer
+}
+
+func New(cfg Config) (*Store, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3.amazonaws.com"
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	_, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint %q", cfg.Endpoint)
+	}
+
+	bucket := strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = bucket
+	}
+
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	s := &Store{
+		cfg:    cfg,
+		bucket: bucket,
+		client: client,
+		signer: newSigner(cfg.AccessKey, cfg.SecretKey),
+	}
+
+	return s, nil
+}
+
+// Put buffers the blob in memory to sign its content hash
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read blob %q", key)
+	}
+
+	req, err := s.request(ctx, "PUT", key, b)
+	if err != nil {
+		return err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req, b)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put blob %q", key)
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, "GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get blob %q", key)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil && errors.Cause(err) != primitives.ErrBlobNotFound {
+		return errors.Wrapf(err, "failed to delete blob %q", key)
+	}
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (s *Store) URL(key string) string {
+	return s.cfg.PublicURL + "/" + escapePath(key)
+}
+
+func (s *Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, errors.Errorf("invalid blob key %q", key)
+	}
+
+	req, err := http.NewRequest(method, s.bucket+"/"+escapePath(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid blob key %q", key)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// do signs and sends the request, the response body must be closed when
+// there is no error
+func (s *Store) do(req *http.Request, body []byte) (*http.Response, error) {
+	err := s.sign(req, body, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign request")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, primitives.ErrBlobNotFound
+	}
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		return nil, errors.Errorf("unexpected response [%d] %s", resp.StatusCode, b)
+	}
+
+	return resp, nil
+}
+
+// newSigner signs the requests with AWS Signature Version 4, S3 paths are
+// signed as they are sent instead of escaped twice
+func newSigner(accessKey, secretKey string) *v4.Signer {
+	creds := credentials.NewStaticCredentials(accessKey, secretKey, "")
+
+	return v4.NewSigner(creds, func(s *v4.Signer) {
+		s.DisableURIPathEscaping = true
+	})
+}
+
+// sign adds the signature headers to the request, including the body hash
+func (s *Store) sign(req *http.Request, body []byte, now time.Time) error {
+	var r io.ReadSeeker
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	_, err := s.signer.Sign(req, r, service, s.cfg.Region, now)
+
+	return err
+}
+
+// escapePath encodes each segment of the key as required by the signature
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+
+	for i, s := range segments {
+		segments[i] = uriEncode(s)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func uriEncode(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"gitlab.com/luizbranco/cyberbrain/authentication"
+	"gitlab.com/luizbranco/cyberbrain/blob/fs"
+	"gitlab.com/luizbranco/cyberbrain/blob/s3"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
 	"gitlab.com/luizbranco/cyberbrain/db/psql"
+	"gitlab.com/luizbranco/cyberbrain/db/sqlite"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web/html"
 	"gitlab.com/luizbranco/cyberbrain/web/server"
 	"gitlab.com/luizbranco/cyberbrain/web/session"
 	"gitlab.com/luizbranco/cyberbrain/web/urlbuilder"
 	"gitlab.com/luizbranco/cyberbrain/worker"
+	"gitlab.com/luizbranco/cyberbrain/worker/local"
+	"gitlab.com/luizbranco/cyberbrain/worker/mirror"
 	"gitlab.com/luizbranco/cyberbrain/worker/offline"
 	"gitlab.com/luizbranco/cyberbrain/worker/resizer"
+	"gitlab.com/luizbranco/cyberbrain/worker/tts"
 )
 
 const (
@@ -35,6 +51,7 @@ func main() {
 
 	blitlineID := os.Getenv("BLITLINE_ID")
 	blitlineCallbackURL := os.Getenv("BLITLINE_CALLBACK_URL")
+	blitlineCallbackSecret := os.Getenv("BLITLINE_CALLBACK_SECRET")
 
 	awsBucket := os.Getenv("AWS_BUCKET")
 
@@ -45,13 +62,27 @@ func main() {
 		httpPort = "8080"
 	}
 
-	db, err := psql.New(dbURL)
+	conn, err := newDatabase(dbURL)
 	if err != nil {
 		log.Fatalf("unable to connect to db %s", err)
 	}
 
+	system, err := db.SystemUser(context.Background(), conn)
+	if err != nil {
+		log.Fatalf("unable to find system user %s", err)
+	}
+
+	// changes not made by a user, such as the workers', are recorded under the
+	// system user, handlers audit them under the current user
+	audited := db.Audit(conn, system.ID())
+
+	blobs, err := newBlobStore()
+	if err != nil {
+		log.Fatalf("unable to initialize blob store %s", err)
+	}
+
 	pool := &worker.WorkerPool{
-		Database: db,
+		Database: conn,
 	}
 
 	var imgResizer worker.ImageResizer
@@ -63,6 +94,8 @@ func main() {
 			BlitlineID:  blitlineID,
 			CallbackURL: blitlineCallbackURL,
 			Poll:        env == Development,
+
+			CallbackSecret: blitlineCallbackSecret,
 		}
 
 		err := blitlineResizer.Register()
@@ -72,10 +105,75 @@ func main() {
 
 		imgResizer = blitlineResizer
 	} else {
-		imgResizer = &offline.ImageOfflineResizer{}
+		localResizer := &local.Worker{
+			WorkerPool: pool,
+			Database:   audited,
+			Store:      blobs,
+		}
+
+		err := localResizer.Register()
+		if err != nil {
+			log.Fatalf("unable to register local image resize job %s", err)
+		}
+
+		imgResizer = localResizer
+	}
+
+	imgMirror := &mirror.Worker{
+		WorkerPool: pool,
+		Database:   audited,
+		Store:      blobs,
+		Resizer:    imgResizer,
 	}
 
-	go pool.Start()
+	err = imgMirror.Register()
+	if err != nil {
+		log.Fatalf("unable to register image mirror job %s", err)
+	}
+
+	imgResizer = imgMirror
+
+	var speaker worker.Speaker = &offline.SpeechOfflineGenerator{}
+
+	// TTS_ENGINE=espeak generates the card sounds with espeak-ng, or the
+	// command set by TTS_COMMAND
+	if os.Getenv("TTS_ENGINE") == "espeak" {
+		ttsWorker := &tts.Worker{
+			Provider:   &tts.Espeak{Command: os.Getenv("TTS_COMMAND")},
+			Store:      blobs,
+			Database:   audited,
+			WorkerPool: pool,
+		}
+
+		err := ttsWorker.Register()
+		if err != nil {
+			log.Fatalf("unable to register speech job %s", err)
+		}
+
+		speaker = ttsWorker
+	}
+
+	err = pool.Housekeep("@hourly", retentionPolicy())
+	if err != nil {
+		log.Fatalf("unable to register housekeeping job %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if os.Getenv("IMAGES_MIRROR_SWEEP") == "true" {
+		err := imgMirror.Sweep(ctx)
+		if err != nil {
+			log.Fatalf("unable to enqueue image mirror sweep %s", err)
+		}
+	}
+
+	poolDone := make(chan struct{})
+
+	go func() {
+		pool.Start(ctx)
+		close(poolDone)
+	}()
 
 	ub, err := urlbuilder.New(hashidSalt)
 	if err != nil {
@@ -85,7 +183,7 @@ func main() {
 	auth := authentication.Authenticator{}
 
 	session := &session.Manager{
-		Database: db,
+		Database: conn,
 		Secret:   sessionSecret,
 	}
 
@@ -93,19 +191,151 @@ func main() {
 
 	srv := &server.Server{
 		Template:       tpl,
-		Database:       db,
+		Database:       audited,
 		URLBuilder:     ub,
 		Authenticator:  auth,
 		SessionManager: session,
 		ImageResizer:   imgResizer,
+		Speaker:        speaker,
+		BlobStore:      blobs,
+		BlitlineSecret: blitlineCallbackSecret,
+		BlitlineBucket: awsBucket,
 	}
 
 	mux := srv.NewServeMux()
 
+	httpServer := &http.Server{
+		Addr:    ":" + httpPort,
+		Handler: mux,
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+
+		<-sig
+
+		log.Println("shutting down")
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer shutdownCancel()
+
+		err := httpServer.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("failed to shut down server %s", err)
+		}
+	}()
+
 	fmt.Printf("server listening on port %s\n", httpPort)
 
-	err = http.ListenAndServe(":"+httpPort, mux)
-	if err != nil {
+	err = httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("unable to start server %s", err)
 	}
+
+	// wait for running jobs so they aren't lost on deploys
+	cancel()
+	<-poolDone
+}
+
+// newDatabase selects the database backend by the url scheme, eg:
+// memory://, sqlite:///var/lib/cyberbrain.db or postgres://...
+func newDatabase(dbURL string) (primitives.Database, error) {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "memory":
+		log.Println("using in-memory database, data will be lost on exit")
+		return memory.New(), nil
+	case "sqlite":
+		return sqlite.New(strings.TrimPrefix(dbURL, "sqlite://"))
+	default:
+		return psql.New(dbURL, psqlConfig())
+	}
+}
+
+// newBlobStore uses the S3 bucket S3_BUCKET when set, otherwise files under
+// BLOB_DIR served at /blobs
+func newBlobStore() (primitives.BlobStore, error) {
+	bucket := os.Getenv("S3_BUCKET")
+
+	if bucket == "" {
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "blobs"
+		}
+
+		return fs.New(dir, "/blobs")
+	}
+
+	cfg := s3.Config{
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		Region:    os.Getenv("S3_REGION"),
+		Bucket:    bucket,
+		AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PublicURL: os.Getenv("S3_PUBLIC_URL"),
+	}
+
+	return s3.New(cfg)
+}
+
+// psqlConfig reads the connection pool settings from the environment, eg:
+// DATABASE_MAX_OPEN_CONNS=20 DATABASE_STATEMENT_TIMEOUT=5s
+func psqlConfig() psql.Config {
+	return psql.Config{
+		MaxOpenConns:     envInt("DATABASE_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:     envInt("DATABASE_MAX_IDLE_CONNS", 2),
+		ConnMaxLifetime:  envDuration("DATABASE_CONN_MAX_LIFETIME", 0),
+		StatementTimeout: envDuration("DATABASE_STATEMENT_TIMEOUT", 10*time.Second),
+		PingAttempts:     envInt("DATABASE_PING_ATTEMPTS", 5),
+		PingBackoff:      time.Second,
+	}
+}
+
+// retentionPolicy reads the max age of each state from JOBS_RETENTION_<STATE>,
+// eg JOBS_RETENTION_DONE=72h
+func retentionPolicy() worker.RetentionPolicy {
+	p := worker.RetentionPolicy{
+		MaxAge:    make(map[string]time.Duration),
+		Archive:   os.Getenv("JOBS_ARCHIVE") == "true",
+		BatchSize: envInt("JOBS_PURGE_BATCH_SIZE", 500),
+	}
+
+	for state, age := range worker.DefaultRetentionPolicy.MaxAge {
+		p.MaxAge[state] = envDuration("JOBS_RETENTION_"+strings.ToUpper(state), age)
+	}
+
+	return p
+}
+
+func envInt(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s %s", name, err)
+	}
+
+	return n
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s %s", name, err)
+	}
+
+	return d
 }
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionRevert = "revert"
+)
+
+// audited lists the record types whose changes are kept in record_changes
+var audited = map[string]bool{
+	"card": true,
+	"deck": true,
+}
+
+// metaColumns are managed by the database and never audited
+var metaColumns = map[string]bool{
+	"id":         true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// SystemEmail is the email of the user the changes made by the workers and
+// other background tasks are recorded under. It has no password, so it can't
+// log in.
+const SystemEmail = "system@cyberbrain.invalid"
+
+// Auditor wraps a database appending a record change, with the diff of the
+// db tagged fields, every time an audited record is created or updated
+type Auditor struct {
+	primitives.Database
+
+	UserID primitives.ID
+}
+
+// Audit returns an auditor recording the changes under the user. Auditors are
+// not nested, auditing an auditor changes its user.
+func Audit(conn primitives.Database, userID primitives.ID) *Auditor {
+	if a, ok := conn.(*Auditor); ok {
+		conn = a.Database
+	}
+
+	return &Auditor{
+		Database: conn,
+		UserID:   userID,
+	}
+}
+
+// SystemUser returns the user recording the changes not made by a user,
+// creating it on first use
+func SystemUser(ctx context.Context, conn primitives.Database) (*primitives.User, error) {
+	user, err := FindUserByEmail(ctx, conn, SystemEmail)
+	if err == nil {
+		return user, nil
+	}
+
+	user = &primitives.User{Name: "System", Email: SystemEmail, PasswordHash: "-"}
+
+	err = conn.Create(ctx, user)
+	if err == nil {
+		return user, nil
+	}
+
+	// another replica created it first
+	user, err = FindUserByEmail(ctx, conn, SystemEmail)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find system user")
+	}
+
+	return user, nil
+}
+
+func (a *Auditor) Create(ctx context.Context, r primitives.Record) error {
+	if !audited[r.Type()] {
+		return a.Database.Create(ctx, r)
+	}
+
+	return a.atomic(ctx, func(conn primitives.Database) error {
+		err := conn.Create(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		changes, err := diff(nil, r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to diff %s %d", r.Type(), r.ID())
+		}
+
+		return record(ctx, conn, a.UserID, r, ActionCreate, changes)
+	})
+}
+
+func (a *Auditor) Update(ctx context.Context, r primitives.Record) error {
+	return a.update(ctx, r, ActionUpdate)
+}
+
+func (a *Auditor) update(ctx context.Context, r primitives.Record, action string) error {
+	if !audited[r.Type()] {
+		return a.Database.Update(ctx, r)
+	}
+
+	return a.atomic(ctx, func(conn primitives.Database) error {
+		prev, err := findRecord(ctx, conn, r.Type(), r.ID())
+		if err != nil {
+			return errors.Wrapf(err, "failed to find previous %s %d", r.Type(), r.ID())
+		}
+
+		err = conn.Update(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		changes, err := diff(prev, r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to diff %s %d", r.Type(), r.ID())
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		return record(ctx, conn, a.UserID, r, action, changes)
+	})
+}
+
+// atomic runs fn in a transaction, so a record isn't changed without its
+// change being recorded. Databases without transactions run fn as is.
+func (a *Auditor) atomic(ctx context.Context, fn func(primitives.Database) error) error {
+	if _, ok := a.Database.(primitives.Transactor); !ok {
+		return fn(a.Database)
+	}
+
+	return Transaction(ctx, a.Database, fn)
+}
+
+func record(ctx context.Context, conn primitives.Database, userID primitives.ID, r primitives.Record,
+	action string, changes map[string]primitives.FieldChange) error {
+
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s %d changes", r.Type(), r.ID())
+	}
+
+	change := &primitives.RecordChange{
+		RecordType: r.Type(),
+		RecordID:   r.ID(),
+		UserID:     userID,
+		Action:     action,
+		Changes:    b,
+	}
+
+	err = conn.Create(ctx, change)
+	if err != nil {
+		return errors.Wrapf(err, "failed to record %s %d changes", r.Type(), r.ID())
+	}
+
+	return nil
+}
+
+// Revert restores the record fields to their values before the change and
+// records it as a new change
+func (a *Auditor) Revert(ctx context.Context, change primitives.RecordChange) (primitives.Record, error) {
+	if change.Action == ActionCreate {
+		return nil, errors.New("record creation cannot be reverted")
+	}
+
+	r, err := findRecord(ctx, a.Database, change.RecordType, change.RecordID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find %s %d", change.RecordType, change.RecordID)
+	}
+
+	fields, err := change.Fields()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal record changes")
+	}
+
+	// the cards definitions follow the deck fields, they change together
+	if _, ok := fields["fields"]; ok && change.RecordType == "deck" {
+		return nil, errors.New("deck fields changes cannot be reverted, edit the deck fields instead")
+	}
+
+	rv := reflect.ValueOf(r).Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f, ok := fields[rt.Field(i).Tag.Get("db")]
+		if !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		v := reflect.New(field.Type())
+
+		err := json.Unmarshal(f.Old, v.Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal field %s", rt.Field(i).Name)
+		}
+
+		field.Set(v.Elem())
+	}
+
+	if card, ok := r.(*primitives.Card); ok {
+		deck, err := FindDeck(ctx, a.Database, card.DeckID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find deck %d", card.DeckID)
+		}
+
+		if len(card.Definitions) != len(deck.Fields) {
+			return nil, errors.New("card definitions changed with the deck fields cannot be reverted")
+		}
+	}
+
+	err = a.update(ctx, r, ActionRevert)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// diff returns the db tagged fields that differ between two records of the
+// same type. A nil previous record is treated as a record with zero values.
+func diff(prev, next primitives.Record) (map[string]primitives.FieldChange, error) {
+	nv := reflect.ValueOf(next).Elem()
+	nt := nv.Type()
+
+	ov := reflect.New(nt).Elem()
+	if prev != nil {
+		ov = reflect.ValueOf(prev).Elem()
+	}
+
+	changes := make(map[string]primitives.FieldChange)
+
+	for i := 0; i < nt.NumField(); i++ {
+		tag := nt.Field(i).Tag.Get("db")
+		if tag == "" || metaColumns[tag] {
+			continue
+		}
+
+		o := ov.Field(i).Interface()
+		n := nv.Field(i).Interface()
+
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+
+		ob, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+
+		nb, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+
+		changes[tag] = primitives.FieldChange{Old: ob, New: nb}
+	}
+
+	return changes, nil
+}
+
+func findRecord(ctx context.Context, db primitives.Database, recordType string,
+	id primitives.ID) (primitives.Record, error) {
+
+	var q *query
+
+	switch recordType {
+	case "card":
+		q = newCardQuery()
+	case "deck":
+		q = newDeckQuery()
+	default:
+		return nil, errors.Errorf("invalid record type %s", recordType)
+	}
+
+	q.where["id"] = id
+
+	return db.Get(ctx, q)
+}
+
+func FindRecordChanges(ctx context.Context, db primitives.Database, recordType string,
+	recordID primitives.ID) ([]primitives.RecordChange, error) {
+
+	q := newRecordChangeQuery()
+	q.where["record_type"] = recordType
+	q.where["record_id"] = recordID
+	q.sortBy["created_at"] = "DESC"
+
+	rs, err := db.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []primitives.RecordChange
+
+	for _, r := range rs {
+		change, ok := r.(*primitives.RecordChange)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		changes = append(changes, *change)
+	}
+
+	return changes, nil
+}
+
+func FindRecordChange(ctx context.Context, db primitives.Database,
+	id primitives.ID) (*primitives.RecordChange, error) {
+
+	q := newRecordChangeQuery()
+	q.where["id"] = id
+
+	r, err := db.Get(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	change, ok := r.(*primitives.RecordChange)
+	if !ok {
+		return nil, errors.Errorf("invalid record type %T", r)
+	}
+
+	return change, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		prev     primitives.Record
+		next     primitives.Record
+		changes  map[string]string
+	}{
+		{
+			scenario: "new record",
+			next:     &primitives.Deck{Name: "Animals", Fields: []string{"English"}},
+			changes: map[string]string{
+				"name":   `"" -> "Animals"`,
+				"fields": `null -> ["English"]`,
+			},
+		},
+		{
+			scenario: "updated fields",
+			prev:     &primitives.Card{MetaID: 1, Caption: "cat", Definitions: []string{"cat"}},
+			next:     &primitives.Card{MetaID: 1, MetaVersion: 2, Caption: "dog", Definitions: []string{"cat"}},
+			changes: map[string]string{
+				"caption": `"cat" -> "dog"`,
+			},
+		},
+		{
+			scenario: "no changes",
+			prev:     &primitives.Card{Caption: "cat"},
+			next:     &primitives.Card{Caption: "cat"},
+			changes:  map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			changes, err := diff(tc.prev, tc.next)
+			test.OK(t, err)
+
+			got := make(map[string]string)
+			for k, c := range changes {
+				got[k] = string(c.Old) + " -> " + string(c.New)
+			}
+
+			test.Equal(t, "changes", tc.changes, got)
+		})
+	}
+}
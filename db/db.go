@@ -1,7 +1,10 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,11 +21,13 @@ type GreaterOrEqual struct {
 	Time time.Time
 }
 
-func FindUser(db primitives.Database, id primitives.ID) (*primitives.User, error) {
+func FindUser(ctx context.Context, db primitives.Database,
+	id primitives.ID) (*primitives.User, error) {
+
 	q := newUserQuery()
 	q.where["id"] = id
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -35,11 +40,13 @@ func FindUser(db primitives.Database, id primitives.ID) (*primitives.User, error
 	return user, nil
 }
 
-func FindUserByEmail(db primitives.Database, email string) (*primitives.User, error) {
+func FindUserByEmail(ctx context.Context, db primitives.Database,
+	email string) (*primitives.User, error) {
+
 	q := newUserQuery()
 	q.where["email"] = email
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -52,11 +59,13 @@ func FindUserByEmail(db primitives.Database, email string) (*primitives.User, er
 	return user, nil
 }
 
-func FindDecks(db primitives.Database, userID primitives.ID) ([]primitives.Deck, error) {
+func FindDecks(ctx context.Context, db primitives.Database,
+	userID primitives.ID) ([]primitives.Deck, error) {
+
 	q := newDeckQuery()
 	q.where["user_id"] = userID
 
-	rs, err := db.Query(q)
+	rs, err := db.Query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -75,11 +84,13 @@ func FindDecks(db primitives.Database, userID primitives.ID) ([]primitives.Deck,
 	return decks, nil
 }
 
-func FindDeck(db primitives.Database, id primitives.ID) (*primitives.Deck, error) {
+func FindDeck(ctx context.Context, db primitives.Database,
+	id primitives.ID) (*primitives.Deck, error) {
+
 	q := newDeckQuery()
 	q.where["id"] = id
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -92,11 +103,13 @@ func FindDeck(db primitives.Database, id primitives.ID) (*primitives.Deck, error
 	return deck, nil
 }
 
-func FindCard(db primitives.Database, id primitives.ID) (*primitives.Card, error) {
+func FindCard(ctx context.Context, db primitives.Database,
+	id primitives.ID) (*primitives.Card, error) {
+
 	q := newCardQuery()
 	q.where["id"] = id
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +122,9 @@ func FindCard(db primitives.Database, id primitives.ID) (*primitives.Card, error
 	return card, nil
 }
 
-func FindCardsByDeck(db primitives.Database, deckID primitives.ID, nsfw bool) ([]primitives.Card, error) {
+func FindCardsByDeck(ctx context.Context, db primitives.Database,
+	deckID primitives.ID, nsfw bool) ([]primitives.Card, error) {
+
 	q := newCardQuery()
 	q.where["deck_id"] = deckID
 	if !nsfw {
@@ -118,7 +133,7 @@ func FindCardsByDeck(db primitives.Database, deckID primitives.ID, nsfw bool) ([
 
 	q.sortBy["updated_at"] = "DESC"
 
-	rs, err := db.Query(q)
+	rs, err := db.Query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -126,15 +141,21 @@ func FindCardsByDeck(db primitives.Database, deckID primitives.ID, nsfw bool) ([
 	return castCards(rs)
 }
 
-func FindCardsByTag(db primitives.Database, tagID primitives.ID) ([]primitives.Card, error) {
-	raw := `SELECT c.* FROM cards c
+func FindCardsByTag(ctx context.Context, db primitives.Database,
+	tagID primitives.ID) ([]primitives.Card, error) {
+
+	raw := `SELECT ` + Columns(&primitives.Card{}, "c") + ` FROM cards c
 	LEFT JOIN card_tags ct ON c.id = ct.card_id
 	WHERE ct.tag_id = ` + tagID.String() + " ORDER BY c.updated_at DESC;"
 
 	q := newCardQuery()
 	q.raw = raw
+	q.eval = func(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+		return evalCardsByTag(ctx, conn, tagID)
+	}
+	q.portable()
 
-	rs, err := db.QueryRaw(q)
+	rs, err := db.QueryRaw(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -142,15 +163,57 @@ func FindCardsByTag(db primitives.Database, tagID primitives.ID) ([]primitives.C
 	return castCards(rs)
 }
 
-func FindTagsByCard(db primitives.Database, cardID primitives.ID) ([]primitives.Tag, error) {
-	raw := `SELECT t.* FROM tags t
+func evalCardsByTag(ctx context.Context, conn primitives.Database,
+	tagID primitives.ID) ([]primitives.Record, error) {
+
+	q := newCardTagQuery()
+	q.where["tag_id"] = tagID
+
+	rs, err := conn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []primitives.Record
+
+	for _, r := range rs {
+		ct, ok := r.(*primitives.CardTag)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		card, err := FindCard(ctx, conn, ct.CardID)
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, card)
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		a := cards[i].(*primitives.Card)
+		b := cards[j].(*primitives.Card)
+		return a.MetaUpdatedAt.After(b.MetaUpdatedAt)
+	})
+
+	return cards, nil
+}
+
+func FindTagsByCard(ctx context.Context, db primitives.Database,
+	cardID primitives.ID) ([]primitives.Tag, error) {
+
+	raw := `SELECT ` + Columns(&primitives.Tag{}, "t") + ` FROM tags t
 	LEFT JOIN card_tags ct ON t.id = ct.tag_id
 	WHERE ct.card_id = ` + cardID.String() + ";"
 
 	q := newTagQuery()
 	q.raw = raw
+	q.eval = func(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+		return evalTagsByCard(ctx, conn, cardID)
+	}
+	q.portable()
 
-	rs, err := db.QueryRaw(q)
+	rs, err := db.QueryRaw(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -158,11 +221,43 @@ func FindTagsByCard(db primitives.Database, cardID primitives.ID) ([]primitives.
 	return castTags(rs)
 }
 
-func FindTag(db primitives.Database, id primitives.ID) (*primitives.Tag, error) {
+func evalTagsByCard(ctx context.Context, conn primitives.Database,
+	cardID primitives.ID) ([]primitives.Record, error) {
+
+	q := newCardTagQuery()
+	q.where["card_id"] = cardID
+
+	rs, err := conn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []primitives.Record
+
+	for _, r := range rs {
+		ct, ok := r.(*primitives.CardTag)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		tag, err := FindTag(ctx, conn, ct.TagID)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func FindTag(ctx context.Context, db primitives.Database,
+	id primitives.ID) (*primitives.Tag, error) {
+
 	q := newTagQuery()
 	q.where["id"] = id
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -175,11 +270,13 @@ func FindTag(db primitives.Database, id primitives.ID) (*primitives.Tag, error)
 	return tag, nil
 }
 
-func FindTags(db primitives.Database, deckID primitives.ID) ([]primitives.Tag, error) {
+func FindTags(ctx context.Context, db primitives.Database,
+	deckID primitives.ID) ([]primitives.Tag, error) {
+
 	q := newTagQuery()
 	q.where["deck_id"] = deckID
 
-	rs, err := db.Query(q)
+	rs, err := db.Query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -219,12 +316,14 @@ func castCards(rs []primitives.Record) ([]primitives.Card, error) {
 	return cards, nil
 }
 
-func CountCardsScheduled(db primitives.Database, deckID primitives.ID) (int, error) {
+func CountCardsScheduled(ctx context.Context, db primitives.Database,
+	deckID primitives.ID) (int, error) {
+
 	q := newCardScheduleQuery()
 	q.where["deck_id"] = deckID
 	q.where["next_date"] = LessOrEqual{time.Now().UTC()}
 
-	n, err := db.Count(q)
+	n, err := db.Count(ctx, q)
 	if err != nil {
 		return 0, errors.Wrapf(err, "failed to count cards scheduled for deck %d", deckID)
 	}
@@ -232,7 +331,7 @@ func CountCardsScheduled(db primitives.Database, deckID primitives.ID) (int, err
 	return n, nil
 }
 
-func FindNextCardScheduled(db primitives.Database, deckID primitives.ID,
+func FindNextCardScheduled(ctx context.Context, db primitives.Database, deckID primitives.ID,
 	nsfw bool) (*primitives.Card, error) {
 
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -242,19 +341,35 @@ func FindNextCardScheduled(db primitives.Database, deckID primitives.ID,
 		nsfwWhere = "AND c.nsfw = false"
 	}
 
-	raw := fmt.Sprintf(`SELECT c.* FROM cards c
+	columns := Columns(&primitives.Card{}, "c")
+
+	raw := fmt.Sprintf(`SELECT %s FROM cards c
 	RIGHT JOIN card_schedules cd ON c.id = cd.card_id
 	WHERE c.deck_id = %s
 	AND cd.next_date <= '%s'::date
 	%s
 	ORDER BY random()
 	LIMIT 1;
-	`, deckID, now, nsfwWhere)
+	`, columns, deckID, now, nsfwWhere)
 
 	q := newCardQuery()
 	q.raw = raw
+	q.eval = func(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+		return evalNextCardScheduled(ctx, conn, deckID, nsfw)
+	}
+	q.sqlite = func(ctx context.Context, conn SQLite) ([]primitives.Record, error) {
+		raw := fmt.Sprintf(`SELECT %s FROM cards c
+		JOIN card_schedules cd ON c.id = cd.card_id
+		WHERE c.deck_id = %s
+		AND date(cd.next_date) <= date(?1)
+		%s
+		ORDER BY RANDOM()
+		LIMIT 1;`, columns, deckID, nsfwWhere)
+
+		return conn.Select(ctx, q, raw, now)
+	}
 
-	rs, err := db.QueryRaw(q)
+	rs, err := db.QueryRaw(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -271,11 +386,52 @@ func FindNextCardScheduled(db primitives.Database, deckID primitives.ID,
 	return &cards[0], nil
 }
 
-func FindCardSchedule(db primitives.Database, cardID primitives.ID) (*primitives.CardSchedule, error) {
+func evalNextCardScheduled(ctx context.Context, conn primitives.Database, deckID primitives.ID,
+	nsfw bool) ([]primitives.Record, error) {
+
+	q := newCardScheduleQuery()
+	q.where["deck_id"] = deckID
+	q.where["next_date"] = LessOrEqual{time.Now().UTC()}
+
+	rs, err := conn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []primitives.Record
+
+	for _, r := range rs {
+		schedule, ok := r.(*primitives.CardSchedule)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		card, err := FindCard(ctx, conn, schedule.CardID)
+		if err != nil {
+			return nil, err
+		}
+
+		if card.NSFW && !nsfw {
+			continue
+		}
+
+		cards = append(cards, card)
+	}
+
+	if len(cards) == 0 {
+		return nil, nil
+	}
+
+	return []primitives.Record{cards[rand.Intn(len(cards))]}, nil
+}
+
+func FindCardSchedule(ctx context.Context, db primitives.Database,
+	cardID primitives.ID) (*primitives.CardSchedule, error) {
+
 	q := newCardScheduleQuery()
 	q.where["card_id"] = cardID
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -288,13 +444,13 @@ func FindCardSchedule(db primitives.Database, cardID primitives.ID) (*primitives
 	return schedule, nil
 }
 
-func FindCardReview(db primitives.Database, id primitives.ID) (
+func FindCardReview(ctx context.Context, db primitives.Database, id primitives.ID) (
 	*primitives.CardReview, error) {
 
 	q := newCardReviewQuery()
 	q.where["id"] = id
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -306,3 +462,27 @@ func FindCardReview(db primitives.Database, id primitives.ID) (
 
 	return review, nil
 }
+
+// CountCardReviews returns the number of deck reviews in the mode and how many
+// of them were correct
+func CountCardReviews(ctx context.Context, db primitives.Database, deckID primitives.ID,
+	mode string) (total int, correct int, err error) {
+
+	q := newCardReviewQuery()
+	q.where["deck_id"] = deckID
+	q.where["mode"] = mode
+
+	total, err = db.Count(ctx, q)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to count deck %d %s reviews", deckID, mode)
+	}
+
+	q.where["correct"] = true
+
+	correct, err = db.Count(ctx, q)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to count deck %d correct %s reviews", deckID, mode)
+	}
+
+	return total, correct, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// ErrFieldsChanged is returned when the deck fields changed while the cards
+// definitions were written
+var ErrFieldsChanged = errors.New("deck fields changed, try again")
+
+// MigrateDeckFields changes the deck fields and the definitions of all its
+// cards in a transaction, returning the number of cards changed
+func MigrateDeckFields(ctx context.Context, conn primitives.Database, deck *primitives.Deck,
+	m primitives.FieldMigration) (int, error) {
+
+	n := 0
+
+	err := Transaction(ctx, conn, func(tx primitives.Database) error {
+		locked, err := LockDeck(ctx, tx, deck.ID())
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(locked.Fields, deck.Fields) {
+			return ErrFieldsChanged
+		}
+
+		cards, err := FindCardsByDeck(ctx, tx, deck.ID(), true)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find deck %d cards", deck.ID())
+		}
+
+		for i := range cards {
+			card := &cards[i]
+
+			definitions := m.Definitions(card.Definitions)
+			if reflect.DeepEqual(definitions, card.Definitions) {
+				continue
+			}
+
+			card.Definitions = definitions
+
+			err := tx.Update(ctx, card)
+			if err != nil {
+				return errors.Wrapf(err, "failed to update card %d definitions", card.ID())
+			}
+
+			n++
+		}
+
+		err = m.Apply(deck)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Update(ctx, deck)
+		if err != nil {
+			return errors.Wrapf(err, "failed to update deck %d fields", deck.ID())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// SaveCard creates or updates the card in a transaction with its deck locked,
+// so its definitions can't miss a deck fields migration
+func SaveCard(ctx context.Context, conn primitives.Database, card *primitives.Card) error {
+	return Transaction(ctx, conn, func(tx primitives.Database) error {
+		deck, err := LockDeck(ctx, tx, card.DeckID)
+		if err != nil {
+			return err
+		}
+
+		if len(card.Definitions) != len(deck.Fields) {
+			return ErrFieldsChanged
+		}
+
+		if card.ID() == 0 {
+			return tx.Create(ctx, card)
+		}
+
+		return tx.Update(ctx, card)
+	})
+}
+
+// LockDeck finds the deck locking its row until the transaction ends. The
+// other databases run a transaction at a time, so they just find it.
+func LockDeck(ctx context.Context, conn primitives.Database, id primitives.ID) (*primitives.Deck, error) {
+	q := newDeckQuery()
+	q.raw = "SELECT " + Columns(&primitives.Deck{}, "d") + " FROM decks d WHERE d.id = " + id.String() +
+		" FOR UPDATE;"
+	q.eval = func(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+		deck, err := FindDeck(ctx, conn, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return []primitives.Record{deck}, nil
+	}
+	q.sqlite = func(ctx context.Context, conn SQLite) ([]primitives.Record, error) {
+		raw := "SELECT " + Columns(&primitives.Deck{}, "d") + " FROM decks d WHERE d.id = ?1;"
+		return conn.Select(ctx, q, raw, id)
+	}
+
+	rs, err := conn.QueryRaw(ctx, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock deck %d", id)
+	}
+
+	if len(rs) == 0 {
+		return nil, errors.Errorf("deck %d not found", id)
+	}
+
+	deck, ok := rs[0].(*primitives.Deck)
+	if !ok {
+		return nil, errors.Errorf("invalid record type %T", rs[0])
+	}
+
+	return deck, nil
+}
@@ -0,0 +1,314 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const version = 1
+
+// uniques mirrors the UNIQUE constraints of the psql tables
+var uniques = map[string][][]string{
+	"users":     {{"email"}},
+	"tags":      {{"deck_id", "name"}},
+	"card_tags": {{"card_id", "tag_id"}},
+}
+
+type table struct {
+	seq  primitives.ID
+	rows map[primitives.ID]row
+}
+
+// Database is an in-memory implementation of primitives.Database used by
+// tests and demo mode. Data is lost when the process exits.
+type Database struct {
+	sync   sync.RWMutex
+	tables map[string]*table
+
+	// txSync serializes the transactions
+	txSync sync.Mutex
+
+	listeners map[string][]chan struct{}
+}
+
+func New() *Database {
+	return &Database{
+		tables:    make(map[string]*table),
+		listeners: make(map[string][]chan struct{}),
+	}
+}
+
+func (db *Database) Create(ctx context.Context, r primitives.Record) error {
+	_, err := db.create(r)
+	return err
+}
+
+// create inserts the record, returning its row
+func (db *Database) create(r primitives.Record) (row, error) {
+	now := time.Now()
+
+	r.SetCreatedAt(now)
+	r.SetUpdatedAt(now)
+	r.SetVersion(version)
+
+	rw, err := rowFromRecord(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get record fields %v", r)
+	}
+
+	db.sync.Lock()
+	defer db.sync.Unlock()
+
+	name := r.Type() + "s"
+	t := db.table(name)
+
+	err = t.checkUnique(name, rw, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create db record %v", r)
+	}
+
+	t.seq++
+	id := t.seq
+
+	rw["id"] = id
+	t.rows[id] = rw
+
+	r.SetID(id)
+
+	return rw, nil
+}
+
+func (db *Database) Update(ctx context.Context, r primitives.Record) error {
+	_, _, err := db.update(r)
+	return err
+}
+
+// update replaces the record row, returning the previous and the new rows,
+// both nil when the record doesn't exist
+func (db *Database) update(r primitives.Record) (row, row, error) {
+	now := time.Now()
+
+	r.SetUpdatedAt(now)
+
+	rw, err := rowFromRecord(r)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get record fields %v", r)
+	}
+
+	db.sync.Lock()
+	defer db.sync.Unlock()
+
+	name := r.Type() + "s"
+	t := db.table(name)
+
+	prev, ok := t.rows[r.ID()]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	err = t.checkUnique(name, rw, r.ID())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to update db record %v", r)
+	}
+
+	t.rows[r.ID()] = rw
+
+	return prev, rw, nil
+}
+
+func (db *Database) Delete(ctx context.Context, r primitives.Record) error {
+	db.delete(r)
+	return nil
+}
+
+// delete removes the record row, returning it
+func (db *Database) delete(r primitives.Record) row {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+
+	t := db.table(r.Type() + "s")
+
+	prev := t.rows[r.ID()]
+	delete(t.rows, r.ID())
+
+	return prev
+}
+
+func (db *Database) Query(ctx context.Context, wq primitives.Query) ([]primitives.Record, error) {
+	rows, err := db.selectRows(wq)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRows(wq, rows)
+}
+
+// QueryRaw evaluates the raw query, its args being for the SQL databases
+func (db *Database) QueryRaw(ctx context.Context, wq primitives.Query,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	return eval(ctx, db, wq)
+}
+
+func (db *Database) Get(ctx context.Context, wq primitives.Query) (primitives.Record, error) {
+	rows, err := db.selectRows(wq)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.Wrap(sql.ErrNoRows, "failed to scan record")
+	}
+
+	r := wq.NewRecord()
+
+	err = rows[0].scan(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan record")
+	}
+
+	return r, nil
+}
+
+func (db *Database) Count(ctx context.Context, wq primitives.Query) (int, error) {
+	rows, err := db.selectRows(wq)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count records")
+	}
+
+	return len(rows), nil
+}
+
+func (db *Database) Random(ctx context.Context, wq primitives.Query, n int) ([]primitives.Record, error) {
+	rows, err := db.selectRows(wq)
+	if err != nil {
+		return nil, err
+	}
+
+	rand.Shuffle(len(rows), func(i, j int) {
+		rows[i], rows[j] = rows[j], rows[i]
+	})
+
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+
+	return scanRows(wq, rows)
+}
+
+// table returns the named table, creating it on first use. Callers must hold
+// the write lock.
+func (db *Database) table(name string) *table {
+	t, ok := db.tables[name]
+	if !ok {
+		t = &table{rows: make(map[primitives.ID]row)}
+		db.tables[name] = t
+	}
+
+	return t
+}
+
+// selectRows returns copies of the rows matching the query conditions, sorted
+// by the query sort order or by id
+func (db *Database) selectRows(wq primitives.Query) ([]row, error) {
+	name := wq.NewRecord().Type() + "s"
+
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+
+	t, ok := db.tables[name]
+	if !ok {
+		return nil, nil
+	}
+
+	var rows []row
+
+	for _, rw := range t.rows {
+		ok, err := rw.match(wq.Where())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to query records %s", name)
+		}
+
+		if ok {
+			rows = append(rows, rw.copy())
+		}
+	}
+
+	sortBy := wq.SortBy()
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, dir := range sortBy {
+			c := compare(rows[i][k], rows[j][k])
+			if c == 0 {
+				continue
+			}
+
+			if dir == "DESC" {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return compare(rows[i]["id"], rows[j]["id"]) < 0
+	})
+
+	return rows, nil
+}
+
+func (t *table) checkUnique(name string, rw row, self primitives.ID) error {
+	for _, cols := range uniques[name] {
+	Rows:
+		for id, other := range t.rows {
+			if id == self {
+				continue
+			}
+
+			for _, c := range cols {
+				if compare(rw[c], other[c]) != 0 {
+					continue Rows
+				}
+			}
+
+			return errors.Errorf("duplicate key value violates unique constraint %s %v", name, cols)
+		}
+	}
+
+	return nil
+}
+
+// eval answers raw queries by composing simple queries, as SQL cannot be run
+// in memory
+func eval(ctx context.Context, conn primitives.Database, wq primitives.Query) ([]primitives.Record, error) {
+	ev, ok := wq.(db.Evaluator)
+	if !ok {
+		return nil, errors.Errorf("raw query not supported %q", wq.Raw())
+	}
+
+	return ev.Eval(ctx, conn)
+}
+
+func scanRows(wq primitives.Query, rows []row) ([]primitives.Record, error) {
+	var records []primitives.Record
+
+	for _, rw := range rows {
+		r := wq.NewRecord()
+
+		err := rw.scan(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan records")
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
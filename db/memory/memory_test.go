@@ -0,0 +1,342 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestDatabase_Create(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		user := &primitives.User{Name: "Jane", Email: "jane@example.com"}
+
+		err := conn.Create(ctx, user)
+		test.OK(t, err)
+
+		test.Equal(t, "user id", primitives.ID(1), user.ID())
+		test.Equal(t, "user version", 1, user.MetaVersion)
+
+		found, err := db.FindUserByEmail(ctx, conn, "jane@example.com")
+		test.OK(t, err)
+		test.Equal(t, "found user", user.Name, found.Name)
+	})
+
+	t.Run("unique constraint", func(t *testing.T) {
+		user := &primitives.User{Name: "Other Jane", Email: "jane@example.com"}
+
+		err := conn.Create(ctx, user)
+		test.Error(t, err)
+	})
+}
+
+func TestDatabase_Update(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	deck := &primitives.Deck{Name: "Animals", Fields: []string{"English"}}
+
+	err := conn.Create(ctx, deck)
+	test.OK(t, err)
+
+	deck.Name = "Pets"
+	deck.Fields[0] = "Portuguese"
+
+	found, err := db.FindDeck(ctx, conn, deck.ID())
+	test.OK(t, err)
+	test.Equal(t, "unchanged fields", []string{"English"}, found.Fields)
+
+	err = conn.Update(ctx, deck)
+	test.OK(t, err)
+
+	found, err = db.FindDeck(ctx, conn, deck.ID())
+	test.OK(t, err)
+	test.Equal(t, "deck name", "Pets", found.Name)
+	test.Equal(t, "deck fields", []string{"Portuguese"}, found.Fields)
+}
+
+func TestDatabase_Delete(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	deck := &primitives.Deck{Name: "Animals", Fields: []string{"English"}}
+
+	err := conn.Create(ctx, deck)
+	test.OK(t, err)
+
+	err = conn.Delete(ctx, deck)
+	test.OK(t, err)
+
+	_, err = db.FindDeck(ctx, conn, deck.ID())
+	test.Error(t, err)
+}
+
+func TestDatabase_Get(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	_, err := db.FindCard(ctx, conn, 1)
+	test.Error(t, err)
+}
+
+func TestDatabase_Count(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+
+	for _, d := range []time.Time{yesterday, tomorrow} {
+		schedule := &primitives.CardSchedule{DeckID: 1, CardID: 1, NextDate: d}
+
+		err := conn.Create(ctx, schedule)
+		test.OK(t, err)
+	}
+
+	n, err := db.CountCardsScheduled(ctx, conn, 1)
+	test.OK(t, err)
+	test.Equal(t, "cards scheduled", 1, n)
+
+	reviews := []primitives.CardReview{
+		{DeckID: 1, CardID: 1, Mode: primitives.ListeningReview, Correct: true},
+		{DeckID: 1, CardID: 1, Mode: primitives.ListeningReview},
+		{DeckID: 1, CardID: 1, Mode: primitives.ImageReview, Correct: true},
+	}
+
+	for i := range reviews {
+		err := conn.Create(ctx, &reviews[i])
+		test.OK(t, err)
+	}
+
+	total, correct, err := db.CountCardReviews(ctx, conn, 1, primitives.ListeningReview)
+	test.OK(t, err)
+	test.Equal(t, "listening reviews", 2, total)
+	test.Equal(t, "correct listening reviews", 1, correct)
+}
+
+func TestDatabase_QueryRaw(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	deck := &primitives.Deck{UserID: 1, Name: "Animals", Fields: []string{"English"}}
+	test.OK(t, conn.Create(ctx, deck))
+
+	cat := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"black cat"}}
+	dog := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"dog"}, NSFW: true}
+	test.OK(t, conn.Create(ctx, cat))
+	test.OK(t, conn.Create(ctx, dog))
+
+	tag := &primitives.Tag{DeckID: deck.ID(), Name: "pets"}
+	test.OK(t, conn.Create(ctx, tag))
+	test.OK(t, conn.Create(ctx, &primitives.CardTag{CardID: dog.ID(), TagID: tag.ID()}))
+
+	t.Run("cards by tag", func(t *testing.T) {
+		cards, err := db.FindCardsByTag(ctx, conn, tag.ID())
+		test.OK(t, err)
+		test.Equal(t, "cards", 1, len(cards))
+		test.Equal(t, "card id", dog.ID(), cards[0].ID())
+	})
+
+	t.Run("tags by card", func(t *testing.T) {
+		tags, err := db.FindTagsByCard(ctx, conn, dog.ID())
+		test.OK(t, err)
+		test.Equal(t, "tags", 1, len(tags))
+		test.Equal(t, "tag name", "pets", tags[0].Name)
+	})
+
+	t.Run("search cards", func(t *testing.T) {
+		cards, err := db.SearchCards(ctx, conn, 1, "CAT", db.SearchFilters{})
+		test.OK(t, err)
+		test.Equal(t, "cards", 1, len(cards))
+		test.Equal(t, "card id", cat.ID(), cards[0].ID())
+
+		cards, err = db.SearchCards(ctx, conn, 1, "dog", db.SearchFilters{})
+		test.OK(t, err)
+		test.Equal(t, "nsfw cards", 0, len(cards))
+	})
+}
+
+func TestDatabase_Listen(t *testing.T) {
+	conn := New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wake, err := conn.Listen(ctx, "jobs")
+	test.OK(t, err)
+
+	test.OK(t, conn.Notify(ctx, "jobs"))
+	test.OK(t, conn.Notify(ctx, "jobs"))
+
+	_, ok := <-wake
+	test.Equal(t, "notified", true, ok)
+
+	cancel()
+
+	// the second notification was coalesced with the first one
+	_, ok = <-wake
+	test.Equal(t, "closed", false, ok)
+}
+
+func TestDatabase_Transaction(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	deck := &primitives.Deck{UserID: 1, Name: "Chinese", Fields: []string{"Hanzi", "English", "Pinyin"}, SpeechField: 2}
+	test.OK(t, conn.Create(ctx, deck))
+
+	cat := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"猫", "cat", "māo"}}
+	dog := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"狗", "dog", "gǒu"}}
+	test.OK(t, conn.Create(ctx, cat))
+	test.OK(t, conn.Create(ctx, dog))
+
+	t.Run("rollback", func(t *testing.T) {
+		err := db.Transaction(ctx, conn, func(tx primitives.Database) error {
+			cat.Definitions = []string{"猫"}
+			test.OK(t, tx.Update(ctx, cat))
+
+			return errors.New("failed")
+		})
+		test.Error(t, err)
+
+		found, err := db.FindCard(ctx, conn, cat.ID())
+		test.OK(t, err)
+		test.Equal(t, "definitions", []string{"猫", "cat", "māo"}, found.Definitions)
+	})
+
+	t.Run("rollback keeps other writes", func(t *testing.T) {
+		var created, outside *primitives.Card
+
+		err := db.Transaction(ctx, conn, func(tx primitives.Database) error {
+			created = &primitives.Card{DeckID: deck.ID(), Definitions: []string{"鱼", "fish", "yú"}}
+			test.OK(t, tx.Create(ctx, created))
+
+			// a nested transaction is part of this one
+			err := db.Transaction(ctx, tx, func(tx primitives.Database) error {
+				return tx.Delete(ctx, dog)
+			})
+			test.OK(t, err)
+
+			outside = &primitives.Card{DeckID: deck.ID(), Definitions: []string{"鸟", "bird", "niǎo"}}
+			test.OK(t, conn.Create(ctx, outside))
+
+			return errors.New("failed")
+		})
+		test.Error(t, err)
+
+		_, err = db.FindCard(ctx, conn, created.ID())
+		test.Error(t, err)
+
+		_, err = db.FindCard(ctx, conn, dog.ID())
+		test.OK(t, err)
+
+		_, err = db.FindCard(ctx, conn, outside.ID())
+		test.OK(t, err)
+
+		test.OK(t, conn.Delete(ctx, outside))
+	})
+
+	t.Run("rollback keeps concurrent writes", func(t *testing.T) {
+		err := db.Transaction(ctx, conn, func(tx primitives.Database) error {
+			card := *dog
+			card.Definitions = []string{"狗"}
+			test.OK(t, tx.Update(ctx, &card))
+
+			outside := *dog
+			outside.Definitions = []string{"狗", "dog", "gǒu", "hound"}
+			test.OK(t, conn.Update(ctx, &outside))
+
+			return errors.New("failed")
+		})
+		test.Error(t, err)
+
+		found, err := db.FindCard(ctx, conn, dog.ID())
+		test.OK(t, err)
+		test.Equal(t, "definitions", []string{"狗", "dog", "gǒu", "hound"}, found.Definitions)
+
+		test.OK(t, conn.Update(ctx, dog))
+	})
+
+	t.Run("save card", func(t *testing.T) {
+		card := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"鸭", "duck"}}
+		test.Equal(t, "fields changed", db.ErrFieldsChanged, db.SaveCard(ctx, conn, card))
+
+		card.Definitions = []string{"鸭", "duck", "yā"}
+		test.OK(t, db.SaveCard(ctx, conn, card))
+		test.OK(t, conn.Delete(ctx, card))
+	})
+
+	t.Run("migrate deck fields", func(t *testing.T) {
+		m := primitives.FieldMigration{
+			Fields: []primitives.Field{
+				{Name: "Pinyin", Kind: primitives.TextField, Required: true, Back: true},
+				{Name: "Hanzi", Kind: primitives.TextField, Required: true, Back: true},
+			},
+			Sources:  []int{2, 0},
+			Defaults: []string{"", ""},
+		}
+
+		found, err := db.FindDeck(ctx, conn, deck.ID())
+		test.OK(t, err)
+
+		stale := *found
+		stale.Fields = []string{"Hanzi", "English"}
+
+		_, err = db.MigrateDeckFields(ctx, conn, &stale, m)
+		test.Equal(t, "fields changed", db.ErrFieldsChanged, err)
+
+		n, err := db.MigrateDeckFields(ctx, conn, found, m)
+		test.OK(t, err)
+		test.Equal(t, "changed cards", 2, n)
+
+		card, err := db.FindCard(ctx, conn, dog.ID())
+		test.OK(t, err)
+		test.Equal(t, "definitions", []string{"gǒu", "狗"}, card.Definitions)
+
+		found, err = db.FindDeck(ctx, conn, deck.ID())
+		test.OK(t, err)
+		test.Equal(t, "fields", []string{"Pinyin", "Hanzi"}, found.Fields)
+		test.Equal(t, "speech field", 0, found.SpeechField)
+	})
+}
+
+func TestAuditor(t *testing.T) {
+	conn := New()
+	ctx := context.Background()
+
+	system, err := db.SystemUser(ctx, conn)
+	test.OK(t, err)
+
+	again, err := db.SystemUser(ctx, conn)
+	test.OK(t, err)
+	test.Equal(t, "system user", system.ID(), again.ID())
+
+	audited := db.Audit(db.Audit(conn, system.ID()), 2)
+	test.Equal(t, "auditor user", primitives.ID(2), audited.UserID)
+	test.Equal(t, "audited database", primitives.Database(conn), audited.Database)
+
+	deck := &primitives.Deck{UserID: 2, Name: "Animals", Fields: []string{"English"}}
+	test.OK(t, audited.Create(ctx, deck))
+
+	deck.Fields = []string{"English", "Portuguese"}
+	test.OK(t, audited.Update(ctx, deck))
+
+	changes, err := db.FindRecordChanges(ctx, conn, "deck", deck.ID())
+	test.OK(t, err)
+	test.Equal(t, "changes", 2, len(changes))
+
+	for _, c := range changes {
+		if c.Action != db.ActionUpdate {
+			continue
+		}
+
+		_, err = audited.Revert(ctx, c)
+		test.Error(t, err, "deck fields changes cannot be reverted, edit the deck fields instead")
+	}
+}
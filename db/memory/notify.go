@@ -0,0 +1,47 @@
+package memory
+
+import "context"
+
+// Notify wakes the listeners of the channel
+func (db *Database) Notify(ctx context.Context, channel string) error {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+
+	for _, l := range db.listeners[channel] {
+		select {
+		case l <- struct{}{}:
+		default: // a wake up is already pending
+		}
+	}
+
+	return nil
+}
+
+// Listen returns a channel that receives a value for each notification, it's
+// closed when ctx is done
+func (db *Database) Listen(ctx context.Context, channel string) (<-chan struct{}, error) {
+	wake := make(chan struct{}, 1)
+
+	db.sync.Lock()
+	db.listeners[channel] = append(db.listeners[channel], wake)
+	db.sync.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		db.sync.Lock()
+		defer db.sync.Unlock()
+
+		ls := db.listeners[channel]
+		for i, l := range ls {
+			if l == wake {
+				db.listeners[channel] = append(ls[:i], ls[i+1:]...)
+				break
+			}
+		}
+
+		close(wake)
+	}()
+
+	return wake, nil
+}
@@ -0,0 +1,216 @@
+package memory
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// row holds a record column values by their db tag
+type row map[string]interface{}
+
+func rowFromRecord(r primitives.Record) (row, error) {
+	rv := reflect.ValueOf(r)
+	if rv.Kind() != reflect.Ptr {
+		return nil, errors.Errorf("cannot get database fields for record %v", r)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	rw := make(row)
+
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("db")
+		if tag == "" {
+			continue
+		}
+
+		rw[tag] = clone(rv.Field(i)).Interface()
+	}
+
+	return rw, nil
+}
+
+// scan sets the record fields from the row columns. Fields without a matching
+// column are left untouched.
+func (rw row) scan(r primitives.Record) error {
+	rv := reflect.ValueOf(r)
+	if rv.Kind() != reflect.Ptr {
+		return errors.Errorf("cannot scan database fields for record %v", r)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("db")
+
+		v, ok := rw[tag]
+		if tag == "" || !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		value := clone(reflect.ValueOf(v))
+
+		if !value.IsValid() {
+			continue
+		}
+
+		if !value.Type().ConvertibleTo(field.Type()) {
+			return errors.Errorf("cannot scan column %s of type %s into %s", tag,
+				value.Type(), field.Type())
+		}
+
+		field.Set(value.Convert(field.Type()))
+	}
+
+	return nil
+}
+
+func (rw row) copy() row {
+	cp := make(row, len(rw))
+
+	for k, v := range rw {
+		cp[k] = clone(reflect.ValueOf(v)).Interface()
+	}
+
+	return cp
+}
+
+// match reports whether the row satisfies all where conditions, using the
+// same semantics as the psql where clause
+func (rw row) match(where map[string]interface{}) (bool, error) {
+	for k, v := range where {
+		col, ok := rw[k]
+		if !ok {
+			return false, errors.Errorf("column %q does not exist", k)
+		}
+
+		switch t := v.(type) {
+		case string, int, primitives.ID, bool:
+			if compare(col, v) != 0 {
+				return false, nil
+			}
+		case db.GreaterOrEqual:
+			if compare(col, date(t.Time)) < 0 {
+				return false, nil
+			}
+		case db.LessOrEqual:
+			if compare(col, date(t.Time)) > 0 {
+				return false, nil
+			}
+		default:
+			return false, errors.Errorf("invalid type %T for where clause", t)
+		}
+	}
+
+	return true, nil
+}
+
+// date truncates t the same way a ::date cast does
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// compare returns -1, 0 or 1 when a is less, equal or greater than b. Values
+// of different kinds are ordered by their kind.
+func compare(a, b interface{}) int {
+	av := reflect.ValueOf(a)
+	bv := reflect.ValueOf(b)
+
+	if !av.IsValid() || !bv.IsValid() {
+		return compareInt(int64(kind(av)), int64(kind(bv)))
+	}
+
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			switch {
+			case at.Before(bt):
+				return -1
+			case at.After(bt):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	switch {
+	case isInt(av) && isInt(bv):
+		return compareInt(av.Int(), bv.Int())
+	case av.Kind() == reflect.String && bv.Kind() == reflect.String:
+		return strings.Compare(av.String(), bv.String())
+	case av.Kind() == reflect.Bool && bv.Kind() == reflect.Bool:
+		return compareInt(boolInt(av.Bool()), boolInt(bv.Bool()))
+	case av.Kind() == reflect.Slice && bv.Kind() == reflect.Slice:
+		n := av.Len()
+		if bv.Len() < n {
+			n = bv.Len()
+		}
+
+		for i := 0; i < n; i++ {
+			c := compare(av.Index(i).Interface(), bv.Index(i).Interface())
+			if c != 0 {
+				return c
+			}
+		}
+
+		return compareInt(int64(av.Len()), int64(bv.Len()))
+	default:
+		return compareInt(int64(kind(av)), int64(kind(bv)))
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func kind(v reflect.Value) reflect.Kind {
+	if !v.IsValid() {
+		return reflect.Invalid
+	}
+
+	return v.Kind()
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// clone returns a copy of v that does not share slice memory with it
+func clone(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Slice || v.IsNil() {
+		return v
+	}
+
+	cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(cp, v)
+
+	return cp
+}
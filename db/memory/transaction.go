@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// Transaction runs fn with the other transactions waiting for it, restoring
+// the rows written by fn when it fails. Writes made outside of transactions
+// aren't isolated, the rows they change after fn wrote them are kept.
+func (db *Database) Transaction(ctx context.Context, fn func(primitives.Database) error) error {
+	db.txSync.Lock()
+	defer db.txSync.Unlock()
+
+	tx := &transaction{Database: db}
+
+	err := fn(tx)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+
+	return nil
+}
+
+// transaction is the database given to the transaction functions, keeping the
+// rows before and after its writes
+type transaction struct {
+	*Database
+	undo []undo
+}
+
+// undo is a row as it was before a transaction write and the row written, nil
+// when it didn't exist
+type undo struct {
+	table   string
+	id      primitives.ID
+	row     row
+	written row
+}
+
+func (tx *transaction) Create(ctx context.Context, r primitives.Record) error {
+	rw, err := tx.Database.create(r)
+	if err != nil {
+		return err
+	}
+
+	tx.undo = append(tx.undo, undo{table: r.Type() + "s", id: r.ID(), written: rw})
+
+	return nil
+}
+
+func (tx *transaction) Update(ctx context.Context, r primitives.Record) error {
+	prev, rw, err := tx.Database.update(r)
+	if err != nil || prev == nil {
+		return err
+	}
+
+	tx.undo = append(tx.undo, undo{table: r.Type() + "s", id: r.ID(), row: prev, written: rw})
+
+	return nil
+}
+
+func (tx *transaction) Delete(ctx context.Context, r primitives.Record) error {
+	prev := tx.Database.delete(r)
+	if prev == nil {
+		return nil
+	}
+
+	tx.undo = append(tx.undo, undo{table: r.Type() + "s", id: r.ID(), row: prev})
+
+	return nil
+}
+
+// QueryRaw evaluates the query on the transaction, so the writes of the
+// evaluation are restored as well
+func (tx *transaction) QueryRaw(ctx context.Context, wq primitives.Query,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	return eval(ctx, tx, wq)
+}
+
+// Transaction runs fn in the current transaction
+func (tx *transaction) Transaction(ctx context.Context, fn func(primitives.Database) error) error {
+	return fn(tx)
+}
+
+// rollback restores the written rows, latest writes first. Rows changed since
+// the transaction wrote them are skipped.
+func (tx *transaction) rollback() {
+	tx.sync.Lock()
+	defer tx.sync.Unlock()
+
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		u := tx.undo[i]
+		t := tx.table(u.table)
+
+		if !sameRow(t.rows[u.id], u.written) {
+			continue
+		}
+
+		if u.row == nil {
+			delete(t.rows, u.id)
+		} else {
+			t.rows[u.id] = u.row
+		}
+	}
+}
+
+// sameRow reports whether both rows are the same map, rows are replaced on
+// writes and never changed in place
+func sameRow(a, b row) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
@@ -0,0 +1,111 @@
+package psql
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the query latency histograms
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// histograms are published to expvar as psql_query_latency, keyed by the
+// Database method
+var histograms = map[string]*histogram{
+	"create": newHistogram(latencyBuckets),
+	"update": newHistogram(latencyBuckets),
+	"delete": newHistogram(latencyBuckets),
+	"query":  newHistogram(latencyBuckets),
+	"raw":    newHistogram(latencyBuckets),
+	"get":    newHistogram(latencyBuckets),
+	"count":  newHistogram(latencyBuckets),
+	"random": newHistogram(latencyBuckets),
+}
+
+func init() {
+	m := expvar.NewMap("psql_query_latency")
+
+	for name, h := range histograms {
+		m.Set(name, h)
+	}
+}
+
+func observe(method string, start time.Time) {
+	h, ok := histograms[method]
+	if !ok {
+		return
+	}
+
+	h.Observe(time.Since(start))
+}
+
+type histogram struct {
+	sync.Mutex
+
+	buckets []time.Duration
+	counts  []int64
+	count   int64
+	sum     time.Duration
+}
+
+func newHistogram(buckets []time.Duration) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)),
+	}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.count++
+	h.sum += d
+
+	for i, b := range h.buckets {
+		if d <= b {
+			h.counts[i]++
+		}
+	}
+}
+
+// String encodes the cumulative bucket counts as JSON, as required by
+// expvar.Var. Latencies above the last bucket only show up in count.
+func (h *histogram) String() string {
+	h.Lock()
+	defer h.Unlock()
+
+	buckets := make(map[string]int64, len(h.buckets))
+	for i, b := range h.buckets {
+		buckets[b.String()] = h.counts[i]
+	}
+
+	v := struct {
+		Count   int64            `json:"count"`
+		SumMS   float64          `json:"sum_ms"`
+		Buckets map[string]int64 `json:"buckets"`
+	}{
+		Count:   h.count,
+		SumMS:   float64(h.sum) / float64(time.Millisecond),
+		Buckets: buckets,
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(b)
+}
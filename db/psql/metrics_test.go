@@ -0,0 +1,30 @@
+package psql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Second})
+
+	h.Observe(500 * time.Microsecond)
+	h.Observe(100 * time.Millisecond)
+	h.Observe(2 * time.Second)
+
+	var v struct {
+		Count   int64            `json:"count"`
+		SumMS   float64          `json:"sum_ms"`
+		Buckets map[string]int64 `json:"buckets"`
+	}
+
+	err := json.Unmarshal([]byte(h.String()), &v)
+	test.OK(t, err)
+
+	test.Equal(t, "count", int64(3), v.Count)
+	test.Equal(t, "sum", 2100.5, v.SumMS)
+	test.Equal(t, "buckets", map[string]int64{"1ms": 1, "1s": 2}, v.Buckets)
+}
@@ -1,6 +1,7 @@
 package psql
 
 import (
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
@@ -43,7 +44,7 @@ func createCardSchedules(db *Database) error {
 	}
 
 	for _, s := range schedules {
-		err := db.Create(s)
+		err := db.Create(context.Background(), s)
 		if err != nil {
 			return errors.Wrapf(err, "failed to create card schedule %v", s)
 		}
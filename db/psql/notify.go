@@ -0,0 +1,59 @@
+package psql
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Notify sends an empty notification to the connections listening on the
+// channel, in a transaction it's sent on commit
+func (db *Database) Notify(ctx context.Context, channel string) error {
+	_, err := db.exec(ctx, "SELECT pg_notify($1, '');", channel)
+	if err != nil {
+		return errors.Wrapf(err, "failed to notify channel %q", channel)
+	}
+
+	return nil
+}
+
+// Listen opens a dedicated connection listening on the channel. The returned
+// channel receives a value for each notification and after reconnects, as
+// notifications may have been missed, and it's closed when ctx is done.
+func (db *Database) Listen(ctx context.Context, channel string) (<-chan struct{}, error) {
+	l := pq.NewListener(db.url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("listener on channel %q failed %s\n", channel, err)
+		}
+	})
+
+	err := l.Listen(channel)
+	if err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "failed to listen on channel %q", channel)
+	}
+
+	wake := make(chan struct{}, 1)
+
+	go func() {
+		defer close(wake)
+		defer l.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.Notify:
+				select {
+				case wake <- struct{}{}:
+				default: // a wake up is already pending
+				}
+			}
+		}
+	}()
+
+	return wake, nil
+}
@@ -1,8 +1,10 @@
 package psql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/pkg/errors"
@@ -11,16 +13,46 @@ import (
 
 const version = 1
 
+// Config sets the connection pool limits and the statement timeout, zero
+// values keep the database/sql defaults
+type Config struct {
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	StatementTimeout time.Duration
+
+	// PingAttempts is the number of times the connection is checked on
+	// startup, waiting PingBackoff between the first attempts and doubling it
+	// after each failure
+	PingAttempts int
+	PingBackoff  time.Duration
+}
+
 type Database struct {
 	*sql.DB
+
+	url     string
+	timeout time.Duration
+
+	// tx is set on the copies bound to a transaction
+	tx *sql.Tx
 }
 
-func New(url string) (*Database, error) {
+func New(url string, cfg Config) (*Database, error) {
 	conn, err := sql.Open("postgres", url)
 	if err != nil {
 		return nil, err
 	}
 
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	err = ping(conn, cfg.PingAttempts, cfg.PingBackoff)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ping database")
+	}
+
 	for _, q := range tableQueries {
 		_, err = conn.Exec(q)
 
@@ -29,7 +61,7 @@ func New(url string) (*Database, error) {
 		}
 	}
 
-	db := &Database{conn}
+	db := &Database{DB: conn, url: url, timeout: cfg.StatementTimeout}
 
 	err = createCardSchedules(db)
 	if err != nil {
@@ -39,7 +71,100 @@ func New(url string) (*Database, error) {
 	return db, nil
 }
 
-func (db *Database) Create(r primitives.Record) error {
+func ping(conn *sql.DB, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			log.Printf("database not ready, retrying in %s (%s)\n", backoff, err)
+
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		err = conn.Ping()
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// withTimeout bounds the statement by the configured timeout, on top of any
+// deadline the caller context already has
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, db.timeout)
+}
+
+// Transaction runs fn with a copy of the database bound to a transaction,
+// committed when fn succeeds. Nested transactions run in the outer one.
+func (db *Database) Transaction(ctx context.Context, fn func(primitives.Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	err = fn(&Database{DB: db.DB, url: db.url, timeout: db.timeout, tx: tx})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+func (db *Database) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(ctx, query, args...)
+	}
+
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *Database) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, query, args...)
+	}
+
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *Database) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *Database) Create(ctx context.Context, r primitives.Record) error {
+	defer observe("create", time.Now())
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	now := time.Now()
 
 	r.SetCreatedAt(now)
@@ -56,7 +181,7 @@ func (db *Database) Create(r primitives.Record) error {
 
 	var id primitives.ID
 
-	err = db.QueryRow(query, q.addrs...).Scan(&id)
+	err = db.queryRow(ctx, query, q.addrs...).Scan(&id)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create db record %q", query)
 	}
@@ -66,7 +191,12 @@ func (db *Database) Create(r primitives.Record) error {
 	return nil
 }
 
-func (db *Database) Update(r primitives.Record) error {
+func (db *Database) Update(ctx context.Context, r primitives.Record) error {
+	defer observe("update", time.Now())
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	now := time.Now()
 
 	r.SetUpdatedAt(now)
@@ -79,7 +209,7 @@ func (db *Database) Update(r primitives.Record) error {
 	query := fmt.Sprintf("UPDATE %s SET (%s) = (%s) WHERE id = %d;", q.Table(), q.Columns(),
 		q.Placeholders(), r.ID())
 
-	_, err = db.Exec(query, q.addrs...)
+	_, err = db.exec(ctx, query, q.addrs...)
 	if err != nil {
 		return errors.Wrapf(err, "failed to update db record %q", query)
 	}
@@ -87,7 +217,25 @@ func (db *Database) Update(r primitives.Record) error {
 	return nil
 }
 
-func (db *Database) Query(wq primitives.Query) ([]primitives.Record, error) {
+func (db *Database) Delete(ctx context.Context, r primitives.Record) error {
+	defer observe("delete", time.Now())
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %d;", r.Type()+"s", r.ID())
+
+	_, err := db.exec(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete db record %q", query)
+	}
+
+	return nil
+}
+
+func (db *Database) Query(ctx context.Context, wq primitives.Query) ([]primitives.Record, error) {
+	defer observe("query", time.Now())
+
 	q, err := QueryFromRecord(wq.NewRecord(), Select)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get record fields %s", q)
@@ -95,10 +243,15 @@ func (db *Database) Query(wq primitives.Query) ([]primitives.Record, error) {
 
 	raw := fmt.Sprintf("SELECT %s FROM %s %s;", q.Columns(), q.Table(), where(wq))
 
-	return db.queryRows(wq, raw)
+	return db.queryRows(ctx, wq, raw)
 }
 
-func (db *Database) Get(wq primitives.Query) (primitives.Record, error) {
+func (db *Database) Get(ctx context.Context, wq primitives.Query) (primitives.Record, error) {
+	defer observe("get", time.Now())
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	r := wq.NewRecord()
 
 	q, err := QueryFromRecord(r, Select)
@@ -108,7 +261,7 @@ func (db *Database) Get(wq primitives.Query) (primitives.Record, error) {
 
 	query := fmt.Sprintf("SELECT %s FROM %s %s;", q.Columns(), q.Table(), where(wq))
 
-	row := db.DB.QueryRow(query)
+	row := db.queryRow(ctx, query)
 
 	err = q.Scan(row)
 	if err != nil {
@@ -118,16 +271,25 @@ func (db *Database) Get(wq primitives.Query) (primitives.Record, error) {
 	return r, nil
 }
 
-func (db *Database) QueryRaw(wq primitives.Query) ([]primitives.Record, error) {
-	return db.queryRows(wq, wq.Raw())
+func (db *Database) QueryRaw(ctx context.Context, wq primitives.Query,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	defer observe("raw", time.Now())
+
+	return db.queryRows(ctx, wq, wq.Raw(), args...)
 }
 
-func (db *Database) Count(wq primitives.Query) (int, error) {
+func (db *Database) Count(ctx context.Context, wq primitives.Query) (int, error) {
+	defer observe("count", time.Now())
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	table := wq.NewRecord().Type() + "s"
 
 	query := fmt.Sprintf("SELECT COUNT(*) FROM %s %s;", table, where(wq))
 
-	row := db.DB.QueryRow(query)
+	row := db.queryRow(ctx, query)
 
 	var n int
 
@@ -139,7 +301,9 @@ func (db *Database) Count(wq primitives.Query) (int, error) {
 	return n, nil
 }
 
-func (db *Database) Random(wq primitives.Query, n int) ([]primitives.Record, error) {
+func (db *Database) Random(ctx context.Context, wq primitives.Query, n int) ([]primitives.Record, error) {
+	defer observe("random", time.Now())
+
 	r := wq.NewRecord()
 	q, err := QueryFromRecord(r, Select)
 	if err != nil {
@@ -149,11 +313,16 @@ func (db *Database) Random(wq primitives.Query, n int) ([]primitives.Record, err
 	raw := fmt.Sprintf(`SELECT %s FROM %s WHERE id IN (SELECT id FROM %s %s ORDER BY RANDOM() LIMIT %d)`,
 		q.Columns(), q.Table(), q.Table(), where(wq), n)
 
-	return db.queryRows(wq, raw)
+	return db.queryRows(ctx, wq, raw)
 }
 
-func (db *Database) queryRows(wq primitives.Query, query string) ([]primitives.Record, error) {
-	rows, err := db.DB.Query(query)
+func (db *Database) queryRows(ctx context.Context, wq primitives.Query,
+	query string, args ...interface{}) ([]primitives.Record, error) {
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.query(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to query records %q", query)
 	}
@@ -113,4 +113,74 @@ var tableQueries = []string{
 		`,
 	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS primary_field INTEGER DEFAULT 0;`,
 	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS nsfw BOOLEAN NOT NULL DEFAULT false;`,
+
+	`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS lease_until TIMESTAMPTZ NOT NULL DEFAULT NOW();`,
+	`CREATE INDEX IF NOT EXISTS jobs_state_run_at_idx ON jobs (state, run_at);`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS admin BOOLEAN NOT NULL DEFAULT false;`,
+	`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS unique_key TEXT NOT NULL DEFAULT '';`,
+	`
+		CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON jobs (unique_key)
+		WHERE unique_key <> '' AND state IN ('scheduled', 'retry');
+		`,
+	`CREATE INDEX IF NOT EXISTS jobs_state_updated_at_idx ON jobs (state, updated_at);`,
+	`
+		CREATE TABLE IF NOT EXISTS archived_jobs(
+			id SERIAL PRIMARY KEY,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			name TEXT NOT NULL,
+			state TEXT NOT NULL,
+			args BYTEA,
+			error TEXT,
+			tries INTEGER NOT NULL DEFAULT 0,
+			lease_until TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			unique_key TEXT NOT NULL DEFAULT ''
+		);
+		`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm;`,
+	`
+		CREATE OR REPLACE FUNCTION card_search_text(definitions TEXT[], caption TEXT)
+		RETURNS TEXT AS $$
+			SELECT array_to_string(definitions, ' ') || ' ' || COALESCE(caption, '');
+		$$ LANGUAGE SQL IMMUTABLE;
+		`,
+	`
+		CREATE INDEX IF NOT EXISTS cards_search_idx ON cards
+		USING GIN (to_tsvector('simple', card_search_text(definitions, caption)));
+		`,
+	`
+		CREATE INDEX IF NOT EXISTS cards_search_trgm_idx ON cards
+		USING GIN (card_search_text(definitions, caption) gin_trgm_ops);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS record_changes(
+			id SERIAL PRIMARY KEY,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			record_type TEXT NOT NULL CHECK(record_type <> ''),
+			record_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+			action TEXT NOT NULL CHECK(action <> ''),
+			changes BYTEA NOT NULL
+		);
+		`,
+	`
+		CREATE INDEX IF NOT EXISTS record_changes_record_idx
+		ON record_changes (record_type, record_id);
+		`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS image_source_url TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS image_unreachable BOOLEAN NOT NULL DEFAULT false;`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS image_variants TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS image_variants TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS image_variants TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS speech_field INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS speech_language TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE card_reviews ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT '';`,
+	`CREATE INDEX IF NOT EXISTS card_reviews_deck_mode_idx ON card_reviews (deck_id, mode);`,
+	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS field_types TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE decks ADD COLUMN IF NOT EXISTS field_schema BYTEA;`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS sound_generated BOOLEAN NOT NULL DEFAULT false;`,
 }
@@ -1,12 +1,41 @@
 package db
 
-import "gitlab.com/luizbranco/cyberbrain/primitives"
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// Evaluator is implemented by raw queries that can also be answered by
+// composing simple queries, for the in-memory database. Evaluations match the
+// query filters but not always its ranking, see each eval function.
+type Evaluator interface {
+	Eval(context.Context, primitives.Database) ([]primitives.Record, error)
+}
+
+// SQLiteQuery is implemented by raw queries with a SQLite version, which runs
+// in a transaction as SQLite has no RETURNING clause or row locks
+type SQLiteQuery interface {
+	SQLite(context.Context, SQLite) ([]primitives.Record, error)
+}
+
+// SQLite runs the statements of the SQLite queries, bound to the args
+type SQLite interface {
+	Select(ctx context.Context, q primitives.Query, query string, args ...interface{}) ([]primitives.Record, error)
+	Exec(ctx context.Context, query string, args ...interface{}) (int, error)
+}
 
 type query struct {
 	record func() primitives.Record
 	where  map[string]interface{}
 	raw    string
 	sortBy map[string]string
+	eval   func(context.Context, primitives.Database) ([]primitives.Record, error)
+	sqlite func(context.Context, SQLite) ([]primitives.Record, error)
 }
 
 func (q *query) NewRecord() primitives.Record {
@@ -25,6 +54,68 @@ func (q *query) SortBy() map[string]string {
 	return q.sortBy
 }
 
+func (q *query) Eval(ctx context.Context, db primitives.Database) ([]primitives.Record, error) {
+	if q.eval == nil {
+		return nil, errors.Errorf("raw query cannot be evaluated %q", q.raw)
+	}
+
+	return q.eval(ctx, db)
+}
+
+func (q *query) SQLite(ctx context.Context, db SQLite) ([]primitives.Record, error) {
+	if q.sqlite == nil {
+		return nil, errors.Errorf("raw query has no SQLite version %q", q.raw)
+	}
+
+	return q.sqlite(ctx, db)
+}
+
+// portable sets the raw query as its SQLite version, for the queries both
+// dialects understand
+func (q *query) portable() {
+	q.sqlite = func(ctx context.Context, db SQLite) ([]primitives.Record, error) {
+		return db.Select(ctx, q, q.raw)
+	}
+}
+
+// Columns returns the select list of the record columns in the table alias, in
+// the order they are scanned. Null strings are selected as empty strings.
+func Columns(r primitives.Record, alias string) string {
+	rt := reflect.TypeOf(r)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	var columns []string
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+
+		tag := f.Tag.Get("db")
+		if tag == "" {
+			continue
+		}
+
+		if f.Type.Kind() == reflect.String {
+			columns = append(columns, fmt.Sprintf("COALESCE(%s.%s, '') AS %s", alias, tag, tag))
+		} else {
+			columns = append(columns, alias+"."+tag)
+		}
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+// IDs returns the records ids as a SQL list, eg "1, 2, 3"
+func IDs(rs []primitives.Record) string {
+	ids := make([]string, len(rs))
+	for i, r := range rs {
+		ids[i] = r.ID().String()
+	}
+
+	return strings.Join(ids, ", ")
+}
+
 func newUserQuery() *query {
 	fn := func() primitives.Record {
 		return &primitives.User{}
@@ -108,3 +199,15 @@ func newCardReviewQuery() *query {
 		sortBy: make(map[string]string),
 	}
 }
+
+func newRecordChangeQuery() *query {
+	fn := func() primitives.Record {
+		return &primitives.RecordChange{}
+	}
+
+	return &query{
+		record: fn,
+		where:  make(map[string]interface{}),
+		sortBy: make(map[string]string),
+	}
+}
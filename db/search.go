@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const searchLimit = 50
+
+// SearchFilters narrows down the cards returned by SearchCards
+type SearchFilters struct {
+	DeckID primitives.ID
+	TagID  primitives.ID
+	NSFW   bool
+}
+
+// SearchCards finds cards across all user decks matching the query by their
+// definitions or caption. Full-text search covers word matches while trigram
+// similarity covers scripts without word boundaries, such as CJK.
+func SearchCards(ctx context.Context, db primitives.Database, userID primitives.ID, query string,
+	f SearchFilters) ([]primitives.Card, error) {
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	text := "card_search_text(c.definitions, c.caption)"
+	tsquery := "plainto_tsquery('simple', $1)"
+
+	var joins, filters string
+
+	if f.TagID > 0 {
+		joins = "JOIN card_tags ct ON c.id = ct.card_id AND ct.tag_id = " + f.TagID.String()
+	}
+
+	if f.DeckID > 0 {
+		filters += " AND c.deck_id = " + f.DeckID.String()
+	}
+
+	if !f.NSFW {
+		filters += " AND c.nsfw = false"
+	}
+
+	columns := Columns(&primitives.Card{}, "c")
+
+	raw := fmt.Sprintf(`SELECT %s
+	FROM cards c
+	JOIN decks d ON c.deck_id = d.id
+	%s
+	WHERE d.user_id = %s
+	AND (to_tsvector('simple', %s) @@ %s OR %s ILIKE $2)
+	%s
+	ORDER BY ts_rank(to_tsvector('simple', %s), %s) DESC, c.updated_at DESC
+	LIMIT %d;`, columns, joins, userID, text, tsquery, text, filters, text, tsquery, searchLimit)
+
+	q := newCardQuery()
+	q.raw = raw
+	q.eval = func(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+		return evalSearchCards(ctx, conn, userID, query, f)
+	}
+	q.sqlite = func(ctx context.Context, conn SQLite) ([]primitives.Record, error) {
+		return sqliteSearchCards(ctx, conn, q, columns, joins, filters, userID, query)
+	}
+
+	rs, err := db.QueryRaw(ctx, q, query, "%"+escapeLike(query)+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	return castCards(rs)
+}
+
+// evalSearchCards approximates SearchCards with matchSearch. Unlike PostgreSQL
+// it doesn't rank the matches by relevance, cards are sorted by their last
+// update only.
+func evalSearchCards(ctx context.Context, conn primitives.Database, userID primitives.ID, query string,
+	f SearchFilters) ([]primitives.Record, error) {
+
+	decks, err := FindDecks(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged map[primitives.ID]bool
+
+	if f.TagID > 0 {
+		q := newCardTagQuery()
+		q.where["tag_id"] = f.TagID
+
+		rs, err := conn.Query(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		tagged = make(map[primitives.ID]bool)
+
+		for _, r := range rs {
+			ct, ok := r.(*primitives.CardTag)
+			if !ok {
+				return nil, errors.Errorf("invalid record type %T", r)
+			}
+
+			tagged[ct.CardID] = true
+		}
+	}
+
+	var cards []primitives.Record
+
+	for _, d := range decks {
+		if f.DeckID > 0 && d.ID() != f.DeckID {
+			continue
+		}
+
+		deckCards, err := FindCardsByDeck(ctx, conn, d.ID(), f.NSFW)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range deckCards {
+			c := &deckCards[i]
+
+			if tagged != nil && !tagged[c.ID()] {
+				continue
+			}
+
+			text := strings.Join(c.Definitions, " ") + " " + c.Caption
+
+			if matchSearch(text, query) {
+				cards = append(cards, c)
+			}
+		}
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		a := cards[i].(*primitives.Card)
+		b := cards[j].(*primitives.Card)
+		return a.MetaUpdatedAt.After(b.MetaUpdatedAt)
+	})
+
+	if len(cards) > searchLimit {
+		cards = cards[:searchLimit]
+	}
+
+	return cards, nil
+}
+
+// sqliteSearchCards matches the cards containing all the query words, ignoring
+// the case of ASCII letters only, sorted by their last update
+func sqliteSearchCards(ctx context.Context, conn SQLite, q primitives.Query, columns, joins,
+	filters string, userID primitives.ID, query string) ([]primitives.Record, error) {
+
+	// definitions are stored as a JSON array
+	text := "(c.definitions || ' ' || COALESCE(c.caption, ''))"
+
+	var matches []string
+	var args []interface{}
+
+	for _, w := range strings.Fields(query) {
+		args = append(args, "%"+escapeLike(w)+"%")
+		matches = append(matches, fmt.Sprintf(`%s LIKE ?%d ESCAPE '\'`, text, len(args)))
+	}
+
+	raw := fmt.Sprintf(`SELECT %s
+	FROM cards c
+	JOIN decks d ON c.deck_id = d.id
+	%s
+	WHERE d.user_id = %s
+	AND %s
+	%s
+	ORDER BY julianday(c.updated_at) DESC
+	LIMIT %d;`, columns, joins, userID, strings.Join(matches, " AND "), filters, searchLimit)
+
+	return conn.Select(ctx, q, raw, args...)
+}
+
+// matchSearch reports whether text contains the query, or all of its words,
+// ignoring case
+func matchSearch(text, query string) bool {
+	text = strings.ToLower(text)
+	query = strings.ToLower(query)
+
+	if strings.Contains(text, query) {
+		return true
+	}
+
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(text) {
+		words[w] = true
+	}
+
+	for _, w := range strings.Fields(query) {
+		if !words[w] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// escapeLike escapes LIKE wildcards so they are matched literally
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+// rawDatabase records the raw queries and their args
+type rawDatabase struct {
+	primitives.Database
+	raw  string
+	args []interface{}
+}
+
+func (db *rawDatabase) QueryRaw(ctx context.Context, q primitives.Query,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	db.raw = q.Raw()
+	db.args = args
+
+	return nil, nil
+}
+
+func TestSearchCards_args(t *testing.T) {
+	conn := &rawDatabase{}
+
+	_, err := SearchCards(context.Background(), conn, 1, "it's 100%'; DROP TABLE cards; --", SearchFilters{})
+	test.OK(t, err)
+
+	test.Equal(t, "query in raw", false, strings.Contains(conn.raw, "DROP TABLE"))
+	test.Equal(t, "args", []interface{}{
+		"it's 100%'; DROP TABLE cards; --",
+		`%it's 100\%'; DROP TABLE cards; --%`,
+	}, conn.args)
+}
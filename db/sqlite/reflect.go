@@ -0,0 +1,207 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+type Query struct {
+	table   string
+	columns []string
+	addrs   []interface{}
+}
+
+type QueryType string
+
+const (
+	Select QueryType = "SELECT"
+	Insert           = "INSERT"
+	Update           = "UPDATED"
+)
+
+func QueryFromRecord(r primitives.Record, t QueryType, ignored ...string) (*Query, error) {
+	rv := reflect.ValueOf(r)
+	if rv.Kind() != reflect.Ptr {
+		return nil, errors.Errorf("cannot get database fields for record %v", r)
+	}
+
+	q := &Query{
+		table: r.Type() + "s",
+	}
+
+	rv = rv.Elem()
+	rt := reflect.TypeOf(rv.Interface())
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("db")
+
+		if tag == "" || contains(ignored, tag) {
+			continue
+		}
+
+		field := rv.Field(i)
+		addr := field.Addr().Interface()
+
+		// Scan null strings as empty strings
+		if t == Select && field.Kind() == reflect.String {
+			tag = fmt.Sprintf("COALESCE(%s, '') as %s", tag, tag)
+		}
+
+		if field.Kind() == reflect.Slice {
+			switch e := field.Type().Elem(); e.Kind() {
+			case reflect.String, reflect.Int:
+				addr = &jsonArray{addr}
+			case reflect.Uint8: // []byte
+			default:
+				return nil, errors.Errorf("slice type %v not supported", e)
+			}
+		}
+
+		q.addrs = append(q.addrs, addr)
+		q.columns = append(q.columns, tag)
+	}
+
+	return q, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, i := range l {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Query) Table() string {
+	return q.table
+}
+
+func (q *Query) Placeholders() string {
+	v := make([]string, len(q.columns))
+	for i := range v {
+		v[i] = "?"
+	}
+
+	return strings.Join(v, ", ")
+}
+
+func (q *Query) Columns() string {
+	return strings.Join(q.columns, ", ")
+}
+
+// Assignments returns the columns as a SET list, as SQLite doesn't support
+// row value assignments
+func (q *Query) Assignments() string {
+	v := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		v[i] = c + " = ?"
+	}
+
+	return strings.Join(v, ", ")
+}
+
+type Scannable interface {
+	Scan(...interface{}) error
+}
+
+func (q *Query) Scan(row Scannable) error {
+	err := row.Scan(q.addrs...)
+	if err != nil {
+		return errors.Wrap(err, "failed to scan records")
+	}
+
+	return nil
+}
+
+// jsonArray stores slice fields as JSON arrays, as SQLite has no array type
+type jsonArray struct {
+	v interface{}
+}
+
+func (a *jsonArray) Value() (driver.Value, error) {
+	b, err := json.Marshal(a.v)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(b) == "null" {
+		return "[]", nil
+	}
+
+	return string(b), nil
+}
+
+func (a *jsonArray) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.Errorf("cannot scan %T into array", src)
+	}
+
+	return json.Unmarshal(b, a.v)
+}
+
+func where(cond primitives.Query) string {
+	where := cond.Where()
+
+	var clause []string
+	for k, v := range where {
+		switch t := v.(type) {
+		case string:
+			clause = append(clause, fmt.Sprintf("%s = '%s'", k, strings.Replace(t, "'", "''", -1)))
+		case int, primitives.ID:
+			clause = append(clause, fmt.Sprintf("%s = %d", k, v))
+		case db.GreaterOrEqual:
+			val := t.Time.Format("2006-01-02")
+			clause = append(clause, fmt.Sprintf("julianday(%s) >= julianday('%s')", k, val))
+		case db.LessOrEqual:
+			val := t.Time.Format("2006-01-02")
+			clause = append(clause, fmt.Sprintf("julianday(%s) <= julianday('%s')", k, val))
+		case bool:
+			val := 0
+			if t {
+				val = 1
+			}
+			clause = append(clause, fmt.Sprintf("%s = %d", k, val))
+		default:
+			err := fmt.Sprintf("invalid type %q for where clause", t)
+			panic(err)
+		}
+	}
+
+	var q string
+
+	if len(clause) >= 1 {
+		q = "WHERE " + strings.Join(clause, " AND ")
+	}
+
+	sortBy := cond.SortBy()
+
+	if len(sortBy) == 0 {
+		return q
+	}
+
+	var sort []string
+
+	for k, v := range sortBy {
+		sort = append(sort, fmt.Sprintf("%s %s", k, v))
+	}
+
+	return q + " ORDER BY " + strings.Join(sort, ", ")
+}
@@ -0,0 +1,324 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const version = 1
+
+type Database struct {
+	*sql.DB
+
+	// tx is set on the copies bound to a transaction
+	tx *sql.Tx
+}
+
+// New opens the SQLite database file at path, creating it when missing, and
+// runs the migrations
+func New(path string) (*Database, error) {
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=1"
+	} else {
+		dsn += "?_foreign_keys=1"
+	}
+
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer at a time
+	conn.SetMaxOpenConns(1)
+
+	for _, q := range tableQueries {
+		_, err = conn.Exec(q)
+
+		// ALTER TABLE ADD COLUMN has no IF NOT EXISTS clause
+		if err != nil && strings.Contains(err.Error(), "duplicate column name") {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := &Database{DB: conn}
+
+	err = createCardSchedules(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create card schedules")
+	}
+
+	return db, nil
+}
+
+// Transaction runs fn with a copy of the database bound to a transaction,
+// committed when fn succeeds. Nested transactions run in the outer one.
+func (db *Database) Transaction(ctx context.Context, fn func(primitives.Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	err = fn(&Database{DB: db.DB, tx: tx})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// the single connection is held by the transaction, so the copies bound to it
+// must not query outside of it
+func (db *Database) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(ctx, query, args...)
+	}
+
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *Database) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, query, args...)
+	}
+
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *Database) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *Database) Create(ctx context.Context, r primitives.Record) error {
+	now := time.Now()
+
+	r.SetCreatedAt(now)
+	r.SetUpdatedAt(now)
+	r.SetVersion(version)
+
+	q, err := QueryFromRecord(r, Insert, "id")
+	if err != nil {
+		return errors.Wrapf(err, "failed to get record fields %v", r)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", q.Table(), q.Columns(),
+		q.Placeholders())
+
+	res, err := db.exec(ctx, query, q.addrs...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create db record %q", query)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return errors.Wrapf(err, "failed to get db record id %q", query)
+	}
+
+	r.SetID(primitives.ID(id))
+
+	return nil
+}
+
+func (db *Database) Update(ctx context.Context, r primitives.Record) error {
+	now := time.Now()
+
+	r.SetUpdatedAt(now)
+
+	q, err := QueryFromRecord(r, Update, "id")
+	if err != nil {
+		return errors.Wrapf(err, "failed to get record fields %v", r)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = %d;", q.Table(), q.Assignments(), r.ID())
+
+	_, err = db.exec(ctx, query, q.addrs...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update db record %q", query)
+	}
+
+	return nil
+}
+
+func (db *Database) Delete(ctx context.Context, r primitives.Record) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %d;", r.Type()+"s", r.ID())
+
+	_, err := db.exec(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete db record %q", query)
+	}
+
+	return nil
+}
+
+func (db *Database) Query(ctx context.Context, wq primitives.Query) ([]primitives.Record, error) {
+	q, err := QueryFromRecord(wq.NewRecord(), Select)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get record fields %v", wq)
+	}
+
+	raw := fmt.Sprintf("SELECT %s FROM %s %s;", q.Columns(), q.Table(), where(wq))
+
+	return db.queryRows(ctx, wq, raw)
+}
+
+func (db *Database) Get(ctx context.Context, wq primitives.Query) (primitives.Record, error) {
+	r := wq.NewRecord()
+
+	q, err := QueryFromRecord(r, Select)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get record fields %v", wq)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s %s LIMIT 1;", q.Columns(), q.Table(), where(wq))
+
+	row := db.queryRow(ctx, query)
+
+	err = q.Scan(row)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to scan record %q", query)
+	}
+
+	return r, nil
+}
+
+// QueryRaw runs the SQLite version of the raw queries, as they are written in
+// the PostgreSQL dialect. The args are bound by the SQLite version itself.
+func (db *Database) QueryRaw(ctx context.Context, wq primitives.Query,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	var records []primitives.Record
+
+	err := db.Transaction(ctx, func(tx primitives.Database) error {
+		var err error
+		records, err = queryRaw(ctx, tx.(*Database), wq)
+		return err
+	})
+
+	return records, err
+}
+
+func (db *Database) Count(ctx context.Context, wq primitives.Query) (int, error) {
+	table := wq.NewRecord().Type() + "s"
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s %s;", table, where(wq))
+
+	row := db.queryRow(ctx, query)
+
+	var n int
+
+	err := row.Scan(&n)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to count records %q", query)
+	}
+
+	return n, nil
+}
+
+func (db *Database) Random(ctx context.Context, wq primitives.Query, n int) ([]primitives.Record, error) {
+	r := wq.NewRecord()
+	q, err := QueryFromRecord(r, Select)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get record fields %v", wq)
+	}
+
+	raw := fmt.Sprintf(`SELECT %s FROM %s WHERE id IN (SELECT id FROM %s %s ORDER BY RANDOM() LIMIT %d)`,
+		q.Columns(), q.Table(), q.Table(), where(wq), n)
+
+	return db.queryRows(ctx, wq, raw)
+}
+
+func (db *Database) queryRows(ctx context.Context, wq primitives.Query,
+	query string, args ...interface{}) ([]primitives.Record, error) {
+
+	rows, err := db.query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query records %q", query)
+	}
+	defer rows.Close()
+
+	var records []primitives.Record
+
+	for rows.Next() {
+
+		r := wq.NewRecord()
+
+		q, err := QueryFromRecord(r, Select)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get record fields %q", query)
+		}
+
+		err = q.Scan(rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to scan records %q", query)
+		}
+
+		records = append(records, r)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query records %q", query)
+	}
+
+	return records, nil
+}
+
+func queryRaw(ctx context.Context, conn *Database, wq primitives.Query) ([]primitives.Record, error) {
+	sq, ok := wq.(db.SQLiteQuery)
+	if !ok {
+		return nil, errors.Errorf("raw query not supported %q", wq.Raw())
+	}
+
+	return sq.SQLite(ctx, statements{conn})
+}
+
+// statements runs the statements of the SQLite queries
+type statements struct {
+	db *Database
+}
+
+func (s statements) Select(ctx context.Context, q primitives.Query, query string,
+	args ...interface{}) ([]primitives.Record, error) {
+
+	return s.db.queryRows(ctx, q, query, args...)
+}
+
+func (s statements) Exec(ctx context.Context, query string, args ...interface{}) (int, error) {
+	res, err := s.db.exec(ctx, query, args...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to exec %q", query)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to count rows changed %q", query)
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestDatabase(t *testing.T) {
+	conn, err := New(":memory:")
+	test.OK(t, err)
+
+	ctx := context.Background()
+
+	defer conn.Close()
+
+	user := &primitives.User{Name: "Jane", Email: "jane@example.com", PasswordHash: "hash"}
+	test.OK(t, conn.Create(ctx, user))
+
+	deck := &primitives.Deck{UserID: user.ID(), Name: "Animals", Fields: []string{"English", "Portuguese"}}
+	test.OK(t, conn.Create(ctx, deck))
+
+	t.Run("arrays", func(t *testing.T) {
+		found, err := db.FindDeck(ctx, conn, deck.ID())
+		test.OK(t, err)
+		test.Equal(t, "deck fields", deck.Fields, found.Fields)
+
+		deck.Fields = []string{"English"}
+		test.OK(t, conn.Update(ctx, deck))
+
+		found, err = db.FindDeck(ctx, conn, deck.ID())
+		test.OK(t, err)
+		test.Equal(t, "updated deck fields", []string{"English"}, found.Fields)
+	})
+
+	t.Run("dates", func(t *testing.T) {
+		card := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"cat"}, ImageURL: "cat.png"}
+		test.OK(t, conn.Create(ctx, card))
+
+		yesterday := time.Now().UTC().AddDate(0, 0, -1)
+		tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+
+		for _, d := range []time.Time{yesterday, tomorrow} {
+			schedule := &primitives.CardSchedule{DeckID: deck.ID(), CardID: card.ID(), NextDate: d}
+			test.OK(t, conn.Create(ctx, schedule))
+		}
+
+		n, err := db.CountCardsScheduled(ctx, conn, deck.ID())
+		test.OK(t, err)
+		test.Equal(t, "cards scheduled", 1, n)
+
+		next, err := db.FindNextCardScheduled(ctx, conn, deck.ID(), false)
+		test.OK(t, err)
+		test.Equal(t, "next card", card.ID(), next.ID())
+	})
+
+	t.Run("raw queries", func(t *testing.T) {
+		cat := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"black cat", "gato"}, ImageURL: "cat.png"}
+		dog := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"dog", "cão"}, ImageURL: "dog.png", Caption: "100% good"}
+
+		for _, c := range []*primitives.Card{cat, dog} {
+			test.OK(t, conn.Create(ctx, c))
+		}
+
+		tag := &primitives.Tag{DeckID: deck.ID(), Name: "pets"}
+		test.OK(t, conn.Create(ctx, tag))
+		test.OK(t, conn.Create(ctx, &primitives.CardTag{CardID: dog.ID(), TagID: tag.ID()}))
+
+		testCases := []struct {
+			query string
+			want  []primitives.ID
+		}{
+			{"BLACK", []primitives.ID{cat.ID()}},
+			{"gato black", []primitives.ID{cat.ID()}},
+			{"cão", []primitives.ID{dog.ID()}},
+			{"100%", []primitives.ID{dog.ID()}},
+			{"10_", nil},
+			{"cat dog", nil},
+		}
+
+		for _, tc := range testCases {
+			cards, err := db.SearchCards(ctx, conn, user.ID(), tc.query, db.SearchFilters{})
+			test.OK(t, err)
+
+			var got []primitives.ID
+			for _, c := range cards {
+				got = append(got, c.ID())
+			}
+
+			test.Equal(t, "search "+tc.query, tc.want, got)
+		}
+
+		cards, err := db.FindCardsByTag(ctx, conn, tag.ID())
+		test.OK(t, err)
+		test.Equal(t, "tagged cards", 1, len(cards))
+		test.Equal(t, "tagged card caption", dog.Caption, cards[0].Caption)
+
+		tags, err := db.FindTagsByCard(ctx, conn, dog.ID())
+		test.OK(t, err)
+		test.Equal(t, "card tags", 1, len(tags))
+		test.Equal(t, "card tag", "pets", tags[0].Name)
+
+		locked, err := db.LockDeck(ctx, conn, deck.ID())
+		test.OK(t, err)
+		test.Equal(t, "locked deck", deck.Name, locked.Name)
+		test.Equal(t, "locked deck fields", deck.Fields, locked.Fields)
+	})
+}
+
+func TestWhere(t *testing.T) {
+	q := &query{
+		where: map[string]interface{}{
+			"next_date": db.LessOrEqual{Time: time.Date(2018, time.September, 2, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	test.Equal(t, "where clause", "WHERE julianday(next_date) <= julianday('2018-09-02')", where(q))
+
+	q = &query{
+		where: map[string]interface{}{
+			"name": "it's",
+		},
+	}
+
+	test.Equal(t, "where clause", "WHERE name = 'it''s'", where(q))
+}
+
+type query struct {
+	where map[string]interface{}
+}
+
+func (q *query) NewRecord() primitives.Record {
+	return &primitives.Card{}
+}
+
+func (q *query) Where() map[string]interface{} {
+	return q.where
+}
+
+func (q *query) Raw() string {
+	return ""
+}
+
+func (q *query) SortBy() map[string]string {
+	return nil
+}
@@ -0,0 +1,174 @@
+package sqlite
+
+// tableQueries mirrors the psql migrations. TEXT[] columns are stored as JSON
+// arrays and the full-text search indexes are left out, as search is
+// evaluated outside the database.
+var tableQueries = []string{
+	`
+		CREATE TABLE IF NOT EXISTS users(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			name TEXT NOT NULL CHECK(name <> ''),
+			email TEXT NOT NULL UNIQUE CHECK(email <> ''),
+			password_hash TEXT NOT NULL CHECK(password_hash <> ''),
+			image_url TEXT
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS sessions(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS decks(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+			name TEXT NOT NULL CHECK(name <> ''),
+			description TEXT,
+			image_url TEXT,
+			fields TEXT NOT NULL CHECK (fields <> '[]')
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS cards(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			deck_id INTEGER NOT NULL REFERENCES decks ON DELETE CASCADE,
+			definitions TEXT NOT NULL CHECK (definitions <> '[]'),
+			image_url TEXT NOT NULL CHECK(image_url <> ''),
+			sound_url TEXT
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS tags(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			deck_id INTEGER NOT NULL REFERENCES decks ON DELETE CASCADE,
+			name TEXT NOT NULL CHECK(name <> ''),
+			UNIQUE (deck_id, name)
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS card_tags(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			card_id INTEGER NOT NULL REFERENCES cards ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags ON DELETE CASCADE,
+			UNIQUE (card_id, tag_id)
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS jobs(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			name TEXT NOT NULL CHECK(name <> ''),
+			state TEXT NOT NULL CHECK(state <> ''),
+			args BLOB,
+			error TEXT,
+			tries INTEGER NOT NULL DEFAULT 0
+		);
+		`,
+
+	` ALTER TABLE cards ADD COLUMN caption TEXT;`,
+	`
+		CREATE TABLE IF NOT EXISTS card_schedules(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			next_date TIMESTAMP NOT NULL,
+			deck_id INTEGER NOT NULL REFERENCES decks ON DELETE CASCADE,
+			card_id INTEGER NOT NULL REFERENCES cards ON DELETE CASCADE,
+			current_score INTEGER NOT NULL DEFAULT 0,
+			max_score INTEGER NOT NULL DEFAULT 0
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS card_reviews(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			deck_id INTEGER NOT NULL REFERENCES decks ON DELETE CASCADE,
+			card_id INTEGER NOT NULL REFERENCES cards ON DELETE CASCADE,
+			answer TEXT NOT NULL,
+			skipped BOOLEAN NOT NULL DEFAULT false,
+			correct BOOLEAN NOT NULL DEFAULT false
+		);
+		`,
+	`ALTER TABLE decks ADD COLUMN primary_field INTEGER DEFAULT 0;`,
+	`ALTER TABLE cards ADD COLUMN nsfw BOOLEAN NOT NULL DEFAULT false;`,
+
+	`ALTER TABLE jobs ADD COLUMN lease_until TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';`,
+	`CREATE INDEX IF NOT EXISTS jobs_state_run_at_idx ON jobs (state, run_at);`,
+	`ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;`,
+	`ALTER TABLE jobs ADD COLUMN unique_key TEXT NOT NULL DEFAULT '';`,
+	`
+		CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON jobs (unique_key)
+		WHERE unique_key <> '' AND state IN ('scheduled', 'retry');
+		`,
+	`CREATE INDEX IF NOT EXISTS jobs_state_updated_at_idx ON jobs (state, updated_at);`,
+	`
+		CREATE TABLE IF NOT EXISTS archived_jobs(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			name TEXT NOT NULL,
+			state TEXT NOT NULL,
+			args BLOB,
+			error TEXT,
+			tries INTEGER NOT NULL DEFAULT 0,
+			lease_until TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+			unique_key TEXT NOT NULL DEFAULT ''
+		);
+		`,
+	`
+		CREATE TABLE IF NOT EXISTS record_changes(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			record_type TEXT NOT NULL CHECK(record_type <> ''),
+			record_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+			action TEXT NOT NULL CHECK(action <> ''),
+			changes BLOB NOT NULL
+		);
+		`,
+	`
+		CREATE INDEX IF NOT EXISTS record_changes_record_idx
+		ON record_changes (record_type, record_id);
+		`,
+	`ALTER TABLE cards ADD COLUMN image_source_url TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE cards ADD COLUMN image_unreachable BOOLEAN NOT NULL DEFAULT false;`,
+	`ALTER TABLE cards ADD COLUMN image_variants TEXT NOT NULL DEFAULT '[]';`,
+	`ALTER TABLE decks ADD COLUMN image_variants TEXT NOT NULL DEFAULT '[]';`,
+	`ALTER TABLE users ADD COLUMN image_variants TEXT NOT NULL DEFAULT '[]';`,
+	`ALTER TABLE decks ADD COLUMN speech_field INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE decks ADD COLUMN speech_language TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE card_reviews ADD COLUMN mode TEXT NOT NULL DEFAULT '';`,
+	`CREATE INDEX IF NOT EXISTS card_reviews_deck_mode_idx ON card_reviews (deck_id, mode);`,
+	`ALTER TABLE decks ADD COLUMN field_types TEXT NOT NULL DEFAULT '[]';`,
+	`ALTER TABLE decks ADD COLUMN field_schema BLOB;`,
+	`ALTER TABLE cards ADD COLUMN sound_generated BOOLEAN NOT NULL DEFAULT false;`,
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// Transaction runs fn in a transaction of the database, failing when the
+// database has no transactions
+func Transaction(ctx context.Context, conn primitives.Database,
+	fn func(primitives.Database) error) error {
+
+	t, ok := conn.(primitives.Transactor)
+	if !ok {
+		return errors.Errorf("database %T has no transactions", conn)
+	}
+
+	return t.Transaction(ctx, fn)
+}
+
+// Transaction runs fn in a transaction of the wrapped database, auditing the
+// changes made by fn
+func (a *Auditor) Transaction(ctx context.Context, fn func(primitives.Database) error) error {
+	return Transaction(ctx, a.Database, func(tx primitives.Database) error {
+		return fn(Audit(tx, a.UserID))
+	})
+}
@@ -7,7 +7,9 @@ require (
 	github.com/aws/aws-sdk-go v1.14.8
 	github.com/lib/pq v0.0.0-20180523175426-90697d60dd84
 	github.com/localvar/zhuyin v0.0.0-20170317003422-798c045f11ec // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/pkg/errors v0.8.0
 	github.com/speps/go-hashids v0.0.0-20180515110130-d5e694adcaa72
 	golang.org/x/crypto v0.0.0-20180614221331-a8fb68e7206f
+	golang.org/x/image v0.0.0-20180708004352-c73c2afc3b81
 )
@@ -16,6 +16,17 @@ type Card struct {
 	SoundURL    string   `db:"sound_url"`
 	Caption     string   `db:"caption"`
 	NSFW        bool     `db:"nsfw"`
+
+	// ImageSourceURL is the original image URL when it was mirrored into the
+	// blob store, ImageUnreachable flags sources that couldn't be fetched
+	ImageSourceURL   string `db:"image_source_url"`
+	ImageUnreachable bool   `db:"image_unreachable"`
+
+	ImageVariants []string `db:"image_variants"`
+
+	// SoundGenerated flags sounds synthesized from the deck speech field, which
+	// are generated again when the field changes
+	SoundGenerated bool `db:"sound_generated"`
 }
 
 func (c Card) ID() ID {
@@ -49,3 +60,11 @@ func (c *Card) GetImageURL() string {
 func (c *Card) SetImageURL(url string) {
 	c.ImageURL = url
 }
+
+func (c *Card) GetImageVariant(name string) string {
+	return ImageVariant(c.ImageVariants, name)
+}
+
+func (c *Card) SetImageVariant(name, url string) {
+	c.ImageVariants = SetImageVariant(c.ImageVariants, name, url)
+}
@@ -15,6 +15,46 @@ type CardReview struct {
 	Answer  string `db:"answer"`
 	Skipped bool   `db:"skipped"`
 	Correct bool   `db:"correct"`
+
+	// Mode is the prompt of the review, reviews created before the modes were
+	// recorded have none
+	Mode string `db:"mode"`
+}
+
+// review modes, the prompt shown to the user
+const (
+	ImageReview     = "image"
+	TextReview      = "text"
+	ListeningReview = "listening"
+)
+
+// ValidReviewMode returns whether the review mode is known
+func ValidReviewMode(mode string) bool {
+	switch mode {
+	case ImageReview, TextReview, ListeningReview:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check sets whether the answer is one of the answers accepted for the field,
+// or for any field when it is out of range
+func (c *CardReview) Check(answers [][]string, field int) {
+	c.Correct = false
+
+	for i, as := range answers {
+		if field >= 0 && field < len(answers) && i != field {
+			continue
+		}
+
+		for _, a := range as {
+			if a == c.Answer {
+				c.Correct = true
+				return
+			}
+		}
+	}
 }
 
 func (c CardReview) ID() ID {
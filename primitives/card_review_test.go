@@ -0,0 +1,43 @@
+package primitives
+
+import (
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestCardReview_Check(t *testing.T) {
+	answers := [][]string{{"cat"}, {"gato"}, {"ねこ", "neko"}}
+
+	tcs := []struct {
+		scenario string
+		answer   string
+		field    int
+		correct  bool
+	}{
+		{"any field", "gato", -1, true},
+		{"any field wrong", "cão", -1, false},
+		{"chosen field", "gato", 1, true},
+		{"other field", "cat", 1, false},
+		{"transliteration", "neko", 2, true},
+		{"field out of range", "neko", 3, true},
+		{"skipped", "", 0, false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			review := &CardReview{Answer: tc.answer, Correct: !tc.correct}
+			review.Check(answers, tc.field)
+
+			test.Equal(t, "correct", tc.correct, review.Correct)
+		})
+	}
+}
+
+func TestValidReviewMode(t *testing.T) {
+	test.Equal(t, "image", true, ValidReviewMode(ImageReview))
+	test.Equal(t, "text", true, ValidReviewMode(TextReview))
+	test.Equal(t, "listening", true, ValidReviewMode(ListeningReview))
+	test.Equal(t, "unknown", false, ValidReviewMode("video"))
+	test.Equal(t, "empty", false, ValidReviewMode(""))
+}
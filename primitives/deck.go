@@ -16,6 +16,19 @@ type Deck struct {
 	ImageURL     string   `db:"image_url"`
 	Fields       []string `db:"fields"`
 	PrimaryField int      `db:"primary_field"`
+
+	ImageVariants []string `db:"image_variants"`
+
+	// SpeechLanguage enables the pronunciation audio of the SpeechField
+	// definitions, eg "en" or "zh"
+	SpeechField    int    `db:"speech_field"`
+	SpeechLanguage string `db:"speech_language"`
+
+	// FieldTypes are the transliteration types of the Fields, eg "pinyin"
+	FieldTypes []string `db:"field_types"`
+
+	// FieldSchema is the JSON encoded schema of the Fields, see Schema
+	FieldSchema []byte `db:"field_schema"`
 }
 
 func (d Deck) ID() ID {
@@ -42,6 +55,16 @@ func (d *Deck) SetUpdatedAt(t time.Time) {
 	d.MetaUpdatedAt = t
 }
 
+// FieldType returns the type of the field, empty for decks without field
+// types
+func (d Deck) FieldType(i int) string {
+	if i < 0 || i >= len(d.FieldTypes) {
+		return ""
+	}
+
+	return d.FieldTypes[i]
+}
+
 func (d *Deck) GetImageURL() string {
 	return d.ImageURL
 }
@@ -49,3 +72,11 @@ func (d *Deck) GetImageURL() string {
 func (d *Deck) SetImageURL(url string) {
 	d.ImageURL = url
 }
+
+func (d *Deck) GetImageVariant(name string) string {
+	return ImageVariant(d.ImageVariants, name)
+}
+
+func (d *Deck) SetImageVariant(name, url string) {
+	d.ImageVariants = SetImageVariant(d.ImageVariants, name, url)
+}
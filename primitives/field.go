@@ -0,0 +1,237 @@
+package primitives
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// field kinds, how the card definitions are entered and rendered
+const (
+	TextField  = "text"
+	AudioField = "audio"
+	ImageField = "image"
+	ClozeField = "cloze"
+)
+
+// FieldKinds lists the field kinds in the order they are offered
+var FieldKinds = []string{TextField, AudioField, ImageField, ClozeField}
+
+// clozeDeletion matches the hidden parts of cloze definitions, eg
+// "the {{cat}} sat" or "the {{c1::cat}} sat"
+var clozeDeletion = regexp.MustCompile(`\{\{(?:c\d+::)?([^{}]+)\}\}`)
+
+// Field is the schema of a deck field
+type Field struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Language string `json:"language,omitempty"`
+	Required bool   `json:"required"`
+
+	// Front fields are shown along the card image when reviewing, Back fields
+	// along the review result
+	Front bool `json:"front"`
+	Back  bool `json:"back"`
+
+	// Transliteration is the transliteration type of the definitions, eg
+	// "pinyin"
+	Transliteration string `json:"transliteration,omitempty"`
+}
+
+// Validate checks the field schema
+func (f Field) Validate() error {
+	if strings.TrimSpace(f.Name) == "" {
+		return errors.New("field name cannot be empty")
+	}
+
+	for _, k := range FieldKinds {
+		if f.Kind == k {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid field %q kind %q", f.Name, f.Kind)
+}
+
+// ValidateDefinition checks a card definition of the field
+func (f Field) ValidateDefinition(d string) error {
+	if d == "" {
+		if f.Required {
+			return fmt.Errorf("field %q cannot be empty", f.Name)
+		}
+
+		return nil
+	}
+
+	switch f.Kind {
+	case TextField, ClozeField:
+		if strings.ContainsAny(d, "\r\n") {
+			return fmt.Errorf("field %q must be a single line", f.Name)
+		}
+	case AudioField, ImageField:
+		if !strings.HasPrefix(d, "http://") && !strings.HasPrefix(d, "https://") &&
+			!strings.HasPrefix(d, "/") {
+			return fmt.Errorf("field %q must be a URL", f.Name)
+		}
+	}
+
+	if f.Kind == ClozeField && !clozeDeletion.MatchString(d) {
+		return fmt.Errorf("field %q must hide a part with {{ }}", f.Name)
+	}
+
+	return nil
+}
+
+// ClozeQuestion replaces the hidden parts of the cloze definition with [...]
+func ClozeQuestion(d string) string {
+	return clozeDeletion.ReplaceAllString(d, "[...]")
+}
+
+// ClozeText shows the hidden parts of the cloze definition
+func ClozeText(d string) string {
+	return clozeDeletion.ReplaceAllString(d, "$1")
+}
+
+// ClozeAnswers returns the hidden parts of the cloze definition
+func ClozeAnswers(d string) []string {
+	var answers []string
+
+	for _, m := range clozeDeletion.FindAllStringSubmatch(d, -1) {
+		answers = append(answers, m[1])
+	}
+
+	return answers
+}
+
+// Schema returns the deck fields schema, decks created before the schemas
+// have required text fields shown after the review
+func (d Deck) Schema() ([]Field, error) {
+	if len(d.FieldSchema) == 0 {
+		fields := make([]Field, len(d.Fields))
+
+		for i, name := range d.Fields {
+			fields[i] = Field{
+				Name:            name,
+				Kind:            TextField,
+				Required:        true,
+				Back:            true,
+				Transliteration: d.FieldType(i),
+			}
+		}
+
+		return fields, nil
+	}
+
+	var fields []Field
+
+	err := json.Unmarshal(d.FieldSchema, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deck %d field schema: %v", d.ID(), err)
+	}
+
+	if len(fields) != len(d.Fields) {
+		return nil, fmt.Errorf("deck %d field schema has %d fields instead of %d",
+			d.ID(), len(fields), len(d.Fields))
+	}
+
+	return fields, nil
+}
+
+// SetSchema validates and stores the fields schema, updating the field names
+// and types
+func (d *Deck) SetSchema(fields []Field) error {
+	if len(fields) == 0 {
+		return errors.New("deck fields cannot be empty")
+	}
+
+	names := make([]string, len(fields))
+	types := make([]string, len(fields))
+
+	for i, f := range fields {
+		err := f.Validate()
+		if err != nil {
+			return err
+		}
+
+		names[i] = f.Name
+		types[i] = f.Transliteration
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal field schema: %v", err)
+	}
+
+	d.FieldSchema = b
+	d.Fields = names
+	d.FieldTypes = types
+
+	return nil
+}
+
+// FieldMigration changes the deck fields, moving the card definitions along
+type FieldMigration struct {
+	Fields []Field
+
+	// Sources are the previous index of each field, -1 for the added fields
+	// whose definitions are set to their Defaults
+	Sources  []int
+	Defaults []string
+}
+
+// Index returns the index of the previous field after the migration, -1 when
+// it is removed
+func (m FieldMigration) Index(prev int) int {
+	for i, src := range m.Sources {
+		if src == prev {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Definitions returns the card definitions after the migration
+func (m FieldMigration) Definitions(prev []string) []string {
+	definitions := make([]string, len(m.Sources))
+
+	for i, src := range m.Sources {
+		switch {
+		case src < 0 && i < len(m.Defaults):
+			definitions[i] = m.Defaults[i]
+		case src >= 0 && src < len(prev):
+			definitions[i] = prev[src]
+		}
+	}
+
+	return definitions
+}
+
+// Apply sets the deck schema, keeping the primary and speech fields on the
+// same fields. The primary field falls back to the first one and the speech is
+// disabled when their fields are removed.
+func (m FieldMigration) Apply(d *Deck) error {
+	if len(m.Sources) != len(m.Fields) {
+		return fmt.Errorf("field migration has %d sources for %d fields", len(m.Sources), len(m.Fields))
+	}
+
+	err := d.SetSchema(m.Fields)
+	if err != nil {
+		return err
+	}
+
+	d.PrimaryField = m.Index(d.PrimaryField)
+	if d.PrimaryField < 0 {
+		d.PrimaryField = 0
+	}
+
+	d.SpeechField = m.Index(d.SpeechField)
+	if d.SpeechField < 0 {
+		d.SpeechField = 0
+		d.SpeechLanguage = ""
+	}
+
+	return nil
+}
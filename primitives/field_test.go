@@ -0,0 +1,160 @@
+package primitives
+
+import (
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestField_ValidateDefinition(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		field    Field
+		value    string
+		err      bool
+	}{
+		{"text", Field{Kind: TextField}, "cat", false},
+		{"text multiple lines", Field{Kind: TextField}, "cat\ndog", true},
+		{"required empty", Field{Kind: TextField, Required: true}, "", true},
+		{"optional empty", Field{Kind: ImageField}, "", false},
+		{"audio url", Field{Kind: AudioField}, "https://example.com/cat.mp3", false},
+		{"audio blob", Field{Kind: AudioField}, "/blobs/cat.mp3", false},
+		{"image not url", Field{Kind: ImageField}, "cat.png", true},
+		{"cloze", Field{Kind: ClozeField}, "the {{cat}} sat", false},
+		{"cloze numbered", Field{Kind: ClozeField}, "the {{c1::cat}} sat", false},
+		{"cloze without answer", Field{Kind: ClozeField}, "the cat sat", true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			err := tc.field.ValidateDefinition(tc.value)
+			if tc.err {
+				test.Error(t, err)
+			} else {
+				test.OK(t, err)
+			}
+		})
+	}
+}
+
+func TestCloze(t *testing.T) {
+	d := "the {{c1::cat}} sat on the {{mat}}"
+
+	test.Equal(t, "question", "the [...] sat on the [...]", ClozeQuestion(d))
+	test.Equal(t, "text", "the cat sat on the mat", ClozeText(d))
+	test.Equal(t, "answers", []string{"cat", "mat"}, ClozeAnswers(d))
+}
+
+func TestDeck_Schema(t *testing.T) {
+	t.Run("deck without schema", func(t *testing.T) {
+		d := Deck{Fields: []string{"English", "Pinyin"}}
+
+		schema, err := d.Schema()
+		test.OK(t, err)
+		test.Equal(t, "schema", []Field{
+			{Name: "English", Kind: TextField, Required: true, Back: true},
+			{Name: "Pinyin", Kind: TextField, Required: true, Back: true},
+		}, schema)
+	})
+
+	t.Run("deck with field types", func(t *testing.T) {
+		d := Deck{Fields: []string{"English", "Pronunciation"}, FieldTypes: []string{"", "pinyin"}}
+
+		schema, err := d.Schema()
+		test.OK(t, err)
+		test.Equal(t, "schema", []Field{
+			{Name: "English", Kind: TextField, Required: true, Back: true},
+			{Name: "Pronunciation", Kind: TextField, Required: true, Back: true, Transliteration: "pinyin"},
+		}, schema)
+	})
+
+	t.Run("set schema", func(t *testing.T) {
+		d := Deck{Fields: []string{"English"}}
+
+		fields := []Field{
+			{Name: "Sentence", Kind: ClozeField, Language: "zh", Front: true},
+			{Name: "Pinyin", Kind: TextField, Back: true, Transliteration: "pinyin"},
+		}
+
+		err := d.SetSchema(fields)
+		test.OK(t, err)
+		test.Equal(t, "field names", []string{"Sentence", "Pinyin"}, d.Fields)
+		test.Equal(t, "field types", []string{"", "pinyin"}, d.FieldTypes)
+
+		schema, err := d.Schema()
+		test.OK(t, err)
+		test.Equal(t, "schema", fields, schema)
+	})
+
+	t.Run("invalid kind", func(t *testing.T) {
+		d := Deck{}
+
+		err := d.SetSchema([]Field{{Name: "English", Kind: "video"}})
+		test.Error(t, err)
+	})
+
+	t.Run("fields out of sync", func(t *testing.T) {
+		d := Deck{}
+
+		err := d.SetSchema([]Field{{Name: "English", Kind: TextField}})
+		test.OK(t, err)
+
+		d.Fields = append(d.Fields, "Portuguese")
+
+		_, err = d.Schema()
+		test.Error(t, err)
+	})
+}
+
+func TestFieldMigration(t *testing.T) {
+	m := FieldMigration{
+		Fields: []Field{
+			{Name: "Pinyin", Kind: TextField, Back: true},
+			{Name: "Notes", Kind: TextField, Back: true},
+			{Name: "Hanzi", Kind: TextField, Back: true},
+		},
+		Sources:  []int{2, -1, 0},
+		Defaults: []string{"", "none", ""},
+	}
+
+	t.Run("definitions", func(t *testing.T) {
+		got := m.Definitions([]string{"猫", "cat", "māo"})
+		test.Equal(t, "definitions", []string{"māo", "none", "猫"}, got)
+	})
+
+	tcs := []struct {
+		scenario string
+		deck     Deck
+		primary  int
+		speech   int
+		language string
+	}{
+		{
+			scenario: "moved fields",
+			deck:     Deck{Fields: []string{"Hanzi", "English", "Pinyin"}, PrimaryField: 0, SpeechField: 2, SpeechLanguage: "zh"},
+			primary:  2,
+			speech:   0,
+			language: "zh",
+		},
+		{
+			scenario: "removed fields",
+			deck:     Deck{Fields: []string{"Hanzi", "English", "Pinyin"}, PrimaryField: 1, SpeechField: 1, SpeechLanguage: "en"},
+			primary:  0,
+			speech:   0,
+			language: "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			deck := tc.deck
+
+			err := m.Apply(&deck)
+			test.OK(t, err)
+			test.Equal(t, "fields", []string{"Pinyin", "Notes", "Hanzi"}, deck.Fields)
+			test.Equal(t, "primary field", tc.primary, deck.PrimaryField)
+			test.Equal(t, "speech field", tc.speech, deck.SpeechField)
+			test.Equal(t, "speech language", tc.language, deck.SpeechLanguage)
+		})
+	}
+}
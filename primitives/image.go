@@ -0,0 +1,31 @@
+package primitives
+
+import "strings"
+
+// image variants are stored as "name url" pairs, so every record with images
+// keeps them in a single array column
+
+// ImageVariant returns the URL of the named variant, or an empty string
+func ImageVariant(variants []string, name string) string {
+	for _, v := range variants {
+		if strings.HasPrefix(v, name+" ") {
+			return v[len(name)+1:]
+		}
+	}
+
+	return ""
+}
+
+// SetImageVariant replaces the URL of the named variant
+func SetImageVariant(variants []string, name, url string) []string {
+	entry := name + " " + url
+
+	for i, v := range variants {
+		if strings.HasPrefix(v, name+" ") {
+			variants[i] = entry
+			return variants
+		}
+	}
+
+	return append(variants, entry)
+}
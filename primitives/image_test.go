@@ -0,0 +1,20 @@
+package primitives
+
+import (
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestSetImageVariant(t *testing.T) {
+	var vs []string
+
+	vs = SetImageVariant(vs, "thumb", "/blobs/cards/AB34-thumb.png")
+	vs = SetImageVariant(vs, "review", "/blobs/cards/AB34-review.png")
+	vs = SetImageVariant(vs, "thumb", "/blobs/cards/CD56-thumb.png")
+
+	test.Equal(t, "variants", 2, len(vs))
+	test.Equal(t, "thumb", "/blobs/cards/CD56-thumb.png", ImageVariant(vs, "thumb"))
+	test.Equal(t, "review", "/blobs/cards/AB34-review.png", ImageVariant(vs, "review"))
+	test.Equal(t, "missing", "", ImageVariant(vs, "full"))
+}
@@ -2,6 +2,8 @@ package primitives
 
 import (
 	"context"
+	"errors"
+	"io"
 	"strconv"
 	"time"
 )
@@ -17,14 +19,35 @@ type Identifiable interface {
 	Type() string
 }
 
+// Database stores the records. The raw queries are bound to the args given to
+// QueryRaw, referenced as $1, $2 and so on.
 type Database interface {
-	Create(Record) error
-	Update(Record) error
-	Query(Query) ([]Record, error)
-	QueryRaw(Query) ([]Record, error)
-	Get(Query) (Record, error)
-	Count(Query) (int, error)
-	Random(Query, int) ([]Record, error)
+	Create(context.Context, Record) error
+	Update(context.Context, Record) error
+	Delete(context.Context, Record) error
+	Query(context.Context, Query) ([]Record, error)
+	QueryRaw(context.Context, Query, ...interface{}) ([]Record, error)
+	Get(context.Context, Query) (Record, error)
+	Count(context.Context, Query) (int, error)
+	Random(context.Context, Query, int) ([]Record, error)
+}
+
+// Transactor is implemented by the databases running functions in a
+// transaction, the database given to fn being bound to it. The transaction is
+// rolled back when fn returns an error.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(Database) error) error
+}
+
+// ErrBlobNotFound is the cause of the errors returned by BlobStore.Get for
+// missing keys
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
 }
 
 type Record interface {
@@ -50,7 +73,9 @@ type Authenticator interface {
 
 type WorkerPool interface {
 	Register(string, Worker) error
-	Enqueue(string, interface{}) error
+	Enqueue(context.Context, string, interface{}) error
+	EnqueueAt(context.Context, string, interface{}, time.Time) error
+	EnqueueIn(context.Context, string, interface{}, time.Duration) error
 }
 
 type Worker interface {
@@ -0,0 +1,70 @@
+package primitives
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type RecordChange struct {
+	MetaID        ID        `db:"id"`
+	MetaVersion   int       `db:"version"`
+	MetaCreatedAt time.Time `db:"created_at"`
+	MetaUpdatedAt time.Time `db:"updated_at"`
+
+	RecordType string `db:"record_type"`
+	RecordID   ID     `db:"record_id"`
+	UserID     ID     `db:"user_id"`
+	Action     string `db:"action"`
+	Changes    []byte `db:"changes"`
+}
+
+// FieldChange holds the JSON encoded values of a record field before and
+// after a change
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+func (c RecordChange) ID() ID {
+	return c.MetaID
+}
+
+func (c RecordChange) Type() string {
+	return "record_change"
+}
+
+func (c RecordChange) Slug() string {
+	return "change"
+}
+
+func (c *RecordChange) SetID(id ID) {
+	c.MetaID = id
+}
+
+func (c *RecordChange) SetVersion(v int) {
+	c.MetaVersion = v
+}
+
+func (c *RecordChange) SetCreatedAt(t time.Time) {
+	c.MetaCreatedAt = t
+}
+
+func (c *RecordChange) SetUpdatedAt(t time.Time) {
+	c.MetaUpdatedAt = t
+}
+
+// Fields returns the changed fields by their db column name
+func (c RecordChange) Fields() (map[string]FieldChange, error) {
+	fields := make(map[string]FieldChange)
+
+	if len(c.Changes) == 0 {
+		return fields, nil
+	}
+
+	err := json.Unmarshal(c.Changes, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
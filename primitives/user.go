@@ -12,6 +12,9 @@ type User struct {
 	Name         string `db:"name"`
 	PasswordHash string `db:"password_hash"`
 	ImageURL     string `db:"image_url"`
+	Admin        bool   `db:"admin"`
+
+	ImageVariants []string `db:"image_variants"`
 }
 
 func (u User) ID() ID {
@@ -37,3 +40,19 @@ func (u *User) SetCreatedAt(t time.Time) {
 func (u *User) SetUpdatedAt(t time.Time) {
 	u.MetaUpdatedAt = t
 }
+
+func (u *User) GetImageURL() string {
+	return u.ImageURL
+}
+
+func (u *User) SetImageURL(url string) {
+	u.ImageURL = url
+}
+
+func (u *User) GetImageVariant(name string) string {
+	return ImageVariant(u.ImageVariants, name)
+}
+
+func (u *User) SetImageVariant(name, url string) {
+	u.ImageVariants = SetImageVariant(u.ImageVariants, name, url)
+}
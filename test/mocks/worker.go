@@ -1,7 +1,9 @@
 package mocks
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 )
@@ -9,6 +11,8 @@ import (
 type WorkerPool struct {
 	RegisterFunc func(string, primitives.Worker) error
 	EnqueueFunc  func(string, interface{}) error
+
+	EnqueueAtFunc func(string, interface{}, time.Time) error
 }
 
 func (p *WorkerPool) Register(name string, worker primitives.Worker) error {
@@ -19,10 +23,22 @@ func (p *WorkerPool) Register(name string, worker primitives.Worker) error {
 	return p.RegisterFunc(name, worker)
 }
 
-func (p *WorkerPool) Enqueue(name string, v interface{}) error {
+func (p *WorkerPool) Enqueue(ctx context.Context, name string, v interface{}) error {
 	if p.EnqueueFunc == nil {
 		return errors.New("EnqueueFunc not implemented")
 	}
 
 	return p.EnqueueFunc(name, v)
 }
+
+func (p *WorkerPool) EnqueueAt(ctx context.Context, name string, v interface{}, t time.Time) error {
+	if p.EnqueueAtFunc == nil {
+		return errors.New("EnqueueAtFunc not implemented")
+	}
+
+	return p.EnqueueAtFunc(name, v, t)
+}
+
+func (p *WorkerPool) EnqueueIn(ctx context.Context, name string, v interface{}, d time.Duration) error {
+	return p.EnqueueAt(ctx, name, v, time.Now().Add(d))
+}
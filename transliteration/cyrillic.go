@@ -0,0 +1,38 @@
+package transliteration
+
+import (
+	"strings"
+	"unicode"
+)
+
+// cyrillicLatin transliterates the Russian letters following BGN/PCGN, along
+// with the letters specific to Ukrainian
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "\"", 'ы': "y", 'ь': "'", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// Cyrillic transliterates Cyrillic into Latin, eg "Москва" into "Moskva"
+func Cyrillic(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		l, ok := cyrillicLatin[unicode.ToLower(r)]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		if unicode.IsUpper(r) {
+			l = strings.ToUpper(l[:1]) + l[1:]
+		}
+
+		b.WriteString(l)
+	}
+
+	return b.String()
+}
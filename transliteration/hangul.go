@@ -0,0 +1,105 @@
+package transliteration
+
+import "strings"
+
+// Revised Romanization of the initial, medial and final jamo of the hangul
+// syllables, in the Unicode order
+var (
+	hangulInitials = []string{
+		"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h",
+	}
+
+	hangulMedials = []string{
+		"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae",
+		"oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i",
+	}
+
+	hangulFinals = []string{
+		"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l",
+		"p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t",
+	}
+
+	// hangulLinkedFinals are the finals read as the initial of the next
+	// syllable starting with a silent ㅇ, eg 한국어 hangugeo
+	hangulLinkedFinals = []string{
+		"", "g", "kk", "ks", "n", "nj", "n", "d", "r", "lg", "lm", "lb", "ls", "lt",
+		"lp", "r", "m", "b", "ps", "s", "ss", "ng", "j", "ch", "k", "t", "p", "",
+	}
+)
+
+const (
+	hangulBase    = 0xAC00
+	hangulLast    = 0xD7A3
+	hangulSilent  = 11 // ㅇ initial
+	hangulRieul   = 5  // ㄹ initial
+	hangulLRieul  = 8  // ㄹ final
+	hangulMedialN = 21
+	hangulFinalN  = 28
+)
+
+type hangulSyllable struct {
+	initial, medial, final int
+}
+
+func decomposeHangul(r rune) (hangulSyllable, bool) {
+	if r < hangulBase || r > hangulLast {
+		return hangulSyllable{}, false
+	}
+
+	n := int(r - hangulBase)
+
+	return hangulSyllable{
+		initial: n / (hangulMedialN * hangulFinalN),
+		medial:  n % (hangulMedialN * hangulFinalN) / hangulFinalN,
+		final:   n % hangulFinalN,
+	}, true
+}
+
+// Hangul romanizes hangul with the Revised Romanization, linking the finals
+// to the following silent initials but without the other sound changes
+func Hangul(s string) string {
+	rs := []rune(s)
+
+	var b strings.Builder
+
+	for i, r := range rs {
+		syl, ok := decomposeHangul(r)
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		var next hangulSyllable
+		hasNext := false
+
+		if i+1 < len(rs) {
+			next, hasNext = decomposeHangul(rs[i+1])
+		}
+
+		var prev hangulSyllable
+		hasPrev := false
+
+		if i > 0 {
+			prev, hasPrev = decomposeHangul(rs[i-1])
+		}
+
+		switch {
+		case hasPrev && prev.final != 0 && syl.initial == hangulSilent:
+			// the previous final was read as this initial
+		case hasPrev && prev.final == hangulLRieul && syl.initial == hangulRieul:
+			b.WriteString("l")
+		default:
+			b.WriteString(hangulInitials[syl.initial])
+		}
+
+		b.WriteString(hangulMedials[syl.medial])
+
+		if hasNext && next.initial == hangulSilent {
+			b.WriteString(hangulLinkedFinals[syl.final])
+		} else {
+			b.WriteString(hangulFinals[syl.final])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,211 @@
+package transliteration
+
+import (
+	"strings"
+	"unicode"
+)
+
+// hiragana lists the kana with their Hepburn romanization, the first kana of
+// a romanization is the one written back
+var hiragana = []struct {
+	kana   string
+	romaji string
+}{
+	{"あ", "a"}, {"い", "i"}, {"う", "u"}, {"え", "e"}, {"お", "o"},
+	{"か", "ka"}, {"き", "ki"}, {"く", "ku"}, {"け", "ke"}, {"こ", "ko"},
+	{"が", "ga"}, {"ぎ", "gi"}, {"ぐ", "gu"}, {"げ", "ge"}, {"ご", "go"},
+	{"さ", "sa"}, {"し", "shi"}, {"す", "su"}, {"せ", "se"}, {"そ", "so"},
+	{"ざ", "za"}, {"じ", "ji"}, {"ず", "zu"}, {"ぜ", "ze"}, {"ぞ", "zo"},
+	{"た", "ta"}, {"ち", "chi"}, {"つ", "tsu"}, {"て", "te"}, {"と", "to"},
+	{"だ", "da"}, {"ぢ", "ji"}, {"づ", "zu"}, {"で", "de"}, {"ど", "do"},
+	{"な", "na"}, {"に", "ni"}, {"ぬ", "nu"}, {"ね", "ne"}, {"の", "no"},
+	{"は", "ha"}, {"ひ", "hi"}, {"ふ", "fu"}, {"へ", "he"}, {"ほ", "ho"},
+	{"ば", "ba"}, {"び", "bi"}, {"ぶ", "bu"}, {"べ", "be"}, {"ぼ", "bo"},
+	{"ぱ", "pa"}, {"ぴ", "pi"}, {"ぷ", "pu"}, {"ぺ", "pe"}, {"ぽ", "po"},
+	{"ま", "ma"}, {"み", "mi"}, {"む", "mu"}, {"め", "me"}, {"も", "mo"},
+	{"や", "ya"}, {"ゆ", "yu"}, {"よ", "yo"},
+	{"ら", "ra"}, {"り", "ri"}, {"る", "ru"}, {"れ", "re"}, {"ろ", "ro"},
+	{"わ", "wa"}, {"を", "o"}, {"ん", "n"}, {"ゔ", "vu"},
+	{"ぁ", "a"}, {"ぃ", "i"}, {"ぅ", "u"}, {"ぇ", "e"}, {"ぉ", "o"},
+}
+
+var (
+	kanaRomaji = make(map[string]string)
+	romajiKana = make(map[string]string)
+)
+
+func init() {
+	for _, h := range hiragana {
+		kanaRomaji[h.kana] = h.romaji
+
+		if _, ok := romajiKana[h.romaji]; !ok {
+			romajiKana[h.romaji] = h.kana
+		}
+	}
+
+	// the i column followed by a small ya, yu or yo, eg きゃ kya and しゃ sha
+	for _, h := range hiragana {
+		if len(h.romaji) < 2 || !strings.HasSuffix(h.romaji, "i") || h.kana == "い" {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(h.romaji, "i")
+		if prefix != "sh" && prefix != "ch" && prefix != "j" {
+			prefix += "y"
+		}
+
+		for small, vowel := range map[string]string{"ゃ": "a", "ゅ": "u", "ょ": "o"} {
+			kanaRomaji[h.kana+small] = prefix + vowel
+
+			if _, ok := romajiKana[prefix+vowel]; !ok {
+				romajiKana[prefix+vowel] = h.kana + small
+			}
+		}
+	}
+
+	// Kunrei-shiki spellings are read as well
+	for r, k := range map[string]string{
+		"si": "し", "ti": "ち", "tu": "つ", "hu": "ふ", "zi": "じ", "wo": "を",
+		"sya": "しゃ", "syu": "しゅ", "syo": "しょ",
+		"tya": "ちゃ", "tyu": "ちゅ", "tyo": "ちょ",
+		"zya": "じゃ", "zyu": "じゅ", "zyo": "じょ",
+	} {
+		romajiKana[r] = k
+	}
+}
+
+// toHiragana converts the katakana into hiragana, both blocks having the same
+// layout
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - 'ァ' + 'ぁ'
+	}
+
+	return r
+}
+
+// KanaToRomaji converts hiragana and katakana into Hepburn romaji, eg "ねこ"
+// into "neko"
+func KanaToRomaji(s string) string {
+	rs := []rune(s)
+	for i, r := range rs {
+		rs[i] = toHiragana(r)
+	}
+
+	var b strings.Builder
+
+	double := false
+
+	for i := 0; i < len(rs); i++ {
+		r, ok := "", false
+
+		if i+1 < len(rs) {
+			r, ok = kanaRomaji[string(rs[i:i+2])]
+			if ok {
+				i++
+			}
+		}
+
+		if !ok {
+			r, ok = kanaRomaji[string(rs[i])]
+		}
+
+		switch {
+		case rs[i] == 'っ':
+			double = true
+			continue
+		case rs[i] == 'ー':
+			r = lastVowel(b.String())
+		case !ok:
+			r = string(rs[i])
+		}
+
+		// the small tsu doubles the next consonant, ch into tch
+		if double && r != "" && !strings.ContainsAny(r[:1], "aiueon") {
+			if strings.HasPrefix(r, "ch") {
+				b.WriteByte('t')
+			} else {
+				b.WriteByte(r[0])
+			}
+		}
+
+		double = false
+
+		// n is apostrophized before a vowel or y, eg "ten'in"
+		if rs[i] == 'ん' && i+1 < len(rs) {
+			next := kanaRomaji[string(toHiragana(rs[i+1]))]
+			if next != "" && strings.ContainsAny(next[:1], "aiueoy") {
+				r = "n'"
+			}
+		}
+
+		b.WriteString(r)
+	}
+
+	return b.String()
+}
+
+func lastVowel(s string) string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if strings.IndexByte("aiueo", s[i]) >= 0 {
+			return s[i : i+1]
+		}
+	}
+
+	return ""
+}
+
+// RomajiToKana converts Hepburn romaji into hiragana, eg "neko" into "ねこ"
+func RomajiToKana(s string) string {
+	rs := []rune(strings.ToLower(s))
+
+	var b strings.Builder
+
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		// doubled consonants, eg "kk" and "tch", are written with a small tsu
+		if i+1 < len(rs) && isConsonant(r) && r != 'n' &&
+			(rs[i+1] == r || (r == 't' && rs[i+1] == 'c')) {
+			b.WriteRune('っ')
+			continue
+		}
+
+		matched := false
+
+		for n := 3; n > 0 && !matched; n-- {
+			if i+n > len(rs) {
+				continue
+			}
+
+			k, ok := romajiKana[string(rs[i:i+n])]
+			if !ok {
+				continue
+			}
+
+			// n is a syllable of its own unless a vowel or y follows
+			if n == 1 && r == 'n' && i+1 < len(rs) && strings.ContainsRune("aiueoy", rs[i+1]) {
+				continue
+			}
+
+			b.WriteString(k)
+			i += n - 1
+			matched = true
+		}
+
+		if !matched {
+			// the apostrophe only separates n from the next syllable
+			if r == '\'' && i > 0 && rs[i-1] == 'n' {
+				continue
+			}
+
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func isConsonant(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsLetter(r) && !strings.ContainsRune("aiueo", r)
+}
@@ -0,0 +1,177 @@
+package transliteration
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/localvar/zhuyin"
+)
+
+// toneMarks are the vowels with the marks of the tones 1 to 4
+var toneMarks = map[rune][4]rune{
+	'a': {'ā', 'á', 'ǎ', 'à'},
+	'e': {'ē', 'é', 'ě', 'è'},
+	'i': {'ī', 'í', 'ǐ', 'ì'},
+	'o': {'ō', 'ó', 'ǒ', 'ò'},
+	'u': {'ū', 'ú', 'ǔ', 'ù'},
+	'ü': {'ǖ', 'ǘ', 'ǚ', 'ǜ'},
+	'A': {'Ā', 'Á', 'Ǎ', 'À'},
+	'E': {'Ē', 'É', 'Ě', 'È'},
+	'I': {'Ī', 'Í', 'Ǐ', 'Ì'},
+	'O': {'Ō', 'Ó', 'Ǒ', 'Ò'},
+	'U': {'Ū', 'Ú', 'Ǔ', 'Ù'},
+	'Ü': {'Ǖ', 'Ǘ', 'Ǚ', 'Ǜ'},
+}
+
+type toned struct {
+	vowel rune
+	tone  int
+}
+
+// markedVowels maps the marked vowels back to the plain vowel and tone
+var markedVowels = func() map[rune]toned {
+	m := make(map[rune]toned)
+
+	for v, marks := range toneMarks {
+		for i, mark := range marks {
+			m[mark] = toned{vowel: v, tone: i + 1}
+		}
+	}
+
+	return m
+}()
+
+// numberedSyllable matches the syllables written with tone numbers, ü being
+// also written as v or u:
+var numberedSyllable = regexp.MustCompile(`[A-Za-zÜü:]+?[1-5]`)
+
+// Zhuyin converts the space separated pinyin syllables into zhuyin
+func Zhuyin(s string) string {
+	var ps []string
+
+	for _, p := range strings.Split(s, " ") {
+		ps = append(ps, zhuyin.PinyinToZhuyin(p))
+	}
+
+	return strings.Join(ps, " ")
+}
+
+// PinyinToneMarks converts pinyin written with tone numbers, eg "ni3hao3",
+// into tone marks, eg "nǐhǎo"
+func PinyinToneMarks(s string) string {
+	return numberedSyllable.ReplaceAllStringFunc(s, markSyllable)
+}
+
+func markSyllable(syllable string) string {
+	tone := int(syllable[len(syllable)-1] - '0')
+
+	s := syllable[:len(syllable)-1]
+	s = strings.NewReplacer("u:", "ü", "U:", "Ü", "v", "ü", "V", "Ü").Replace(s)
+
+	rs := []rune(s)
+
+	i := markIndex(rs)
+	if i < 0 {
+		return syllable
+	}
+
+	// the fifth tone is neutral and unmarked
+	if tone < 5 {
+		rs[i] = toneMarks[rs[i]][tone-1]
+	}
+
+	return string(rs)
+}
+
+// markIndex returns the vowel carrying the tone mark, a and e take it first,
+// o in ou, otherwise the last vowel
+func markIndex(rs []rune) int {
+	last := -1
+
+	for i, r := range rs {
+		l := unicode.ToLower(r)
+
+		if l == 'a' || l == 'e' {
+			return i
+		}
+
+		if l == 'o' && i+1 < len(rs) && unicode.ToLower(rs[i+1]) == 'u' {
+			return i
+		}
+
+		if _, ok := toneMarks[r]; ok {
+			last = i
+		}
+	}
+
+	return last
+}
+
+// PinyinToneNumbers converts pinyin written with tone marks, eg "nǐhǎo",
+// into tone numbers, eg "ni3hao3". Unmarked syllables are left unnumbered.
+func PinyinToneNumbers(s string) string {
+	rs := []rune(s)
+	tones := make(map[int]int)
+
+	for i, r := range rs {
+		t, ok := markedVowels[r]
+		if !ok {
+			continue
+		}
+
+		rs[i] = t.vowel
+		tones[syllableEnd(rs, i)] = t.tone
+	}
+
+	var b strings.Builder
+
+	for i, r := range rs {
+		b.WriteRune(r)
+
+		if t, ok := tones[i+1]; ok {
+			b.WriteRune(rune('0' + t))
+		}
+	}
+
+	return b.String()
+}
+
+// syllableEnd returns the end of the syllable with the marked vowel at i,
+// including the following vowels and the n, ng or r finals not starting the
+// next syllable
+func syllableEnd(rs []rune, i int) int {
+	j := i + 1
+
+	for j < len(rs) && isPlainVowel(rs[j]) {
+		j++
+	}
+
+	final := func(f string) bool {
+		n := len(f)
+		if j+n > len(rs) || strings.ToLower(string(rs[j:j+n])) != f {
+			return false
+		}
+
+		return j+n == len(rs) || !isVowel(rs[j+n])
+	}
+
+	switch {
+	case final("ng"):
+		j += 2
+	case final("n"), final("r"):
+		j++
+	}
+
+	return j
+}
+
+func isPlainVowel(r rune) bool {
+	_, ok := toneMarks[r]
+	return ok
+}
+
+func isVowel(r rune) bool {
+	_, marked := markedVowels[r]
+	return marked || isPlainVowel(r)
+}
@@ -0,0 +1,124 @@
+// Package transliteration converts the card definitions of the deck field
+// types into other scripts and notations
+package transliteration
+
+import (
+	"sort"
+	"strings"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// Transliteration converts the text of a field type, Name being its display
+// name
+type Transliteration struct {
+	Name string
+	Func func(string) string
+}
+
+// Result is a transliterated text
+type Result struct {
+	Name string
+	Text string
+}
+
+// Registry maps the deck field types to their transliterations
+type Registry map[string][]Transliteration
+
+// Default is the registry used to render the cards and match the answers
+var Default = Registry{
+	"pinyin": {
+		{Name: "Zhuyin", Func: Zhuyin},
+		{Name: "Pinyin", Func: PinyinToneMarks},
+		{Name: "Pinyin tone numbers", Func: PinyinToneNumbers},
+	},
+	"kana":     {{Name: "Romaji", Func: KanaToRomaji}},
+	"romaji":   {{Name: "Kana", Func: RomajiToKana}},
+	"hangul":   {{Name: "Romanization", Func: Hangul}},
+	"cyrillic": {{Name: "Latin", Func: Cyrillic}},
+}
+
+// Types returns the registered field types sorted
+func (r Registry) Types() []string {
+	var types []string
+
+	for t := range r {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+// Transliterate returns the transliterations of the text in the field type,
+// leaving out the ones not changing it
+func (r Registry) Transliterate(fieldType, text string) []Result {
+	var results []Result
+
+	for _, t := range r[fieldType] {
+		s := t.Func(text)
+		if s == text || s == "" {
+			continue
+		}
+
+		results = append(results, Result{Name: t.Name, Text: s})
+	}
+
+	return results
+}
+
+// Schema returns the deck fields schema, the fields of decks without field
+// types named after a registered type, eg Pinyin, keep being transliterated
+func (r Registry) Schema(deck primitives.Deck) ([]primitives.Field, error) {
+	schema, err := deck.Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deck.FieldSchema) > 0 || len(deck.FieldTypes) > 0 {
+		return schema, nil
+	}
+
+	for i := range schema {
+		t := strings.ToLower(schema[i].Name)
+
+		if _, ok := r[t]; ok {
+			schema[i].Transliteration = t
+		}
+	}
+
+	return schema, nil
+}
+
+// Answers returns the answers accepted for each card definition, the
+// definition followed by its transliterations. The answer of cloze
+// definitions are their hidden parts.
+func (r Registry) Answers(deck primitives.Deck, card primitives.Card) ([][]string, error) {
+	schema, err := r.Schema(deck)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([][]string, len(card.Definitions))
+
+	for i, d := range card.Definitions {
+		if i >= len(schema) {
+			break
+		}
+
+		f := schema[i]
+
+		if f.Kind == primitives.ClozeField {
+			d = strings.Join(primitives.ClozeAnswers(d), " ")
+		}
+
+		answers[i] = []string{d}
+
+		for _, t := range r.Transliterate(f.Transliteration, d) {
+			answers[i] = append(answers[i], t.Text)
+		}
+	}
+
+	return answers, nil
+}
@@ -0,0 +1,128 @@
+package transliteration
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestConverters(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		fn       func(string) string
+		in       string
+		out      string
+	}{
+		{"tone marks", PinyinToneMarks, "ni3 hao3", "nǐ hǎo"},
+		{"tone marks joined syllables", PinyinToneMarks, "Zhong1guo2", "Zhōngguó"},
+		{"tone marks ou", PinyinToneMarks, "dou1", "dōu"},
+		{"tone marks last vowel", PinyinToneMarks, "liu2 gui4 xiong2", "liú guì xióng"},
+		{"tone marks ü", PinyinToneMarks, "nv3 lu:4", "nǚ lǜ"},
+		{"tone marks neutral tone", PinyinToneMarks, "xie4xie5", "xièxie"},
+		{"tone marks plain text", PinyinToneMarks, "ni hao", "ni hao"},
+		{"tone numbers", PinyinToneNumbers, "nǐ hǎo", "ni3 hao3"},
+		{"tone numbers joined syllables", PinyinToneNumbers, "Zhōngguó", "Zhong1guo2"},
+		{"tone numbers finals", PinyinToneNumbers, "Tiān'ānmén", "Tian1'an1men2"},
+		{"tone numbers next syllable", PinyinToneNumbers, "hǎoyǒu", "hao3you3"},
+		{"tone numbers ü", PinyinToneNumbers, "nǚ", "nü3"},
+		{"tone numbers neutral tone", PinyinToneNumbers, "xièxie", "xie4xie"},
+		{"hiragana", KanaToRomaji, "ねこ", "neko"},
+		{"katakana", KanaToRomaji, "カタカナ", "katakana"},
+		{"contracted sounds", KanaToRomaji, "きょうと", "kyouto"},
+		{"small tsu", KanaToRomaji, "がっこう", "gakkou"},
+		{"small tsu before ch", KanaToRomaji, "まっちゃ", "matcha"},
+		{"long vowel mark", KanaToRomaji, "コーヒー", "koohii"},
+		{"n before vowel", KanaToRomaji, "てんいん", "ten'in"},
+		{"mixed text", KanaToRomaji, "ねこ 1", "neko 1"},
+		{"romaji", RomajiToKana, "neko", "ねこ"},
+		{"romaji contracted sounds", RomajiToKana, "Kyouto", "きょうと"},
+		{"romaji doubled consonant", RomajiToKana, "gakkou", "がっこう"},
+		{"romaji tch", RomajiToKana, "matcha", "まっちゃ"},
+		{"romaji n", RomajiToKana, "shinbun", "しんぶん"},
+		{"romaji n apostrophe", RomajiToKana, "ten'in", "てんいん"},
+		{"romaji kunrei", RomajiToKana, "sushi tukue", "すし つくえ"},
+		{"hangul", Hangul, "서울", "seoul"},
+		{"hangul final", Hangul, "안녕하세요", "annyeonghaseyo"},
+		{"hangul linked final", Hangul, "한국어", "hangugeo"},
+		{"hangul double rieul", Hangul, "빨래", "ppallae"},
+		{"hangul words", Hangul, "밥 먹어", "bap meogeo"},
+		{"cyrillic", Cyrillic, "Москва", "Moskva"},
+		{"cyrillic digraphs", Cyrillic, "Щи и Юрий", "Shchi i Yuriy"},
+		{"cyrillic ukrainian letters", Cyrillic, "Україна", "Ukrayina"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			test.Equal(t, "converted", tc.out, tc.fn(tc.in))
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := Registry{
+		"upper": {
+			{Name: "Upper", Func: strings.ToUpper},
+			{Name: "Lower", Func: strings.ToLower},
+		},
+		"cyrillic": {{Name: "Latin", Func: Cyrillic}},
+	}
+
+	t.Run("types", func(t *testing.T) {
+		test.Equal(t, "types", []string{"cyrillic", "upper"}, r.Types())
+	})
+
+	t.Run("transliterate", func(t *testing.T) {
+		results := r.Transliterate("upper", "cat")
+		test.Equal(t, "results", []Result{{Name: "Upper", Text: "CAT"}}, results)
+
+		test.Equal(t, "unknown type", 0, len(r.Transliterate("kana", "cat")))
+	})
+
+	t.Run("answers", func(t *testing.T) {
+		deck := primitives.Deck{
+			Fields:     []string{"English", "Russian"},
+			FieldTypes: []string{"", "cyrillic"},
+		}
+
+		card := primitives.Card{Definitions: []string{"cat", "кот"}}
+
+		answers, err := r.Answers(deck, card)
+		test.OK(t, err)
+		test.Equal(t, "answers", [][]string{{"cat"}, {"кот", "kot"}}, answers)
+	})
+
+	t.Run("field named after type", func(t *testing.T) {
+		deck := primitives.Deck{Fields: []string{"English", "Cyrillic"}}
+		card := primitives.Card{Definitions: []string{"dog", "пёс"}}
+
+		answers, err := r.Answers(deck, card)
+		test.OK(t, err)
+		test.Equal(t, "answers", [][]string{{"dog"}, {"пёс", "pyos"}}, answers)
+	})
+
+	t.Run("schema of fields named after type", func(t *testing.T) {
+		deck := primitives.Deck{Fields: []string{"English", "Cyrillic"}}
+
+		schema, err := r.Schema(deck)
+		test.OK(t, err)
+		test.Equal(t, "english type", "", schema[0].Transliteration)
+		test.Equal(t, "cyrillic type", "cyrillic", schema[1].Transliteration)
+	})
+
+	t.Run("cloze field", func(t *testing.T) {
+		deck := primitives.Deck{}
+
+		err := deck.SetSchema([]primitives.Field{
+			{Name: "Sentence", Kind: primitives.ClozeField, Transliteration: "cyrillic"},
+		})
+		test.OK(t, err)
+
+		card := primitives.Card{Definitions: []string{"большой {{кот}} спит"}}
+
+		answers, err := r.Answers(deck, card)
+		test.OK(t, err)
+		test.Equal(t, "answers", [][]string{{"кот", "kot"}}, answers)
+	})
+}
@@ -23,4 +23,16 @@ document.addEventListener('DOMContentLoaded', function () {
     });
   }
 
+  // replay the audio element set by the "data-replay" attribute
+  var $replays = Array.prototype.slice.call(document.querySelectorAll('[data-replay]'), 0);
+
+  $replays.forEach(function ($el) {
+    $el.addEventListener('click', function () {
+      var $audio = document.getElementById($el.dataset.replay);
+
+      $audio.currentTime = 0;
+      $audio.play();
+    });
+  });
+
 });
@@ -2,9 +2,13 @@ package html
 
 import (
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/transliteration"
 )
 
 const CHECKED = "on"
@@ -14,6 +18,7 @@ func NewUserFromForm(form url.Values, auth primitives.Authenticator) (*primitive
 
 	u.Name = form.Get("name")
 	u.Email = form.Get("email")
+	u.ImageURL = form.Get("image_url")
 
 	password := form.Get("password")
 
@@ -72,20 +77,31 @@ func NewCardFromForm(deck primitives.Deck, form url.Values) (*primitives.Card, e
 	c.SoundURL = form.Get("sound_url")
 	c.Caption = form.Get("caption")
 
-	for _, f := range form["definitions"] {
-		if f != "" {
-			c.Definitions = append(c.Definitions, f)
-		}
-	}
-
 	if c.ImageURL == "" {
 		return nil, errors.New("card image cannot be empty")
 	}
 
-	if len(c.Definitions) != len(deck.Fields) {
+	schema, err := deck.Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := form["definitions"]
+	if len(definitions) != len(schema) {
 		return nil, errors.New("card definition numbers must be the same as deck field definitions")
 	}
 
+	for i, f := range schema {
+		d := strings.TrimSpace(definitions[i])
+
+		err := f.ValidateDefinition(d)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Definitions = append(c.Definitions, d)
+	}
+
 	if form.Get("nsfw") != "" {
 		c.NSFW = true
 	}
@@ -93,6 +109,181 @@ func NewCardFromForm(deck primitives.Deck, form url.Values) (*primitives.Card, e
 	return c, nil
 }
 
+// NewSchemaFromForm returns the deck fields schema with the settings of the
+// form, the fields listed in field_required, field_front and field_back by
+// their index are switched on
+func NewSchemaFromForm(deck primitives.Deck, form url.Values) ([]primitives.Field, error) {
+	fields, err := transliteration.Default.Schema(deck)
+	if err != nil {
+		return nil, err
+	}
+
+	values := func(key string) ([]string, error) {
+		vs, ok := form[key]
+		if ok && len(vs) != len(fields) {
+			return nil, errors.Errorf("invalid %s number", key)
+		}
+
+		return vs, nil
+	}
+
+	kinds, err := values("field_kinds")
+	if err != nil {
+		return nil, err
+	}
+
+	languages, err := values("field_languages")
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := values("field_types")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fields {
+		f := &fields[i]
+
+		if kinds != nil {
+			f.Kind = kinds[i]
+		}
+
+		if languages != nil {
+			f.Language = strings.TrimSpace(languages[i])
+		}
+
+		if types != nil {
+			f.Transliteration = types[i]
+		}
+
+		if _, ok := transliteration.Default[f.Transliteration]; f.Transliteration != "" && !ok {
+			return nil, errors.Errorf("invalid field %q transliteration %q", f.Name, f.Transliteration)
+		}
+
+		f.Required = checked(form["field_required"], i)
+		f.Front = checked(form["field_front"], i)
+		f.Back = checked(form["field_back"], i)
+	}
+
+	return fields, nil
+}
+
+// NewFieldMigrationFromForm returns the deck field changes of the form, a row
+// for each field with its previous index in field_sources, empty for the added
+// fields, its name, position and the default definition of the added fields.
+// The rows listed in field_removed by their index are dropped.
+func NewFieldMigrationFromForm(deck primitives.Deck, form url.Values) (
+	primitives.FieldMigration, error) {
+
+	m := primitives.FieldMigration{}
+
+	schema, err := transliteration.Default.Schema(deck)
+	if err != nil {
+		return m, err
+	}
+
+	sources := form["field_sources"]
+	names := form["field_names"]
+	positions := form["field_positions"]
+	defaults := form["field_defaults"]
+
+	if len(names) != len(sources) || len(positions) != len(sources) || len(defaults) != len(sources) {
+		return m, errors.New("invalid number of field settings")
+	}
+
+	type fieldRow struct {
+		position int
+		source   int
+		field    primitives.Field
+		def      string
+	}
+
+	var rows []fieldRow
+
+	seen := make(map[int]bool)
+
+	for i := range sources {
+		if checked(form["field_removed"], i) {
+			continue
+		}
+
+		row := fieldRow{source: -1}
+
+		if sources[i] != "" {
+			row.source, err = strconv.Atoi(sources[i])
+			if err != nil || row.source < 0 || row.source >= len(schema) || seen[row.source] {
+				return m, errors.Errorf("invalid field source %q", sources[i])
+			}
+
+			seen[row.source] = true
+		}
+
+		name := strings.TrimSpace(names[i])
+
+		// the blank rows left to add fields
+		if row.source < 0 && name == "" {
+			continue
+		}
+
+		row.position, err = strconv.Atoi(positions[i])
+		if err != nil {
+			return m, errors.Errorf("invalid field %q position %q", name, positions[i])
+		}
+
+		if row.source < 0 {
+			row.field = primitives.Field{Kind: primitives.TextField, Back: true}
+			row.def = strings.TrimSpace(defaults[i])
+		} else {
+			row.field = schema[row.source]
+		}
+
+		row.field.Name = name
+
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].position < rows[j].position
+	})
+
+	if len(rows) == 0 {
+		return m, errors.New("deck fields cannot be empty")
+	}
+
+	used := make(map[string]bool)
+
+	for _, r := range rows {
+		err := r.field.Validate()
+		if err != nil {
+			return m, err
+		}
+
+		if used[r.field.Name] {
+			return m, errors.Errorf("duplicate field name %q", r.field.Name)
+		}
+
+		used[r.field.Name] = true
+
+		m.Fields = append(m.Fields, r.field)
+		m.Sources = append(m.Sources, r.source)
+		m.Defaults = append(m.Defaults, r.def)
+	}
+
+	return m, nil
+}
+
+// checked returns whether the index is one of the checkbox values
+func checked(values []string, i int) bool {
+	for _, v := range values {
+		if v == strconv.Itoa(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func NewTagFromForm(deck primitives.Deck, form url.Values) (*primitives.Tag, error) {
 	t := &primitives.Tag{
 		DeckID: deck.ID(),
@@ -0,0 +1,144 @@
+package html
+
+import (
+	"net/url"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestNewCardFromForm(t *testing.T) {
+	deck := primitives.Deck{}
+
+	err := deck.SetSchema([]primitives.Field{
+		{Name: "Word", Kind: primitives.TextField, Required: true},
+		{Name: "Sentence", Kind: primitives.ClozeField},
+		{Name: "Audio", Kind: primitives.AudioField},
+	})
+	test.OK(t, err)
+
+	tcs := []struct {
+		scenario    string
+		definitions []string
+		err         bool
+	}{
+		{"all fields", []string{"cat", "the {{cat}} sat", "/blobs/cat.mp3"}, false},
+		{"optional fields empty", []string{" cat ", "", ""}, false},
+		{"required field empty", []string{"", "the {{cat}} sat", ""}, true},
+		{"missing definitions", []string{"cat"}, true},
+		{"invalid cloze", []string{"cat", "the cat sat", ""}, true},
+		{"invalid audio", []string{"cat", "", "cat.mp3"}, true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			form := url.Values{
+				"image_url":   {"/blobs/cat.png"},
+				"definitions": tc.definitions,
+			}
+
+			card, err := NewCardFromForm(deck, form)
+			if tc.err {
+				test.Error(t, err)
+				return
+			}
+
+			test.OK(t, err)
+			test.Equal(t, "definitions", 3, len(card.Definitions))
+			test.Equal(t, "word", "cat", card.Definitions[0])
+		})
+	}
+}
+
+func TestNewSchemaFromForm(t *testing.T) {
+	deck := primitives.Deck{Fields: []string{"Hanzi", "Pinyin"}}
+
+	t.Run("settings", func(t *testing.T) {
+		form := url.Values{
+			"field_kinds":     {"text", "text"},
+			"field_languages": {"zh", " "},
+			"field_types":     {"", "pinyin"},
+			"field_front":     {"0"},
+			"field_back":      {"0", "1"},
+			"field_required":  {"1"},
+		}
+
+		schema, err := NewSchemaFromForm(deck, form)
+		test.OK(t, err)
+		test.Equal(t, "schema", []primitives.Field{
+			{Name: "Hanzi", Kind: "text", Language: "zh", Front: true, Back: true},
+			{Name: "Pinyin", Kind: "text", Required: true, Back: true, Transliteration: "pinyin"},
+		}, schema)
+	})
+
+	t.Run("invalid transliteration", func(t *testing.T) {
+		form := url.Values{"field_types": {"", "klingon"}}
+
+		_, err := NewSchemaFromForm(deck, form)
+		test.Error(t, err)
+	})
+
+	t.Run("invalid number of settings", func(t *testing.T) {
+		form := url.Values{"field_kinds": {"text"}}
+
+		_, err := NewSchemaFromForm(deck, form)
+		test.Error(t, err)
+	})
+}
+
+func TestNewFieldMigrationFromForm(t *testing.T) {
+	deck := primitives.Deck{Fields: []string{"Hanzi", "English", "Pinyin"}}
+
+	t.Run("reordered", func(t *testing.T) {
+		form := url.Values{
+			"field_sources":   {"0", "1", "2", "", ""},
+			"field_names":     {"Hanzi", "English", "Pinyin", " Notes ", ""},
+			"field_positions": {"2", "3", "1", "4", "5"},
+			"field_defaults":  {"", "", "", " none ", ""},
+			"field_removed":   {"1"},
+		}
+
+		m, err := NewFieldMigrationFromForm(deck, form)
+		test.OK(t, err)
+		test.Equal(t, "sources", []int{2, 0, -1}, m.Sources)
+		test.Equal(t, "defaults", []string{"", "", "none"}, m.Defaults)
+		test.Equal(t, "field", primitives.Field{Name: "Notes", Kind: "text", Back: true}, m.Fields[2])
+	})
+
+	tcs := []struct {
+		scenario string
+		form     url.Values
+	}{
+		{"duplicated name", url.Values{
+			"field_sources":   {"0", "1", "2"},
+			"field_names":     {"Hanzi", "Hanzi", "Pinyin"},
+			"field_positions": {"1", "2", "3"},
+			"field_defaults":  {"", "", ""},
+		}},
+		{"duplicated source", url.Values{
+			"field_sources":   {"0", "0"},
+			"field_names":     {"Hanzi", "English"},
+			"field_positions": {"1", "2"},
+			"field_defaults":  {"", ""},
+		}},
+		{"all removed", url.Values{
+			"field_sources":   {"0"},
+			"field_names":     {"Hanzi"},
+			"field_positions": {"1"},
+			"field_defaults":  {""},
+			"field_removed":   {"0"},
+		}},
+		{"invalid number of settings", url.Values{
+			"field_sources": {"0", "1"},
+			"field_names":   {"Hanzi"},
+		}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			_, err := NewFieldMigrationFromForm(deck, tc.form)
+			test.Error(t, err)
+		})
+	}
+}
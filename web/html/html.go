@@ -6,10 +6,13 @@ import (
 	"io"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/transliteration"
 	"gitlab.com/luizbranco/cyberbrain/web"
 )
 
@@ -50,8 +53,16 @@ func (h *HTML) Render(w io.Writer, page web.Page) error {
 }
 
 var fns = template.FuncMap{
-	"contains": contains,
-	"first":    first,
+	"contains":   contains,
+	"first":      first,
+	"highlight":  highlight,
+	"fieldKinds": fieldKinds,
+	"fieldTypes": transliteration.Default.Types,
+}
+
+// fieldKinds returns the deck field kinds
+func fieldKinds() []string {
+	return primitives.FieldKinds
 }
 
 func (h *HTML) parse(names ...string) (tpl *template.Template, err error) {
@@ -98,6 +109,37 @@ func contains(list []string, item string) bool {
 	return false
 }
 
+// highlight escapes text and wraps every occurrence of the query terms with a
+// mark tag, ignoring case
+func highlight(text, query string) template.HTML {
+	var terms []string
+
+	for _, t := range strings.Fields(query) {
+		terms = append(terms, regexp.QuoteMeta(t))
+	}
+
+	if len(terms) == 0 {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	re := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+
+	var b strings.Builder
+	last := 0
+
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
 func piioScript(domain, appID string) func() template.HTML {
 	tag := `<script type="application/javascript">
   var piioData = {
@@ -120,15 +162,44 @@ func piioScript(domain, appID string) func() template.HTML {
 	}
 }
 
-func img(optimize bool) func(string) template.HTML {
-	tag := `<img src="%s" />`
+// img renders the image variant named by size, with its dimensions and the
+// other variants as its srcset, so browsers pick the best one for the screen.
+// Images not resized yet are rendered as they are.
+func img(optimize bool) func(Image, string) template.HTML {
+	const placeholder = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8+f9vPQAJZAN2rlRQVAAAAABJRU5ErkJggg=="
 
-	if optimize {
-		tag = `<img data-piio="%s"
-src="data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8+f9vPQAJZAN2rlRQVAAAAABJRU5ErkJggg==" />`
-	}
+	return func(image Image, size string) template.HTML {
+		src := image.URL
+
+		var attrs []string
+
+		if v, ok := image.Variant(size); ok {
+			src = v.URL
+
+			attrs = append(attrs, fmt.Sprintf(`width="%d" height="%d"`, v.Width, v.Height))
+
+			// Piio serves its own optimized sizes
+			if !optimize {
+				var srcset []string
+
+				for _, v := range image.Variants {
+					srcset = append(srcset, fmt.Sprintf("%s %dw", v.URL, v.Width))
+				}
+
+				attrs = append(attrs,
+					fmt.Sprintf(`srcset="%s"`, template.HTMLEscapeString(strings.Join(srcset, ", "))),
+					fmt.Sprintf(`sizes="(max-width: 768px) 100vw, %dpx"`, v.Width))
+			}
+		}
+
+		src = template.HTMLEscapeString(src)
+
+		if optimize {
+			attrs = append([]string{fmt.Sprintf(`data-piio="%s" src="%s"`, src, placeholder)}, attrs...)
+		} else {
+			attrs = append([]string{fmt.Sprintf(`src="%s"`, src)}, attrs...)
+		}
 
-	return func(imgURL string) template.HTML {
-		return template.HTML(fmt.Sprintf(tag, imgURL))
+		return template.HTML("<img " + strings.Join(attrs, " ") + " />")
 	}
 }
@@ -0,0 +1,118 @@
+package html
+
+import (
+	"html/template"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+func TestHighlight(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		text     string
+		query    string
+		html     template.HTML
+	}{
+		{
+			scenario: "empty query",
+			text:     "cat",
+			query:    "",
+			html:     "cat",
+		},
+		{
+			scenario: "case insensitive match",
+			text:     "Black Cat",
+			query:    "cat",
+			html:     "Black <mark>Cat</mark>",
+		},
+		{
+			scenario: "multiple terms",
+			text:     "black cat",
+			query:    "black cat",
+			html:     "<mark>black</mark> <mark>cat</mark>",
+		},
+		{
+			scenario: "cjk text",
+			text:     "我喜歡貓",
+			query:    "貓",
+			html:     "我喜歡<mark>貓</mark>",
+		},
+		{
+			scenario: "escaped text",
+			text:     "<b>cat</b>",
+			query:    "cat",
+			html:     "&lt;b&gt;<mark>cat</mark>&lt;/b&gt;",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			test.Equal(t, "highlighted text", tc.html, highlight(tc.text, tc.query))
+		})
+	}
+}
+
+func TestImg(t *testing.T) {
+	sizes := []worker.ImageSize{
+		{Name: worker.FullSize, Width: 800, Height: 600},
+		{Name: "thumb", Width: 200, Height: 150},
+		{Name: "review", Width: 640, Height: 480},
+		{Name: "2x", Width: 1600, Height: 1200},
+	}
+
+	resized := NewImage("/blobs/cards/AB34.png", []string{
+		"thumb /blobs/cards/AB34-thumb.png",
+		"review /blobs/cards/AB34-review.png",
+	}, sizes)
+
+	partial := NewImage("/blobs/cards/AB34.png", []string{
+		"thumb /blobs/cards/AB34-thumb.png",
+	}, sizes)
+
+	tcs := []struct {
+		scenario string
+		image    Image
+		size     string
+		optimize bool
+		html     template.HTML
+	}{
+		{
+			scenario: "not resized",
+			image:    NewImage(`http://example.com/cat.png?a=1&b="2"`, nil, sizes),
+			size:     "thumb",
+			html:     `<img src="http://example.com/cat.png?a=1&amp;b=&#34;2&#34;" />`,
+		},
+		{
+			scenario: "thumbnail",
+			image:    resized,
+			size:     "thumb",
+			html: `<img src="/blobs/cards/AB34-thumb.png" width="200" height="150" ` +
+				`srcset="/blobs/cards/AB34-thumb.png 200w, /blobs/cards/AB34-review.png 640w, /blobs/cards/AB34.png 800w" ` +
+				`sizes="(max-width: 768px) 100vw, 200px" />`,
+		},
+		{
+			scenario: "missing size",
+			image:    partial,
+			size:     "review",
+			html: `<img src="/blobs/cards/AB34.png" width="800" height="600" ` +
+				`srcset="/blobs/cards/AB34-thumb.png 200w, /blobs/cards/AB34.png 800w" ` +
+				`sizes="(max-width: 768px) 100vw, 800px" />`,
+		},
+		{
+			scenario: "optimized",
+			image:    resized,
+			size:     "review",
+			optimize: true,
+			html: `<img data-piio="/blobs/cards/AB34-review.png" src="data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8+f9vPQAJZAN2rlRQVAAAAABJRU5ErkJggg==" ` +
+				`width="640" height="480" />`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			test.Equal(t, "img tag", tc.html, img(tc.optimize)(tc.image, tc.size))
+		})
+	}
+}
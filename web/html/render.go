@@ -1,12 +1,19 @@
 package html
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/localvar/zhuyin"
 	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/transliteration"
 	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 type Deck struct {
@@ -15,16 +22,23 @@ type Deck struct {
 	Description    string
 	ImageURL       string
 	Fields         []string
+	Schema         []Field
 	PrimaryField   int
+	SpeechField    int
+	SpeechLanguage string
 	CardsScheduled int
+	Reviews        []ReviewCount
 	Tags           []*Tag
 	Cards          []*Card
 
 	Path              string
 	EditPath          string
+	HistoryPath       string
 	NewCardPath       string
 	NewTagPath        string
 	NewCardReviewPath string
+	SpeechPath        string
+	FieldsPath        string
 
 	CreateCardPath string
 	CreateTagPath  string
@@ -38,12 +52,193 @@ type Card struct {
 	Definitions []string
 	NSFW        bool
 
-	Path string
+	ImageSourceURL   string
+	ImageUnreachable bool
+
+	Image Image
+
+	Path        string
+	HistoryPath string
 
 	Deck *Deck
 	Tags []*Tag
 
-	Zhuyin string
+	Fields           []Field
+	Transliterations []Transliteration
+}
+
+// Field is a deck field schema with the card definition, if any
+type Field struct {
+	primitives.Field
+
+	Value string
+
+	// Text is the definition with the cloze answers shown and Question with
+	// them hidden
+	Text     string
+	Question string
+}
+
+// NewField returns the field with the definition value
+func NewField(f primitives.Field, value string) Field {
+	field := Field{Field: f, Value: value, Text: value, Question: value}
+
+	if f.Kind == primitives.ClozeField {
+		field.Text = primitives.ClozeText(value)
+		field.Question = primitives.ClozeQuestion(value)
+	}
+
+	return field
+}
+
+// Transliteration is a card definition in another script or notation
+type Transliteration struct {
+	Field string
+	Name  string
+	Text  string
+}
+
+// FieldRow is a deck field in the fields form, Source being its current index
+// or empty for the added fields
+type FieldRow struct {
+	Source   string
+	Name     string
+	Position int
+	Default  string
+}
+
+// NewFieldRows returns the form rows of the deck fields, in their order
+func NewFieldRows(fields []string) []FieldRow {
+	var rows []FieldRow
+
+	for i, name := range fields {
+		rows = append(rows, FieldRow{Source: strconv.Itoa(i), Name: name, Position: i + 1})
+	}
+
+	return rows
+}
+
+// NewMigrationRows returns the form rows of the field migration, so it can be
+// submitted again once previewed
+func NewMigrationRows(m primitives.FieldMigration) []FieldRow {
+	var rows []FieldRow
+
+	for i, f := range m.Fields {
+		row := FieldRow{Name: f.Name, Position: i + 1, Default: m.Defaults[i]}
+
+		if m.Sources[i] >= 0 {
+			row.Source = strconv.Itoa(m.Sources[i])
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// Image is a record image with its resized variants, sorted by width
+type Image struct {
+	URL      string
+	Variants []ImageVariant
+}
+
+type ImageVariant struct {
+	Name   string
+	URL    string
+	Width  int
+	Height int
+}
+
+// NewImage lists the image variants of each size already resized, the full
+// size being the image URL itself once the others exist
+func NewImage(url string, variants []string, sizes []worker.ImageSize) Image {
+	img := Image{URL: url}
+
+	if len(variants) == 0 {
+		return img
+	}
+
+	for _, s := range sizes {
+		v := ImageVariant{Name: s.Name, Width: s.Width, Height: s.Height}
+
+		if s.Name == worker.FullSize {
+			v.URL = url
+		} else {
+			v.URL = primitives.ImageVariant(variants, s.Name)
+		}
+
+		if v.URL != "" {
+			img.Variants = append(img.Variants, v)
+		}
+	}
+
+	sort.SliceStable(img.Variants, func(i, j int) bool {
+		return img.Variants[i].Width < img.Variants[j].Width
+	})
+
+	return img
+}
+
+// Variant returns the named variant, falling back to the full size
+func (i Image) Variant(name string) (ImageVariant, bool) {
+	var full ImageVariant
+	found := false
+
+	for _, v := range i.Variants {
+		if v.Name == name {
+			return v, true
+		}
+
+		if v.Name == worker.FullSize {
+			full = v
+			found = true
+		}
+	}
+
+	return full, found
+}
+
+type Change struct {
+	ID         string
+	Action     string
+	CreatedAt  time.Time
+	Fields     []*FieldChange
+	Revertible bool
+
+	RevertPath string
+}
+
+type FieldChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+type Job struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Args      string    `json:"args"`
+	UniqueKey string    `json:"unique_key"`
+	Tries     int       `json:"tries"`
+	Error     string    `json:"error"`
+	RunAt     time.Time `json:"run_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Retryable  bool `json:"retryable"`
+	Cancelable bool `json:"cancelable"`
+	Deletable  bool `json:"deletable"`
+
+	Path string `json:"path"`
+}
+
+// ReviewCount is the number of deck reviews in a mode and how many of them
+// were correct
+type ReviewCount struct {
+	Mode    string
+	Total   int
+	Correct int
 }
 
 type Tag struct {
@@ -65,6 +260,18 @@ func RenderDeck(ub web.URLBuilder, d primitives.Deck, cards []primitives.Card,
 		ImageURL:     d.ImageURL,
 		Fields:       d.Fields,
 		PrimaryField: d.PrimaryField,
+
+		SpeechField:    d.SpeechField,
+		SpeechLanguage: d.SpeechLanguage,
+	}
+
+	schema, err := transliteration.Default.Schema(d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render deck schema")
+	}
+
+	for _, f := range schema {
+		dr.Schema = append(dr.Schema, NewField(f, ""))
 	}
 
 	id, err := ub.EncodeID(d.ID())
@@ -81,6 +288,9 @@ func RenderDeck(ub web.URLBuilder, d primitives.Deck, cards []primitives.Card,
 
 	dr.Path = p
 	dr.EditPath = p + "/edit"
+	dr.HistoryPath = p + "/history"
+	dr.SpeechPath = p + "/speech"
+	dr.FieldsPath = p + "/fields"
 
 	cp, err := ub.Path("NEW", &primitives.Card{}, d)
 	if err != nil {
@@ -147,20 +357,33 @@ func RenderCard(ub web.URLBuilder, deck primitives.Deck, deckTags []primitives.T
 		Caption:     card.Caption,
 		Definitions: card.Definitions,
 		NSFW:        card.NSFW,
+
+		ImageSourceURL:   card.ImageSourceURL,
+		ImageUnreachable: card.ImageUnreachable,
+
+		Image: NewImage(card.ImageURL, card.ImageVariants, worker.CardImageSizes),
+	}
+
+	schema, err := transliteration.Default.Schema(deck)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render card schema")
 	}
 
-	// FIXME: temporary hack to display decks with Pinyin fields in Zhuyin as well
 	for i, d := range card.Definitions {
-		f := deck.Fields[i]
-		if strings.ToLower(f) == "pinyin" {
-			var ps []string
-			for _, p := range strings.Split(d, " ") {
-				ps = append(ps, zhuyin.PinyinToZhuyin(p))
-			}
-			cr.Zhuyin = strings.Join(ps, " ")
+		if i >= len(schema) {
 			break
 		}
 
+		f := NewField(schema[i], d)
+		cr.Fields = append(cr.Fields, f)
+
+		for _, t := range transliteration.Default.Transliterate(f.Transliteration, f.Text) {
+			cr.Transliterations = append(cr.Transliterations, Transliteration{
+				Field: f.Name,
+				Name:  t.Name,
+				Text:  t.Text,
+			})
+		}
 	}
 
 	id, err := ub.EncodeID(card.ID())
@@ -176,6 +399,7 @@ func RenderCard(ub web.URLBuilder, deck primitives.Deck, deckTags []primitives.T
 	}
 
 	cr.Path = p
+	cr.HistoryPath = p + "/history"
 
 	for _, t := range cardTags {
 		tr, err := RenderTag(ub, deck, t, nil, false)
@@ -237,3 +461,102 @@ func RenderTag(ub web.URLBuilder, d primitives.Deck, t primitives.Tag,
 
 	return tr, nil
 }
+
+func RenderChange(ub web.URLBuilder, d primitives.Deck, c primitives.RecordChange) (*Change, error) {
+	cr := &Change{
+		Action:     c.Action,
+		CreatedAt:  c.MetaCreatedAt,
+		Revertible: c.Action != db.ActionCreate,
+	}
+
+	id, err := ub.EncodeID(c.ID())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode change id")
+	}
+
+	cr.ID = id
+
+	p, err := ub.Path("SHOW", c, d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build change path")
+	}
+
+	cr.RevertPath = p
+
+	fields, err := c.Fields()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal change fields")
+	}
+
+	for name, f := range fields {
+		cr.Fields = append(cr.Fields, &FieldChange{
+			Name: name,
+			Old:  fieldValue(f.Old),
+			New:  fieldValue(f.New),
+		})
+	}
+
+	sort.Slice(cr.Fields, func(i, j int) bool {
+		return cr.Fields[i].Name < cr.Fields[j].Name
+	})
+
+	return cr, nil
+}
+
+func RenderJob(ub web.URLBuilder, j worker.Job) (*Job, error) {
+	jr := &Job{
+		Name:       j.Name,
+		State:      j.State,
+		Args:       string(j.Args),
+		UniqueKey:  j.UniqueKey,
+		Tries:      j.Tries,
+		Error:      j.Error,
+		RunAt:      j.RunAt,
+		CreatedAt:  j.MetaCreatedAt,
+		UpdatedAt:  j.MetaUpdatedAt,
+		Retryable:  j.Retryable(),
+		Cancelable: j.Cancelable(),
+		Deletable:  j.Deletable(),
+	}
+
+	id, err := ub.EncodeID(j.ID())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode job id")
+	}
+
+	jr.ID = id
+
+	p, err := ub.Path("SHOW", j)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build job path")
+	}
+
+	jr.Path = "/admin" + p
+
+	return jr, nil
+}
+
+// fieldValue formats a JSON encoded field value for display
+func fieldValue(raw json.RawMessage) string {
+	var v interface{}
+
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		return string(raw)
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []interface{}:
+		var vs []string
+		for _, i := range t {
+			vs = append(vs, fmt.Sprint(i))
+		}
+		return strings.Join(vs, ", ")
+	default:
+		return fmt.Sprint(t)
+	}
+}
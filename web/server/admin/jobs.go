@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/html"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+// defaultState is listed when no state is given, failed jobs are the ones
+// that need attention
+const defaultState = "failed"
+
+// Jobs returns a response handler that lists the jobs filtered by state and
+// name
+func Jobs(conn primitives.Database, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		state, name := filters(r.URL.Query())
+
+		jobs, err := findJobs(ctx, conn, ub, state, name)
+		if err != nil {
+			return err.(response.Error)
+		}
+
+		content := struct {
+			State  string
+			Name   string
+			States []string
+			Jobs   []*html.Job
+		}{
+			State:  state,
+			Name:   name,
+			States: worker.States,
+			Jobs:   jobs,
+		}
+
+		page := web.Page{
+			Title:      "Jobs",
+			ActiveMenu: "admin",
+			Partials:   []string{"admin_jobs"},
+			Content:    content,
+		}
+
+		return response.NewContent(page)
+	}
+}
+
+// JobAction returns a response handler that retries, cancels or deletes a
+// job and goes back to the list with the filters posted by the form
+func JobAction(conn primitives.Database, ub web.URLBuilder, hash, action string) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		if err := r.ParseForm(); err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "invalid form")
+		}
+
+		_, err := jobAction(ctx, conn, ub, hash, action)
+		if err != nil {
+			return err.(response.Error)
+		}
+
+		q := url.Values{
+			"state": {r.PostForm.Get("state")},
+			"name":  {r.PostForm.Get("name")},
+		}
+
+		return response.Redirect{Path: "/admin/jobs/?" + q.Encode(), Code: http.StatusFound}
+	}
+}
+
+// JobsJSON is the same as Jobs encoded as json
+func JobsJSON(conn primitives.Database, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		state, name := filters(r.URL.Query())
+
+		jobs, err := findJobs(ctx, conn, ub, state, name)
+		if err != nil {
+			return jsonError(err.(response.Error))
+		}
+
+		if jobs == nil {
+			jobs = []*html.Job{}
+		}
+
+		return response.JSON{Value: jobs}
+	}
+}
+
+// JobActionJSON is the same as JobAction responding with the updated job
+func JobActionJSON(conn primitives.Database, ub web.URLBuilder, hash, action string) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		job, err := jobAction(ctx, conn, ub, hash, action)
+		if err != nil {
+			return jsonError(err.(response.Error))
+		}
+
+		if action == "delete" {
+			return response.JSON{Code: http.StatusNoContent}
+		}
+
+		jr, err := html.RenderJob(ub, *job)
+		if err != nil {
+			return jsonError(response.WrapError(err, http.StatusInternalServerError, "failed to render job"))
+		}
+
+		return response.JSON{Value: jr}
+	}
+}
+
+// filters returns the state and name to filter jobs by, a missing state
+// defaults to failed and an empty one lists every state
+func filters(q url.Values) (string, string) {
+	state := defaultState
+
+	if s, ok := q["state"]; ok && len(s) > 0 {
+		state = s[0]
+	}
+
+	return state, q.Get("name")
+}
+
+func findJobs(ctx context.Context, conn primitives.Database, ub web.URLBuilder,
+	state, name string) ([]*html.Job, error) {
+
+	if state != "" && !validState(state) {
+		return nil, response.NewError(http.StatusBadRequest, "invalid job state "+state)
+	}
+
+	jobs, err := worker.FindJobs(ctx, conn, state, name)
+	if err != nil {
+		return nil, response.WrapError(err, http.StatusInternalServerError, "failed to find jobs")
+	}
+
+	var jobsC []*html.Job
+
+	for _, j := range jobs {
+		jr, err := html.RenderJob(ub, *j)
+		if err != nil {
+			return nil, response.WrapError(err, http.StatusInternalServerError, "failed to render job")
+		}
+
+		jobsC = append(jobsC, jr)
+	}
+
+	return jobsC, nil
+}
+
+// jobAction runs the action on the job, returning the updated job or nil
+// when it was deleted
+func jobAction(ctx context.Context, conn primitives.Database, ub web.URLBuilder,
+	hash, action string) (*worker.Job, error) {
+
+	id, err := ub.ParseID(hash)
+	if err != nil {
+		return nil, response.WrapError(err, http.StatusNotFound, "invalid job id")
+	}
+
+	job, err := worker.FindJob(ctx, conn, id)
+	if err != nil {
+		return nil, response.WrapError(err, http.StatusNotFound, "job not found")
+	}
+
+	var allowed bool
+
+	var run func(context.Context, primitives.Database, *worker.Job) error
+
+	switch action {
+	case "retry":
+		allowed, run = job.Retryable(), worker.RetryJob
+	case "cancel":
+		allowed, run = job.Cancelable(), worker.CancelJob
+	case "delete":
+		allowed, run = job.Deletable(), worker.DeleteJob
+	default:
+		return nil, response.NewError(http.StatusNotFound, "invalid job action "+action)
+	}
+
+	if !allowed {
+		return nil, response.NewError(http.StatusBadRequest, "cannot "+action+" "+job.State+" job")
+	}
+
+	err = run(ctx, conn, job)
+	if err != nil {
+		return nil, response.WrapError(err, http.StatusInternalServerError, "failed to "+action+" job")
+	}
+
+	if action == "delete" {
+		return nil, nil
+	}
+
+	return job, nil
+}
+
+func validState(state string) bool {
+	for _, s := range worker.States {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonError responds with the error message and code as json, so api clients
+// don't get an html error page
+func jsonError(err response.Error) response.Responder {
+	body := map[string]string{"error": err.Error()}
+
+	return response.JSON{Value: body, Code: err.Code()}
+}
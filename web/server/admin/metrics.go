@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+// Metrics returns a response handler serving the expvar metrics, which include
+// the command line and memory stats, so it is only mounted for admins
+func Metrics() response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+		expvar.Handler().ServeHTTP(w, r)
+
+		return response.NoContent()
+	}
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
+	ub web.URLBuilder) *http.ServeMux {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[len("/jobs/"):]
+		method := r.Method
+
+		var handler response.Handler
+
+		hash, action := split(path)
+
+		switch {
+		case method == "GET" && path == "":
+			handler = Jobs(db, ub)
+		case method == "POST" && hash != "" && action != "":
+			handler = JobAction(db, ub, hash, action)
+		}
+
+		if handler != nil {
+			handler = middlewares.Admin(handler)
+		}
+
+		renderer.Render(handler, w, r)
+	})
+
+	mux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[len("/api/jobs/"):]
+		method := r.Method
+
+		var handler response.Handler
+
+		hash, action := split(path)
+
+		switch {
+		case method == "GET" && path == "":
+			handler = JobsJSON(db, ub)
+		case method == "POST" && hash != "" && action != "":
+			handler = JobActionJSON(db, ub, hash, action)
+		}
+
+		if handler != nil {
+			handler = middlewares.Admin(handler)
+		}
+
+		renderer.Render(handler, w, r)
+	})
+
+	mux.HandleFunc("/metrics/", func(w http.ResponseWriter, r *http.Request) {
+		var handler response.Handler
+
+		if r.Method == "GET" && r.URL.Path == "/metrics/" {
+			handler = middlewares.Admin(Metrics())
+		}
+
+		renderer.Render(handler, w, r)
+	})
+
+	return mux
+}
+
+// split parses paths like "<hash>/retry"
+func split(path string) (string, string) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
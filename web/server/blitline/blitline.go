@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
+	"gitlab.com/luizbranco/cyberbrain/db"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
 	"gitlab.com/luizbranco/cyberbrain/web/server/finder"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+	"gitlab.com/luizbranco/cyberbrain/worker/resizer"
 )
 
 // BlitlineResponse is the json response from Blitline postback or polling
@@ -23,10 +27,43 @@ type BlitlineResponse struct {
 	} `json:"results"`
 }
 
-func PatchCard(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
+// imagerTypes maps the callback paths to the record types
+var imagerTypes = map[string]string{
+	"cards": "card",
+	"decks": "deck",
+	"users": "user",
+}
+
+// imagerRecord is an imager that can be updated in the database
+type imagerRecord interface {
+	primitives.Record
+	GetImageURL() string
+	SetImageURL(string)
+	SetImageVariant(name, url string)
+}
+
+// Verified responds with forbidden unless the callback URL was signed for the
+// record image by the resizer and hasn't expired
+func Verified(secret, imagerType, name string, h response.Handler) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		err := resizer.VerifyCallback(secret, imagerType, name, r.URL.Query(), time.Now())
+		if err != nil {
+			return response.WrapError(err, http.StatusForbidden, "invalid callback")
+		}
+
+		return h(ctx, w, r)
+	}
+}
+
+// Patch replaces the record image by the resized images, the full size as
+// its image URL and the others as its variants
+func Patch(conn primitives.Database, ub web.URLBuilder, bucket, imagerType,
+	hash string) response.Handler {
+
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		card, _, err := finder.Card(conn, ub, hash, finder.NoOption)
+		imager, err := find(ctx, conn, ub, imagerType, hash)
 		if err != nil {
 			return err.(response.Error)
 		}
@@ -47,18 +84,64 @@ func PatchCard(conn primitives.Database, ub web.URLBuilder, hash string) respons
 			return response.NewError(http.StatusBadRequest, "no images result")
 		}
 
-		card.ImageURL = res.Results.Images[0].S3URL
+		for _, img := range res.Results.Images {
+			size, err := resizer.VerifyResult(bucket, imagerType, hash, img.ImageIdentifier, img.S3URL)
+			if err != nil {
+				return response.WrapError(err, http.StatusBadRequest, "invalid image result")
+			}
+
+			if size == worker.FullSize {
+				imager.SetImageURL(img.S3URL)
+			} else {
+				imager.SetImageVariant(size, img.S3URL)
+			}
+		}
 
-		err = conn.Update(card)
+		err = conn.Update(ctx, imager)
 		if err != nil {
-			return response.WrapError(err, http.StatusBadRequest, "failed to update card")
+			return response.WrapError(err, http.StatusBadRequest, "failed to update "+imagerType)
 		}
 
 		page := web.Page{
-			Title:    "Card Updated",
+			Title:    "Image Updated",
 			Partials: []string{"200"},
 		}
 
 		return response.NewContent(page)
 	}
 }
+
+func find(ctx context.Context, conn primitives.Database, ub web.URLBuilder, imagerType,
+	hash string) (imagerRecord, error) {
+
+	switch imagerType {
+	case "card":
+		card, _, err := finder.Card(ctx, conn, ub, hash, finder.NoOption)
+		if err != nil {
+			return nil, err
+		}
+
+		return card, nil
+	case "deck":
+		deck, _, _, err := finder.Deck(ctx, conn, ub, hash, finder.NoOption)
+		if err != nil {
+			return nil, err
+		}
+
+		return deck, nil
+	case "user":
+		id, err := ub.ParseID(hash)
+		if err != nil {
+			return nil, response.WrapError(err, http.StatusBadRequest, "invalid user id")
+		}
+
+		user, err := db.FindUser(ctx, conn, id)
+		if err != nil {
+			return nil, response.WrapError(err, http.StatusNotFound, "user not found")
+		}
+
+		return user, nil
+	}
+
+	return nil, response.NewError(http.StatusNotFound, "invalid record type "+imagerType)
+}
@@ -11,7 +11,7 @@ import (
 )
 
 func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
-	ub web.URLBuilder) *http.ServeMux {
+	ub web.URLBuilder, secret, bucket string) *http.ServeMux {
 
 	mux := http.NewServeMux()
 
@@ -20,6 +20,7 @@ func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
 
 		if method != "POST" {
 			renderer.Render(nil, w, r)
+			return
 		}
 
 		var handler response.Handler
@@ -28,11 +29,12 @@ func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
 
 		if len(paths) != 3 {
 			renderer.Render(nil, w, r)
+			return
 		}
 
-		switch {
-		case paths[1] == "cards":
-			handler = PatchCard(db, ub, paths[2])
+		if imagerType, ok := imagerTypes[paths[1]]; ok {
+			handler = Patch(db, ub, bucket, imagerType, paths[2])
+			handler = Verified(secret, imagerType, paths[2], handler)
 		}
 
 		renderer.Render(handler, w, r)
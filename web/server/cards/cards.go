@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 
+	"github.com/pkg/errors"
 	"gitlab.com/luizbranco/cyberbrain/db"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
@@ -13,6 +15,7 @@ import (
 	"gitlab.com/luizbranco/cyberbrain/web/server/finder"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/server/uploads"
 	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
@@ -27,7 +30,7 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		deck := middlewares.CurrentDeck(ctx)
 
-		tags, err := db.FindTags(conn, deck.ID())
+		tags, err := db.FindTags(ctx, conn, deck.ID())
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to find deck tags")
 		}
@@ -43,7 +46,7 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		page := web.Page{
 			Title:    "New Card",
-			Partials: []string{"new_card"},
+			Partials: []string{"new_card", "fields"},
 			Content:  content,
 		}
 
@@ -51,13 +54,19 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 	}
 }
 
-func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageResizer) response.Handler {
+func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageResizer,
+	speaker worker.Speaker, store primitives.BlobStore) response.Handler {
+
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		if err := r.ParseForm(); err != nil {
+		if err := uploads.ParseForm(w, r); err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
+		if err := storeUploads(ctx, store, r); err != nil {
+			return err.(response.Error)
+		}
+
 		deck := middlewares.CurrentDeck(ctx)
 
 		card, err := html.NewCardFromForm(deck, r.Form)
@@ -65,7 +74,13 @@ func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageRes
 			return response.WrapError(err, http.StatusBadRequest, "invalid card form")
 		}
 
-		err = conn.Create(card)
+		user, _ := middlewares.CurrentUser(ctx)
+
+		err = db.SaveCard(ctx, db.Audit(conn, user.ID()), card)
+		if errors.Cause(err) == db.ErrFieldsChanged {
+			return response.WrapError(err, http.StatusConflict, "deck fields changed")
+		}
+
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create card")
 		}
@@ -84,7 +99,7 @@ func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageRes
 				TagID:  id,
 			}
 
-			err = conn.Create(&ct)
+			err = conn.Create(ctx, &ct)
 			if err != nil {
 				return response.WrapError(err, http.StatusInternalServerError, "failed to create card tag")
 			}
@@ -95,14 +110,21 @@ func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageRes
 			return response.WrapError(err, http.StatusInternalServerError, "failed to encode card id")
 		}
 
-		err = resizer.Resize(card, hash, 400, 300)
+		err = resizer.Resize(ctx, card, hash, worker.CardImageSizes)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue card resize job")
 		}
 
+		if card.SoundURL == "" && deck.SpeechLanguage != "" {
+			err = speaker.Speak(ctx, card)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue card speech job")
+			}
+		}
+
 		schedule := primitives.NewCardSchedule(deck.ID(), card.ID())
 
-		err = conn.Create(schedule)
+		err = conn.Create(ctx, schedule)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create card schedule")
 		}
@@ -119,14 +141,14 @@ func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageRes
 func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		card, tags, err := finder.Card(conn, ub, hash, finder.WithTags)
+		card, tags, err := finder.Card(ctx, conn, ub, hash, finder.WithTags)
 		if err != nil {
 			return err.(response.Error)
 		}
 
 		deck := middlewares.CurrentDeck(ctx)
 
-		deckTags, err := db.FindTags(conn, deck.ID())
+		deckTags, err := db.FindTags(ctx, conn, deck.ID())
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to find deck tags")
 		}
@@ -142,7 +164,7 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 
 		page := web.Page{
 			Title:    "Card",
-			Partials: []string{"card"},
+			Partials: []string{"card", "fields"},
 			Content:  content,
 		}
 
@@ -150,19 +172,25 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 	}
 }
 
-func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
+func Update(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageResizer,
+	speaker worker.Speaker, store primitives.BlobStore, hash string) response.Handler {
+
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		if err := r.ParseForm(); err != nil {
+		if err := uploads.ParseForm(w, r); err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
-		card, _, err := finder.Card(conn, ub, hash, finder.NoOption)
+		if err := storeUploads(ctx, store, r); err != nil {
+			return err.(response.Error)
+		}
+
+		card, _, err := finder.Card(ctx, conn, ub, hash, finder.NoOption)
 		if err != nil {
 			return err.(response.Error)
 		}
 
-		deck, err := db.FindDeck(conn, card.DeckID)
+		deck, err := db.FindDeck(ctx, conn, card.DeckID)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "invalid card deck")
 		}
@@ -172,19 +200,57 @@ func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.H
 			return response.WrapError(err, http.StatusBadRequest, "invalid card form")
 		}
 
-		card.ImageURL = newCard.ImageURL
-		card.SoundURL = newCard.SoundURL
+		imageChanged := card.ImageURL != newCard.ImageURL
+
+		if imageChanged {
+			card.ImageURL = newCard.ImageURL
+			card.ImageVariants = nil
+			card.ImageSourceURL = ""
+			card.ImageUnreachable = false
+		}
+
+		speechChanged := speechText(*deck, card) != speechText(*deck, newCard)
+		soundChanged := card.SoundURL != newCard.SoundURL
+
+		if soundChanged {
+			card.SoundURL = newCard.SoundURL
+			card.SoundGenerated = false
+		}
+
 		card.Definitions = newCard.Definitions
 		card.Caption = newCard.Caption
 		card.NSFW = newCard.NSFW
 
 		// TODO reassign card tags
 
-		err = conn.Update(card)
+		user, _ := middlewares.CurrentUser(ctx)
+
+		err = db.SaveCard(ctx, db.Audit(conn, user.ID()), card)
+		if errors.Cause(err) == db.ErrFieldsChanged {
+			return response.WrapError(err, http.StatusConflict, "deck fields changed")
+		}
+
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "failed to update card")
 		}
 
+		if imageChanged {
+			err = resizer.Resize(ctx, card, hash, worker.CardImageSizes)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue card resize job")
+			}
+		}
+
+		// generated sounds follow the speech field, the users' are kept
+		speak := card.SoundURL == "" || card.SoundGenerated
+
+		if deck.SpeechLanguage != "" && speak && (speechChanged || soundChanged) {
+			err = speaker.Speak(ctx, card)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue card speech job")
+			}
+		}
+
 		path, err := ub.Path("SHOW", deck)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to generate deck path")
@@ -193,3 +259,23 @@ func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.H
 		return response.Redirect{Path: path, Code: http.StatusFound}
 	}
 }
+
+// speechText returns the card definition pronounced by the deck speech
+func speechText(deck primitives.Deck, card *primitives.Card) string {
+	if deck.SpeechField < 0 || deck.SpeechField >= len(card.Definitions) {
+		return ""
+	}
+
+	return strings.TrimSpace(card.Definitions[deck.SpeechField])
+}
+
+// storeUploads replaces the image and sound URLs by the uploaded files, if
+// any
+func storeUploads(ctx context.Context, store primitives.BlobStore, r *http.Request) error {
+	err := uploads.Store(ctx, store, r, "image_file", "image_url", uploads.Image)
+	if err != nil {
+		return err
+	}
+
+	return uploads.Store(ctx, store, r, "sound_file", "sound_url", uploads.Audio)
+}
@@ -0,0 +1,174 @@
+package changes
+
+import (
+	"context"
+	"net/http"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/html"
+	"gitlab.com/luizbranco/cyberbrain/web/server/finder"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+// Deck returns a response handler that displays the history of changes of
+// the current deck
+func Deck(conn primitives.Database, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		deck := middlewares.CurrentDeck(ctx)
+
+		deckC, err := html.RenderDeck(ub, deck, nil, nil)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to render deck")
+		}
+
+		changes, err := renderChanges(ctx, conn, ub, deck, deck)
+		if err != nil {
+			return err.(response.Error)
+		}
+
+		content := struct {
+			Deck    *html.Deck
+			Changes []*html.Change
+		}{
+			Deck:    deckC,
+			Changes: changes,
+		}
+
+		page := web.Page{
+			Title:      deck.Name + " Deck History",
+			ActiveMenu: "decks",
+			Partials:   []string{"deck_history", "changes"},
+			Content:    content,
+		}
+
+		return response.NewContent(page)
+	}
+}
+
+// Card returns a response handler that displays the history of changes of a
+// card from the current deck
+func Card(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		deck := middlewares.CurrentDeck(ctx)
+
+		card, _, err := finder.Card(ctx, conn, ub, hash, finder.NoOption)
+		if err != nil {
+			return err.(response.Error)
+		}
+
+		if card.DeckID != deck.ID() {
+			return response.NewError(http.StatusNotFound, "card not found")
+		}
+
+		cardC, err := html.RenderCard(ub, deck, nil, *card, nil, true)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to render card")
+		}
+
+		changes, err := renderChanges(ctx, conn, ub, deck, card)
+		if err != nil {
+			return err.(response.Error)
+		}
+
+		content := struct {
+			Card    *html.Card
+			Changes []*html.Change
+		}{
+			Card:    cardC,
+			Changes: changes,
+		}
+
+		page := web.Page{
+			Title:    "Card History",
+			Partials: []string{"card_history", "changes"},
+			Content:  content,
+		}
+
+		return response.NewContent(page)
+	}
+}
+
+// Revert returns a response handler that restores a deck or card to its state
+// before the change
+func Revert(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		user, _ := middlewares.CurrentUser(ctx)
+		deck := middlewares.CurrentDeck(ctx)
+
+		id, err := ub.ParseID(hash)
+		if err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "invalid change id")
+		}
+
+		change, err := db.FindRecordChange(ctx, conn, id)
+		if err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "wrong change id")
+		}
+
+		var record primitives.Identifiable
+		var parent []primitives.Identifiable
+
+		switch change.RecordType {
+		case "deck":
+			if change.RecordID != deck.ID() {
+				return response.NewError(http.StatusNotFound, "change not found")
+			}
+
+			record = deck
+		case "card":
+			card, _, err := finder.Card(ctx, conn, ub, change.RecordID, finder.NoOption)
+			if err != nil {
+				return err.(response.Error)
+			}
+
+			if card.DeckID != deck.ID() {
+				return response.NewError(http.StatusNotFound, "change not found")
+			}
+
+			record = card
+			parent = append(parent, deck)
+		default:
+			return response.NewError(http.StatusBadRequest, "invalid change record type")
+		}
+
+		_, err = db.Audit(conn, user.ID()).Revert(ctx, *change)
+		if err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "failed to revert change")
+		}
+
+		path, err := ub.Path("SHOW", record, parent...)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to generate record path")
+		}
+
+		return response.Redirect{Path: path + "/history", Code: http.StatusFound}
+	}
+}
+
+func renderChanges(ctx context.Context, conn primitives.Database, ub web.URLBuilder, deck primitives.Deck,
+	record primitives.Identifiable) ([]*html.Change, error) {
+
+	changes, err := db.FindRecordChanges(ctx, conn, record.Type(), record.ID())
+	if err != nil {
+		return nil, response.WrapError(err, http.StatusInternalServerError, "failed to find changes")
+	}
+
+	var content []*html.Change
+
+	for _, c := range changes {
+		cr, err := html.RenderChange(ub, deck, c)
+		if err != nil {
+			return nil, response.WrapError(err, http.StatusInternalServerError, "failed to render change")
+		}
+
+		content = append(content, cr)
+	}
+
+	return content, nil
+}
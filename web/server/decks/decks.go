@@ -3,9 +3,12 @@ package decks
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"reflect"
 	"strconv"
-	"time"
+	"strings"
 
+	"github.com/pkg/errors"
 	"gitlab.com/luizbranco/cyberbrain/db"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
@@ -13,6 +16,8 @@ import (
 	"gitlab.com/luizbranco/cyberbrain/web/server/finder"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/server/uploads"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 func Index(conn primitives.Database, ub web.URLBuilder) response.Handler {
@@ -20,7 +25,7 @@ func Index(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		user, _ := middlewares.CurrentUser(ctx)
 
-		decks, err := db.FindDecks(conn, user.ID())
+		decks, err := db.FindDecks(ctx, conn, user.ID())
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to find decks")
 		}
@@ -60,13 +65,20 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 	}
 }
 
-func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
+func Create(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageResizer,
+	store primitives.BlobStore) response.Handler {
+
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		if err := r.ParseForm(); err != nil {
+		if err := uploads.ParseForm(w, r); err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
+		err := uploads.Store(ctx, store, r, "image_file", "image_url", uploads.Image)
+		if err != nil {
+			return err.(response.Error)
+		}
+
 		deck, err := html.NewDeckFromForm(r.Form)
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid deck form")
@@ -76,11 +88,18 @@ func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		deck.UserID = user.ID()
 
-		err = conn.Create(deck)
+		err = db.Audit(conn, user.ID()).Create(ctx, deck)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create deck")
 		}
 
+		if deck.ImageURL != "" {
+			err = resize(ctx, ub, resizer, deck)
+			if err != nil {
+				return err.(response.Error)
+			}
+		}
+
 		path, err := ub.Path("SHOW", deck)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to generate deck path")
@@ -94,16 +113,16 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
 		opts := finder.WithTags | finder.WithCards
-		if nsfw(w, r) {
+		if middlewares.NSFW(w, r) {
 			opts = opts | finder.NSFW
 		}
 
-		deck, cards, tags, err := finder.Deck(conn, ub, hash, opts)
+		deck, cards, tags, err := finder.Deck(ctx, conn, ub, hash, opts)
 		if err != nil {
 			return err.(response.Error)
 		}
 
-		scheduled, err := db.CountCardsScheduled(conn, deck.ID())
+		scheduled, err := db.CountCardsScheduled(ctx, conn, deck.ID())
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to count cards scheduled")
 		}
@@ -115,6 +134,15 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 
 		content.CardsScheduled = scheduled
 
+		for _, mode := range []string{primitives.ImageReview, primitives.TextReview, primitives.ListeningReview} {
+			total, correct, err := db.CountCardReviews(ctx, conn, deck.ID(), mode)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to count card reviews")
+			}
+
+			content.Reviews = append(content.Reviews, html.ReviewCount{Mode: mode, Total: total, Correct: correct})
+		}
+
 		page := web.Page{
 			Title:      deck.Name + " Deck",
 			ActiveMenu: "decks",
@@ -147,38 +175,62 @@ func Edit(conn primitives.Database, ub web.URLBuilder) response.Handler {
 	}
 }
 
-func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.Handler {
+func Update(conn primitives.Database, ub web.URLBuilder, resizer worker.ImageResizer,
+	store primitives.BlobStore, hash string) response.Handler {
+
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-		if err := r.ParseForm(); err != nil {
+		if err := uploads.ParseForm(w, r); err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
-		deck, _, _, err := finder.Deck(conn, ub, hash, finder.NoOption)
+		err := uploads.Store(ctx, store, r, "image_file", "image_url", uploads.Image)
 		if err != nil {
 			return err.(response.Error)
 		}
 
-		deck.Name = r.Form.Get("name")
-		deck.Description = r.Form.Get("description")
-
-		field := r.Form.Get("primary_field")
-		id, err := strconv.Atoi(field)
+		deck, _, _, err := finder.Deck(ctx, conn, ub, hash, finder.NoOption)
 		if err != nil {
-			return response.WrapError(err, http.StatusBadRequest, "invalid primary field")
+			return err.(response.Error)
 		}
 
-		deck.PrimaryField = id
+		user, _ := middlewares.CurrentUser(ctx)
+
+		imageChanged := false
 
-		if deck.Name == "" {
-			return response.NewError(http.StatusBadRequest, "deck name cannot be empty")
+		// the deck is locked so the fields migrations and card writes don't
+		// interleave with the schema changes
+		err = db.Transaction(ctx, db.Audit(conn, user.ID()), func(tx primitives.Database) error {
+			locked, err := db.LockDeck(ctx, tx, deck.ID())
+			if err != nil {
+				return err
+			}
+
+			imageChanged, err = setDeck(ctx, tx, locked, r.Form)
+			if err != nil {
+				return err
+			}
+
+			deck = locked
+
+			return tx.Update(ctx, deck)
+		})
+
+		if rerr, ok := errors.Cause(err).(response.Error); ok {
+			return rerr
 		}
 
-		err = conn.Update(deck)
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "failed to update deck")
 		}
 
+		if imageChanged && deck.ImageURL != "" {
+			err = resize(ctx, ub, resizer, deck)
+			if err != nil {
+				return err.(response.Error)
+			}
+		}
+
 		path, err := ub.Path("SHOW", deck)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to generate deck path")
@@ -188,27 +240,271 @@ func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.H
 	}
 }
 
-func nsfw(w http.ResponseWriter, r *http.Request) bool {
-	q := r.URL.Query()
-	nsfw := q.Get("nsfw")
+// setDeck changes the deck to the form values, reporting whether its image
+// changed. Clients not sending the image, speech settings or field schema keep
+// the current ones.
+func setDeck(ctx context.Context, tx primitives.Database, deck *primitives.Deck,
+	form url.Values) (bool, error) {
+
+	imageChanged := false
+
+	deck.Name = form.Get("name")
+	deck.Description = form.Get("description")
+
+	// clients not sending the image keep the current one
+	if _, ok := form["image_url"]; ok {
+		imageURL := form.Get("image_url")
+		imageChanged = imageURL != deck.ImageURL
+		deck.ImageURL = imageURL
+
+		if imageChanged {
+			deck.ImageVariants = nil
+		}
+	}
+
+	field := form.Get("primary_field")
+	id, err := strconv.Atoi(field)
+	if err != nil {
+		return false, response.WrapError(err, http.StatusBadRequest, "invalid primary field")
+	}
 
-	if nsfw == "" {
-		cookie, err := r.Cookie("nsfw")
+	deck.PrimaryField = id
+
+	// clients not sending the speech settings keep the current ones
+	if _, ok := form["speech_language"]; ok {
+		field, err := strconv.Atoi(form.Get("speech_field"))
+		if err != nil || field < 0 || field >= len(deck.Fields) {
+			return false, response.NewError(http.StatusBadRequest, "invalid speech field")
+		}
+
+		deck.SpeechField = field
+		deck.SpeechLanguage = strings.TrimSpace(form.Get("speech_language"))
+	}
+
+	// clients not sending the field schema keep the current one
+	if _, ok := form["field_kinds"]; ok {
+		schema, err := html.NewSchemaFromForm(*deck, form)
+		if err != nil {
+			return false, response.WrapError(err, http.StatusBadRequest, "invalid field schema")
+		}
+
+		// the card definitions were validated against the current kinds
+		changed, err := kindsChanged(*deck, schema)
+		if err != nil {
+			return false, response.WrapError(err, http.StatusInternalServerError, "failed to get deck field schema")
+		}
+
+		if changed {
+			cards, err := db.FindCardsByDeck(ctx, tx, deck.ID(), true)
+			if err != nil {
+				return false, response.WrapError(err, http.StatusInternalServerError, "failed to find deck cards")
+			}
+
+			if len(cards) > 0 {
+				return false, response.NewError(http.StatusBadRequest, "field kinds cannot change on decks with cards")
+			}
+		}
+
+		err = deck.SetSchema(schema)
 		if err != nil {
-			return false
+			return false, response.WrapError(err, http.StatusBadRequest, "invalid field schema")
 		}
+	}
 
-		nsfw = cookie.Value
+	if deck.Name == "" {
+		return false, response.NewError(http.StatusBadRequest, "deck name cannot be empty")
 	}
 
-	cookie := http.Cookie{
-		Name:    "nsfw",
-		Value:   nsfw,
-		Path:    "/",
-		Expires: time.Now().Add(30 * time.Minute),
+	return imageChanged, nil
+}
+
+// EditFields displays the form adding, removing and reordering the deck fields
+func EditFields(ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		deck := middlewares.CurrentDeck(ctx)
+
+		deckC, err := html.RenderDeck(ub, deck, nil, nil)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to render deck")
+		}
+
+		// a blank row to add a field
+		rows := append(html.NewFieldRows(deck.Fields), html.FieldRow{Position: len(deck.Fields) + 1})
+
+		content := struct {
+			Deck *html.Deck
+			Rows []html.FieldRow
+		}{
+			Deck: deckC,
+			Rows: rows,
+		}
+
+		page := web.Page{
+			Title:      deck.Name + " Fields",
+			ActiveMenu: "decks",
+			Partials:   []string{"deck_fields"},
+			Content:    content,
+		}
+
+		return response.NewContent(page)
 	}
+}
 
-	http.SetCookie(w, &cookie)
+// maxPreviewCards is the number of changed cards listed in the fields preview
+const maxPreviewCards = 20
+
+// UpdateFields previews the changes of the deck fields on its cards, migrating
+// them when the preview is applied
+func UpdateFields(conn primitives.Database, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		if err := r.ParseForm(); err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "invalid form")
+		}
+
+		deck := middlewares.CurrentDeck(ctx)
+
+		m, err := html.NewFieldMigrationFromForm(deck, r.Form)
+		if err != nil {
+			return response.WrapError(err, http.StatusBadRequest, "invalid deck fields")
+		}
+
+		if r.Form.Get("action") == "Apply" {
+			user, _ := middlewares.CurrentUser(ctx)
+
+			_, err := db.MigrateDeckFields(ctx, db.Audit(conn, user.ID()), &deck, m)
+			if errors.Cause(err) == db.ErrFieldsChanged {
+				return response.WrapError(err, http.StatusConflict, "deck fields changed")
+			}
+
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to migrate deck fields")
+			}
+
+			path, err := ub.Path("SHOW", deck)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to generate deck path")
+			}
+
+			return response.Redirect{Path: path, Code: http.StatusFound}
+		}
+
+		cards, err := db.FindCardsByDeck(ctx, conn, deck.ID(), true)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to find deck cards")
+		}
+
+		type cardChange struct {
+			Before []string
+			After  []string
+		}
+
+		var changed []cardChange
+
+		for _, c := range cards {
+			after := m.Definitions(c.Definitions)
+			if reflect.DeepEqual(after, c.Definitions) {
+				continue
+			}
+
+			changed = append(changed, cardChange{Before: c.Definitions, After: after})
+		}
+
+		deckC, err := html.RenderDeck(ub, deck, nil, nil)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to render deck")
+		}
+
+		var names []string
+		for _, f := range m.Fields {
+			names = append(names, f.Name)
+		}
+
+		content := struct {
+			Deck    *html.Deck
+			Fields  []string
+			Rows    []html.FieldRow
+			Cards   []cardChange
+			Changed int
+		}{
+			Deck:    deckC,
+			Fields:  names,
+			Rows:    html.NewMigrationRows(m),
+			Changed: len(changed),
+		}
+
+		if len(changed) > maxPreviewCards {
+			changed = changed[:maxPreviewCards]
+		}
+
+		content.Cards = changed
+
+		page := web.Page{
+			Title:      deck.Name + " Fields",
+			ActiveMenu: "decks",
+			Partials:   []string{"deck_fields_preview"},
+			Content:    content,
+		}
+
+		return response.NewContent(page)
+	}
+}
+
+// Speak generates the pronunciation audio of the deck cards without a sound
+// set by the users
+func Speak(speaker worker.Speaker, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		deck := middlewares.CurrentDeck(ctx)
+
+		if deck.SpeechLanguage == "" {
+			return response.NewError(http.StatusBadRequest, "deck speech language not set")
+		}
+
+		err := speaker.SpeakDeck(ctx, &deck)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue deck speech job")
+		}
+
+		path, err := ub.Path("SHOW", deck)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to generate deck path")
+		}
+
+		return response.Redirect{Path: path, Code: http.StatusFound}
+	}
+}
+
+// kindsChanged reports whether the schema changes the kind of any deck field
+func kindsChanged(deck primitives.Deck, schema []primitives.Field) (bool, error) {
+	fields, err := deck.Schema()
+	if err != nil {
+		return false, err
+	}
+
+	for i, f := range fields {
+		if i < len(schema) && schema[i].Kind != f.Kind {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// resize enqueues the deck cover resize job
+func resize(ctx context.Context, ub web.URLBuilder, resizer worker.ImageResizer,
+	deck *primitives.Deck) error {
+
+	hash, err := ub.EncodeID(deck.ID())
+	if err != nil {
+		return response.WrapError(err, http.StatusInternalServerError, "failed to encode deck id")
+	}
+
+	err = resizer.Resize(ctx, deck, hash, worker.DeckImageSizes)
+	if err != nil {
+		return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue deck resize job")
+	}
 
-	return nsfw == "true"
+	return nil
 }
@@ -0,0 +1,84 @@
+package decks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/urlbuilder"
+)
+
+func TestUpdate_kinds(t *testing.T) {
+	ctx := context.Background()
+
+	ub, err := urlbuilder.New("test")
+	test.OK(t, err)
+
+	tcs := []struct {
+		scenario string
+		kind     string
+		cards    bool
+		code     int
+		want     string
+	}{
+		{"same kind", primitives.TextField, true, http.StatusFound, primitives.TextField},
+		{"kind without cards", primitives.ClozeField, false, http.StatusFound, primitives.ClozeField},
+		{"kind with cards", primitives.ClozeField, true, http.StatusBadRequest, primitives.TextField},
+		{"unknown kind", "rich_text", false, http.StatusBadRequest, primitives.TextField},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			conn := memory.New()
+
+			user := &primitives.User{Name: "Jane", Email: "jane@example.com"}
+			test.OK(t, conn.Create(ctx, user))
+
+			deck := &primitives.Deck{UserID: user.ID(), Name: "Animals", Fields: []string{"English"}}
+			test.OK(t, conn.Create(ctx, deck))
+
+			if tc.cards {
+				card := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"cat"}}
+				test.OK(t, conn.Create(ctx, card))
+			}
+
+			hash, err := ub.EncodeID(deck.ID())
+			test.OK(t, err)
+
+			form := url.Values{
+				"name":          {"Animals"},
+				"primary_field": {"0"},
+				"field_kinds":   {tc.kind},
+				"field_back":    {"0"},
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/decks/"+hash, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			res := Update(conn, ub, nil, nil, hash)(middlewares.NewContext(ctx, user), w, r)
+
+			if rerr, ok := res.(response.Error); ok {
+				test.Equal(t, "status code", tc.code, rerr.Code())
+			} else {
+				test.Equal(t, "status code", tc.code, http.StatusFound)
+			}
+
+			found, err := db.FindDeck(ctx, conn, deck.ID())
+			test.OK(t, err)
+
+			fields, err := found.Schema()
+			test.OK(t, err)
+			test.Equal(t, "kind", tc.want, fields[0].Kind)
+		})
+	}
+}
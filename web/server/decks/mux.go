@@ -7,6 +7,7 @@ import (
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
 	"gitlab.com/luizbranco/cyberbrain/web/server/cards"
+	"gitlab.com/luizbranco/cyberbrain/web/server/changes"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
 	"gitlab.com/luizbranco/cyberbrain/web/server/reviews"
@@ -15,7 +16,8 @@ import (
 )
 
 func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
-	ub web.URLBuilder, resizer worker.ImageResizer) *http.ServeMux {
+	ub web.URLBuilder, resizer worker.ImageResizer, speaker worker.Speaker,
+	store primitives.BlobStore) *http.ServeMux {
 
 	mux := http.NewServeMux()
 
@@ -37,9 +39,9 @@ func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
 			case method == "GET":
 				handler = Show(db, ub, deckID)
 			case method == "POST" && deckID == "":
-				handler = Create(db, ub)
+				handler = Create(db, ub, resizer, store)
 			case method == "POST":
-				handler = Update(db, ub, deckID)
+				handler = Update(db, ub, resizer, store, deckID)
 			}
 
 			if handler != nil {
@@ -55,24 +57,54 @@ func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
 			path = paths[3]
 		}
 
+		sub := ""
+		if len(paths) > 4 {
+			sub = paths[4]
+		}
+
 		switch paths[2] {
 		case "edit":
 			if method == "GET" && path == "" {
 				handler = Edit(db, ub)
 			}
 
+		case "history":
+			if method == "GET" && path == "" {
+				handler = changes.Deck(db, ub)
+			}
+
+		case "fields":
+			switch {
+			case method == "GET" && path == "":
+				handler = EditFields(ub)
+			case method == "POST" && path == "":
+				handler = UpdateFields(db, ub)
+			}
+
+		case "speech":
+			if method == "POST" && path == "" {
+				handler = Speak(speaker, ub)
+			}
+
+		case "changes":
+			if method == "POST" && path != "" && sub == "" {
+				handler = changes.Revert(db, ub, path)
+			}
+
 		case "cards":
 			switch {
 			case method == "GET" && path == "":
 				handler = cards.Index()
 			case method == "GET" && path == "new":
 				handler = cards.New(db, ub)
+			case method == "GET" && sub == "history":
+				handler = changes.Card(db, ub, path)
 			case method == "GET":
 				handler = cards.Show(db, ub, path)
 			case method == "POST" && path == "":
-				handler = cards.Create(db, ub, resizer)
+				handler = cards.Create(db, ub, resizer, speaker, store)
 			case method == "POST":
-				handler = cards.Update(db, ub, path)
+				handler = cards.Update(db, ub, resizer, speaker, store, path)
 			}
 
 		case "tags":
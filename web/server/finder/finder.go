@@ -1,6 +1,7 @@
 package finder
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
@@ -22,7 +23,7 @@ const (
 	NSFW
 )
 
-func Deck(conn primitives.Database, ub web.URLBuilder, i identifier,
+func Deck(ctx context.Context, conn primitives.Database, ub web.URLBuilder, i identifier,
 	opt Option) (*primitives.Deck, []primitives.Card, []primitives.Tag, error) {
 
 	id, err := parseID(ub, i)
@@ -30,7 +31,7 @@ func Deck(conn primitives.Database, ub web.URLBuilder, i identifier,
 		return nil, nil, nil, err
 	}
 
-	deck, err := db.FindDeck(conn, id)
+	deck, err := db.FindDeck(ctx, conn, id)
 	if err != nil {
 		return nil, nil, nil, response.WrapError(err, http.StatusBadRequest, "wrong deck id")
 	}
@@ -44,14 +45,14 @@ func Deck(conn primitives.Database, ub web.URLBuilder, i identifier,
 	}
 
 	if opt&WithCards > 0 {
-		cards, err = db.FindCardsByDeck(conn, id, nsfw)
+		cards, err = db.FindCardsByDeck(ctx, conn, id, nsfw)
 		if err != nil {
 			return nil, nil, nil, response.WrapError(err, http.StatusInternalServerError, "failed to find deck cards")
 		}
 	}
 
 	if opt&WithTags > 0 {
-		tags, err = db.FindTags(conn, id)
+		tags, err = db.FindTags(ctx, conn, id)
 		if err != nil {
 			return nil, nil, nil, response.WrapError(err, http.StatusInternalServerError, "failed to find deck tags")
 		}
@@ -64,15 +65,15 @@ func Deck(conn primitives.Database, ub web.URLBuilder, i identifier,
 	return deck, cards, tags, nil
 }
 
-func Card(conn primitives.Database, ub web.URLBuilder, i identifier, opt Option) (*primitives.Card,
-	[]primitives.Tag, error) {
+func Card(ctx context.Context, conn primitives.Database, ub web.URLBuilder, i identifier,
+	opt Option) (*primitives.Card, []primitives.Tag, error) {
 
 	id, err := parseID(ub, i)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	card, err := db.FindCard(conn, id)
+	card, err := db.FindCard(ctx, conn, id)
 	if err != nil {
 		return nil, nil, response.WrapError(err, http.StatusBadRequest, "wrong card id")
 	}
@@ -81,7 +82,7 @@ func Card(conn primitives.Database, ub web.URLBuilder, i identifier, opt Option)
 		return card, nil, nil
 	}
 
-	tags, err := db.FindTagsByCard(conn, card.ID())
+	tags, err := db.FindTagsByCard(ctx, conn, card.ID())
 	if err != nil {
 		return nil, nil, response.WrapError(err, http.StatusInternalServerError, "failed to find card tags")
 	}
@@ -93,7 +94,7 @@ func Card(conn primitives.Database, ub web.URLBuilder, i identifier, opt Option)
 	return card, tags, nil
 }
 
-func Tag(conn primitives.Database, ub web.URLBuilder, i identifier,
+func Tag(ctx context.Context, conn primitives.Database, ub web.URLBuilder, i identifier,
 	opt Option) (*primitives.Tag,
 
 	[]primitives.Card, error) {
@@ -103,7 +104,7 @@ func Tag(conn primitives.Database, ub web.URLBuilder, i identifier,
 		return nil, nil, err
 	}
 
-	tag, err := db.FindTag(conn, id)
+	tag, err := db.FindTag(ctx, conn, id)
 	if err != nil {
 		return nil, nil, response.WrapError(err, http.StatusBadRequest, "wrong tag id")
 	}
@@ -111,7 +112,7 @@ func Tag(conn primitives.Database, ub web.URLBuilder, i identifier,
 	var cards []primitives.Card
 
 	if opt&WithCards > 0 {
-		cards, err = db.FindCardsByTag(conn, tag.ID())
+		cards, err = db.FindCardsByTag(ctx, conn, tag.ID())
 		if err != nil {
 			return nil, nil, response.WrapError(err, http.StatusInternalServerError,
 				"failed to find tag cards")
@@ -121,7 +122,7 @@ func Tag(conn primitives.Database, ub web.URLBuilder, i identifier,
 	return tag, cards, nil
 }
 
-func CardReview(conn primitives.Database, ub web.URLBuilder, i identifier) (
+func CardReview(ctx context.Context, conn primitives.Database, ub web.URLBuilder, i identifier) (
 	*primitives.CardReview, error) {
 
 	id, err := parseID(ub, i)
@@ -129,7 +130,7 @@ func CardReview(conn primitives.Database, ub web.URLBuilder, i identifier) (
 		return nil, err
 	}
 
-	review, err := db.FindCardReview(conn, id)
+	review, err := db.FindCardReview(ctx, conn, id)
 	if err != nil {
 		return nil, response.WrapError(err, http.StatusBadRequest, "wrong review id")
 	}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
@@ -26,10 +27,27 @@ func Authenticate(h response.Handler) response.Handler {
 	}
 }
 
-func NewContext(user *primitives.User) context.Context {
-	// TODO add request id
+// Admin only lets admin users through, everyone else gets a not found so the
+// admin pages aren't advertised
+func Admin(h response.Handler) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
-	ctx := context.Background()
+		user, ok := CurrentUser(ctx)
+
+		if !ok {
+			return response.Redirect{Path: "/login", Code: http.StatusFound}
+		}
+
+		if !user.Admin {
+			return response.NewError(http.StatusNotFound, r.URL.Path+" not found")
+		}
+
+		return h(ctx, w, r)
+	}
+}
+
+func NewContext(ctx context.Context, user *primitives.User) context.Context {
+	// TODO add request id
 
 	if user == nil {
 		return ctx
@@ -54,7 +72,7 @@ func Deck(h response.Handler, db primitives.Database, ub web.URLBuilder, hash st
 
 		user, _ := CurrentUser(ctx)
 
-		deck, _, _, err := finder.Deck(db, ub, hash, finder.NoOption)
+		deck, _, _, err := finder.Deck(ctx, db, ub, hash, finder.NoOption)
 		if err != nil {
 			return response.WrapError(err, http.StatusNotFound, "wrong deck id")
 		}
@@ -74,3 +92,30 @@ func CurrentDeck(ctx context.Context) primitives.Deck {
 
 	return value.(primitives.Deck)
 }
+
+// NSFW returns whether NSFW cards are shown, set by the nsfw query and kept
+// in a cookie for the next requests
+func NSFW(w http.ResponseWriter, r *http.Request) bool {
+	q := r.URL.Query()
+	nsfw := q.Get("nsfw")
+
+	if nsfw == "" {
+		cookie, err := r.Cookie("nsfw")
+		if err != nil {
+			return false
+		}
+
+		nsfw = cookie.Value
+	}
+
+	cookie := http.Cookie{
+		Name:    "nsfw",
+		Value:   nsfw,
+		Path:    "/",
+		Expires: time.Now().Add(30 * time.Minute),
+	}
+
+	http.SetCookie(w, &cookie)
+
+	return nsfw == "true"
+}
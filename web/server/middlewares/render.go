@@ -29,7 +29,7 @@ func (rr *Renderer) Render(handler response.Handler, w http.ResponseWriter, r *h
 		log.Println(err)
 	}
 
-	ctx := NewContext(user)
+	ctx := NewContext(r.Context(), user)
 
 	res := handler(ctx, w, r)
 	page, err := res.Respond(w, r)
@@ -2,6 +2,7 @@ package response
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 
 	"gitlab.com/luizbranco/cyberbrain/web"
@@ -83,3 +84,32 @@ func (rd Redirect) Respond(w http.ResponseWriter, r *http.Request) (*web.Page, e
 	http.Redirect(w, r, rd.Path, rd.Code)
 	return nil, nil
 }
+
+// JSON encodes the value as the response body instead of rendering a page
+type JSON struct {
+	Value interface{}
+	Code  int
+}
+
+func (j JSON) Respond(w http.ResponseWriter, r *http.Request) (*web.Page, error) {
+	code := j.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil, nil
+	}
+
+	b, err := json.Marshal(j.Value)
+	if err != nil {
+		return nil, WrapError(err, http.StatusInternalServerError, "failed to encode json")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+
+	return nil, nil
+}
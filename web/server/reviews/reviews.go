@@ -8,6 +8,7 @@ import (
 
 	"gitlab.com/luizbranco/cyberbrain/db"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/transliteration"
 	"gitlab.com/luizbranco/cyberbrain/web"
 	"gitlab.com/luizbranco/cyberbrain/web/html"
 	"gitlab.com/luizbranco/cyberbrain/web/server/finder"
@@ -18,6 +19,10 @@ import (
 type preferences struct {
 	Field int
 	NSFW  bool
+
+	// Listening prompts the card sound, the Field is then the answer checked
+	// instead of the prompt
+	Listening bool
 }
 
 // Index returns a response handler that redirect to /decks/ page
@@ -35,7 +40,7 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		pref := loadPreferences(w, r, deck)
 
-		card, err := db.FindNextCardScheduled(conn, deck.ID(), pref.NSFW)
+		card, err := db.FindNextCardScheduled(ctx, conn, deck.ID(), pref.NSFW)
 		if err != nil {
 			handler := Summary(conn, ub)
 			return handler(ctx, w, r)
@@ -55,15 +60,17 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 			Card       *html.Card
 			ReviewPath string
 			Field      int
+			Mode       string
 		}{
 			Card:       cardC,
 			ReviewPath: path,
 			Field:      pref.Field,
+			Mode:       reviewMode(pref, *card),
 		}
 
 		page := web.Page{
 			Title:    "Card Review",
-			Partials: []string{"new_review"},
+			Partials: []string{"new_review", "fields"},
 			Content:  content,
 		}
 
@@ -110,15 +117,21 @@ func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		cardID := r.Form.Get("card_id")
 
-		card, _, err := finder.Card(conn, ub, cardID, finder.NoOption)
+		card, _, err := finder.Card(ctx, conn, ub, cardID, finder.NoOption)
 		if err != nil {
 			return err.(response.Error)
 		}
 
+		mode := r.Form.Get("mode")
+		if mode != "" && !primitives.ValidReviewMode(mode) {
+			return response.NewError(http.StatusBadRequest, "invalid review mode")
+		}
+
 		review := &primitives.CardReview{
 			DeckID: deck.ID(),
 			CardID: card.ID(),
 			Answer: r.Form.Get("answer"),
+			Mode:   mode,
 		}
 
 		action := r.Form.Get("action")
@@ -126,23 +139,34 @@ func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
 			review.Skipped = true
 		}
 
-		for _, d := range card.Definitions {
-			if d == review.Answer {
-				review.Correct = true
-				break
+		// listening reviews are checked against the chosen field only
+		field := -1
+		if mode == primitives.ListeningReview {
+			n, err := strconv.Atoi(r.Form.Get("field"))
+			if err != nil || n < 0 || n >= len(deck.Fields) {
+				return response.NewError(http.StatusBadRequest, "invalid review field")
 			}
+
+			field = n
 		}
 
-		err = conn.Create(review)
+		answers, err := transliteration.Default.Answers(deck, *card)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to list card answers")
+		}
+
+		review.Check(answers, field)
+
+		err = conn.Create(ctx, review)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create card review")
 		}
 
-		schedule, err := db.FindCardSchedule(conn, card.ID())
+		schedule, err := db.FindCardSchedule(ctx, conn, card.ID())
 		if err != nil {
 			schedule = primitives.NewCardSchedule(deck.ID(), card.ID())
 
-			err := conn.Create(schedule)
+			err := conn.Create(ctx, schedule)
 			if err != nil {
 				return response.WrapError(err, http.StatusInternalServerError, "failed to create card schedule")
 			}
@@ -150,7 +174,7 @@ func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
 
 		schedule.Reschedule(review.Correct)
 
-		err = conn.Update(schedule)
+		err = conn.Update(ctx, schedule)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to update card schedule")
 		}
@@ -170,12 +194,12 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 
 		deck := middlewares.CurrentDeck(ctx)
 
-		review, err := finder.CardReview(conn, ub, hash)
+		review, err := finder.CardReview(ctx, conn, ub, hash)
 		if err != nil {
 			return err.(response.Error)
 		}
 
-		card, _, err := finder.Card(conn, ub, review.CardID, finder.NoOption)
+		card, _, err := finder.Card(ctx, conn, ub, review.CardID, finder.NoOption)
 		if err != nil {
 			return err.(response.Error)
 		}
@@ -195,7 +219,7 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 
 		page := web.Page{
 			Title:    "Card Review Result",
-			Partials: []string{"review_result"},
+			Partials: []string{"review_result", "fields"},
 			Content:  content,
 		}
 
@@ -209,6 +233,7 @@ func loadPreferences(w http.ResponseWriter, r *http.Request,
 	q := r.URL.Query()
 	field := q.Get("field")
 	nsfw := q.Get("nsfw")
+	mode := q.Get("mode")
 
 	p := preferences{
 		Field: -1,
@@ -237,6 +262,17 @@ func loadPreferences(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
+	if mode == "" {
+		cookie, err := r.Cookie("review_mode")
+		if err != nil && err != http.ErrNoCookie {
+			return p
+		}
+
+		if cookie != nil {
+			mode = cookie.Value
+		}
+	}
+
 	if field != "" {
 		n, err := strconv.Atoi(field)
 		if err == nil && n >= 0 && len(deck.Fields) > n {
@@ -269,5 +305,33 @@ func loadPreferences(w http.ResponseWriter, r *http.Request,
 		http.SetCookie(w, &cookie)
 	}
 
+	if primitives.ValidReviewMode(mode) {
+		if mode == primitives.ListeningReview {
+			p.Listening = true
+		}
+
+		cookie := http.Cookie{
+			Name:    "review_mode",
+			Value:   mode,
+			Path:    "/",
+			Expires: time.Now().Add(30 * time.Minute),
+		}
+
+		http.SetCookie(w, &cookie)
+	}
+
 	return p
 }
+
+// reviewMode returns the prompt of the card review, cards without sound are
+// prompted as usual in listening mode
+func reviewMode(p preferences, card primitives.Card) string {
+	switch {
+	case p.Listening && card.SoundURL != "":
+		return primitives.ListeningReview
+	case p.Field >= 0:
+		return primitives.TextReview
+	default:
+		return primitives.ImageReview
+	}
+}
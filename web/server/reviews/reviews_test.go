@@ -0,0 +1,122 @@
+package reviews
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/urlbuilder"
+)
+
+func TestLoadPreferences_mode(t *testing.T) {
+	tcs := []struct {
+		scenario  string
+		query     string
+		cookie    string
+		listening bool
+		saved     string
+	}{
+		{"listening", "?mode=listening", "", true, "listening"},
+		{"image", "?mode=image", "", false, "image"},
+		{"unknown", "?mode=video", "", false, ""},
+		{"listening cookie", "", "listening", true, "listening"},
+		{"unknown cookie", "", "video", false, ""},
+		{"none", "", "", false, ""},
+	}
+
+	deck := primitives.Deck{Fields: []string{"English"}}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/decks/AB34/reviews/new"+tc.query, nil)
+
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "review_mode", Value: tc.cookie})
+			}
+
+			p := loadPreferences(w, r, deck)
+			test.Equal(t, "listening", tc.listening, p.Listening)
+
+			saved := ""
+
+			for _, c := range w.Result().Cookies() {
+				if c.Name == "review_mode" {
+					saved = c.Value
+				}
+			}
+
+			test.Equal(t, "saved mode", tc.saved, saved)
+		})
+	}
+}
+
+func TestCreate_field(t *testing.T) {
+	conn := memory.New()
+	ctx := context.Background()
+
+	ub, err := urlbuilder.New("test")
+	test.OK(t, err)
+
+	user := &primitives.User{Name: "Jane", Email: "jane@example.com"}
+	test.OK(t, conn.Create(ctx, user))
+
+	deck := &primitives.Deck{UserID: user.ID(), Name: "Animals", Fields: []string{"English", "Portuguese"}}
+	test.OK(t, conn.Create(ctx, deck))
+
+	card := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"cat", "gato"}}
+	test.OK(t, conn.Create(ctx, card))
+
+	deckID, err := ub.EncodeID(deck.ID())
+	test.OK(t, err)
+
+	cardID, err := ub.EncodeID(card.ID())
+	test.OK(t, err)
+
+	tcs := []struct {
+		scenario string
+		field    string
+		code     int
+	}{
+		{"field", "1", http.StatusFound},
+		{"missing", "", http.StatusBadRequest},
+		{"invalid", "one", http.StatusBadRequest},
+		{"negative", "-1", http.StatusBadRequest},
+		{"out of range", "2", http.StatusBadRequest},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			form := url.Values{
+				"card_id": {cardID},
+				"mode":    {primitives.ListeningReview},
+				"answer":  {"gato"},
+				"field":   {tc.field},
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/decks/"+deckID+"/reviews", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			h := middlewares.Deck(Create(conn, ub), conn, ub, deckID)
+			res := h(middlewares.NewContext(ctx, user), w, r)
+
+			if rerr, ok := res.(response.Error); ok {
+				test.Equal(t, "status code", tc.code, rerr.Code())
+				return
+			}
+
+			redirect, ok := res.(response.Redirect)
+			test.Equal(t, "redirect", true, ok)
+			test.Equal(t, "status code", tc.code, redirect.Code)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package search
+
+import (
+	"net/http"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
+	ub web.URLBuilder) *http.ServeMux {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[len("/"):]
+		method := r.Method
+
+		var handler response.Handler
+
+		switch {
+		case method == "GET" && path == "":
+			handler = middlewares.Authenticate(Index(db, ub))
+		}
+
+		renderer.Render(handler, w, r)
+	})
+
+	return mux
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+	"net/http"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/html"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+// Index returns a response handler that searches cards across all user decks
+func Index(conn primitives.Database, ub web.URLBuilder) response.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
+
+		user, _ := middlewares.CurrentUser(ctx)
+
+		q := r.URL.Query()
+		query := q.Get("q")
+
+		filters := db.SearchFilters{
+			NSFW: middlewares.NSFW(w, r),
+		}
+
+		decks, err := db.FindDecks(ctx, conn, user.ID())
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to find decks")
+		}
+
+		byID := make(map[primitives.ID]primitives.Deck)
+
+		var decksC []*html.Deck
+
+		for _, d := range decks {
+			byID[d.ID()] = d
+
+			dr, err := html.RenderDeck(ub, d, nil, nil)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to render deck")
+			}
+
+			decksC = append(decksC, dr)
+		}
+
+		// tags belong to a deck, so the tag filter requires one
+		if q.Get("tag") != "" && q.Get("deck") == "" {
+			return response.NewError(http.StatusBadRequest, "tag filter requires a deck")
+		}
+
+		var tags []*html.Tag
+
+		if hash := q.Get("deck"); hash != "" {
+			id, err := ub.ParseID(hash)
+			if err != nil {
+				return response.WrapError(err, http.StatusBadRequest, "invalid deck id")
+			}
+
+			deck, ok := byID[id]
+			if !ok {
+				return response.NewError(http.StatusBadRequest, "wrong deck id")
+			}
+
+			filters.DeckID = id
+
+			deckTags, err := db.FindTags(ctx, conn, id)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to find deck tags")
+			}
+
+			for _, t := range deckTags {
+				tr, err := html.RenderTag(ub, deck, t, nil, false)
+				if err != nil {
+					return response.WrapError(err, http.StatusInternalServerError, "failed to render tag")
+				}
+
+				tags = append(tags, tr)
+			}
+
+			if hash := q.Get("tag"); hash != "" {
+				id, err := ub.ParseID(hash)
+				if err != nil {
+					return response.WrapError(err, http.StatusBadRequest, "invalid tag id")
+				}
+
+				filters.TagID = id
+			}
+		}
+
+		cards, err := db.SearchCards(ctx, conn, user.ID(), query, filters)
+		if err != nil {
+			return response.WrapError(err, http.StatusInternalServerError, "failed to search cards")
+		}
+
+		var cardsC []*html.Card
+
+		for _, c := range cards {
+			deck, ok := byID[c.DeckID]
+			if !ok {
+				continue
+			}
+
+			cr, err := html.RenderCard(ub, deck, nil, c, nil, true)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to render card")
+			}
+
+			cardsC = append(cardsC, cr)
+		}
+
+		content := struct {
+			Query string
+			Deck  string
+			Tag   string
+			NSFW  bool
+			Decks []*html.Deck
+			Tags  []*html.Tag
+			Cards []*html.Card
+		}{
+			Query: query,
+			Deck:  q.Get("deck"),
+			Tag:   q.Get("tag"),
+			NSFW:  filters.NSFW,
+			Decks: decksC,
+			Tags:  tags,
+			Cards: cardsC,
+		}
+
+		page := web.Page{
+			Title:    "Search",
+			Partials: []string{"search"},
+			Content:  content,
+		}
+
+		return response.NewContent(page)
+	}
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/urlbuilder"
+)
+
+func TestIndex(t *testing.T) {
+	conn := memory.New()
+	ctx := context.Background()
+
+	ub, err := urlbuilder.New("test")
+	test.OK(t, err)
+
+	user := &primitives.User{Name: "Jane", Email: "jane@example.com"}
+	test.OK(t, conn.Create(ctx, user))
+
+	deck := &primitives.Deck{UserID: user.ID(), Name: "Animals", Fields: []string{"English"}}
+	test.OK(t, conn.Create(ctx, deck))
+
+	cat := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"black cat"}}
+	dog := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"dog"}}
+	test.OK(t, conn.Create(ctx, cat))
+	test.OK(t, conn.Create(ctx, dog))
+
+	tag := &primitives.Tag{DeckID: deck.ID(), Name: "pets"}
+	test.OK(t, conn.Create(ctx, tag))
+	test.OK(t, conn.Create(ctx, &primitives.CardTag{CardID: dog.ID(), TagID: tag.ID()}))
+
+	deckID, err := ub.EncodeID(deck.ID())
+	test.OK(t, err)
+
+	tagID, err := ub.EncodeID(tag.ID())
+	test.OK(t, err)
+
+	tcs := []struct {
+		scenario string
+		query    string
+		cards    int
+		code     int
+	}{
+		{"query", "?q=CAT", 1, http.StatusOK},
+		{"deck", "?q=dog&deck=" + deckID, 1, http.StatusOK},
+		{"deck and tag", "?q=cat&deck=" + deckID + "&tag=" + tagID, 0, http.StatusOK},
+		{"tag without deck", "?q=dog&tag=" + tagID, 0, http.StatusBadRequest},
+		{"invalid deck", "?q=dog&deck=invalid", 0, http.StatusBadRequest},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/search/"+tc.query, nil)
+
+			res := Index(conn, ub)(middlewares.NewContext(ctx, user), w, r)
+
+			if rerr, ok := res.(response.Error); ok {
+				test.Equal(t, "status code", tc.code, rerr.Code())
+				return
+			}
+
+			test.Equal(t, "status code", tc.code, http.StatusOK)
+
+			page, err := res.Respond(w, r)
+			test.OK(t, err)
+
+			cards := reflect.ValueOf(page.Content).FieldByName("Cards")
+			test.Equal(t, "cards", tc.cards, cards.Len())
+		})
+	}
+}
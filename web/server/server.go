@@ -5,10 +5,12 @@ import (
 
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/web"
+	"gitlab.com/luizbranco/cyberbrain/web/server/admin"
 	"gitlab.com/luizbranco/cyberbrain/web/server/blitline"
 	"gitlab.com/luizbranco/cyberbrain/web/server/decks"
 	"gitlab.com/luizbranco/cyberbrain/web/server/home"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
+	"gitlab.com/luizbranco/cyberbrain/web/server/search"
 	"gitlab.com/luizbranco/cyberbrain/web/server/sessions"
 	"gitlab.com/luizbranco/cyberbrain/web/server/users"
 	"gitlab.com/luizbranco/cyberbrain/worker"
@@ -21,6 +23,12 @@ type Server struct {
 	Authenticator  primitives.Authenticator
 	SessionManager web.SessionManager
 	ImageResizer   worker.ImageResizer
+	Speaker        worker.Speaker
+	BlobStore      primitives.BlobStore
+
+	// BlitlineSecret and BlitlineBucket verify the Blitline callbacks
+	BlitlineSecret string
+	BlitlineBucket string
 }
 
 func (srv *Server) NewServeMux() *http.ServeMux {
@@ -35,7 +43,7 @@ func (srv *Server) NewServeMux() *http.ServeMux {
 	}
 
 	signupMux := users.NewServeMux(renderer, srv.Database, srv.URLBuilder,
-		srv.Authenticator)
+		srv.Authenticator, srv.ImageResizer, srv.BlobStore)
 
 	loginMux := sessions.NewLoginMux(renderer, srv.Database, srv.URLBuilder,
 		srv.Authenticator)
@@ -43,20 +51,32 @@ func (srv *Server) NewServeMux() *http.ServeMux {
 	logoutMux := sessions.NewLogoutMux(renderer)
 
 	decksMux := decks.NewServeMux(renderer, srv.Database, srv.URLBuilder,
-		srv.ImageResizer)
+		srv.ImageResizer, srv.Speaker, srv.BlobStore)
+
+	blitlineMux := blitline.NewServeMux(renderer, srv.Database, srv.URLBuilder,
+		srv.BlitlineSecret, srv.BlitlineBucket)
 
-	blitlineMux := blitline.NewServeMux(renderer, srv.Database, srv.URLBuilder)
+	searchMux := search.NewServeMux(renderer, srv.Database, srv.URLBuilder)
+
+	adminMux := admin.NewServeMux(renderer, srv.Database, srv.URLBuilder)
 
 	mux.Handle("/signup/", http.StripPrefix("/signup", signupMux))
 	mux.Handle("/login/", http.StripPrefix("/login", loginMux))
 	mux.Handle("/logout/", http.StripPrefix("/logout", logoutMux))
 	mux.Handle("/decks/", http.StripPrefix("/decks", decksMux))
 	mux.Handle("/blitline/", http.StripPrefix("/blitline", blitlineMux))
+	mux.Handle("/search/", http.StripPrefix("/search", searchMux))
+	mux.Handle("/admin/", http.StripPrefix("/admin", adminMux))
 
 	mux.HandleFunc("/_healthz/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	// stores keeping blobs locally serve them, others have their own URLs
+	if h, ok := srv.BlobStore.(http.Handler); ok {
+		mux.Handle("/blobs/", http.StripPrefix("/blobs", h))
+	}
+
 	mux.Handle("/", home.NewServeMux(renderer))
 
 	return mux
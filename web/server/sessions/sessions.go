@@ -44,7 +44,7 @@ func Create(conn primitives.Database, ub web.URLBuilder,
 		email := r.Form.Get("email")
 		password := r.Form.Get("password")
 
-		user, err := db.FindUserByEmail(conn, email)
+		user, err := db.FindUserByEmail(ctx, conn, email)
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "user and password combination doesn't match")
 		}
@@ -58,7 +58,7 @@ func Create(conn primitives.Database, ub web.URLBuilder,
 			return response.WrapError(err, http.StatusBadRequest, "user and password combination doesn't match")
 		}
 
-		err = session.LogIn(*user, w)
+		err = session.LogIn(ctx, *user, w)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to log in user")
 		}
@@ -53,7 +53,7 @@ func Create(conn primitives.Database, ub web.URLBuilder) response.Handler {
 			return response.WrapError(err, http.StatusBadRequest, "invalid tag form")
 		}
 
-		err = conn.Create(tag)
+		err = conn.Create(ctx, tag)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create tag")
 		}
@@ -72,7 +72,7 @@ func Show(conn primitives.Database, ub web.URLBuilder, hash string) response.Han
 
 		deck := middlewares.CurrentDeck(ctx)
 
-		tag, cards, err := finder.Tag(conn, ub, hash, finder.WithCards)
+		tag, cards, err := finder.Tag(ctx, conn, ub, hash, finder.WithCards)
 		if err != nil {
 			return err.(response.Error)
 		}
@@ -99,12 +99,12 @@ func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.H
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
-		tag, _, err := finder.Tag(conn, ub, hash, finder.NoOption)
+		tag, _, err := finder.Tag(ctx, conn, ub, hash, finder.NoOption)
 		if err != nil {
 			return err.(response.Error)
 		}
 
-		deck, err := db.FindDeck(conn, tag.DeckID)
+		deck, err := db.FindDeck(ctx, conn, tag.DeckID)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "invalid tag deck")
 		}
@@ -116,7 +116,7 @@ func Update(conn primitives.Database, ub web.URLBuilder, hash string) response.H
 
 		tag.Name = newTag.Name
 
-		err = conn.Update(tag)
+		err = conn.Update(ctx, tag)
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "failed to update tag")
 		}
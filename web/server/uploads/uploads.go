@@ -0,0 +1,142 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+const (
+	// maxRequestSize bounds the whole form, files included
+	maxRequestSize = 16 << 20
+
+	// maxMemory is how much of the form is kept in memory, larger files are
+	// buffered to disk
+	maxMemory = 1 << 20
+)
+
+// Kind restricts the size and content types of an uploaded file
+type Kind struct {
+	Name    string
+	MaxSize int64
+
+	// Types maps the allowed content types, sniffed from the file content,
+	// to the extension of the stored file
+	Types map[string]string
+}
+
+var Image = Kind{
+	Name:    "images",
+	MaxSize: 5 << 20,
+	Types: map[string]string{
+		"image/png":  ".png",
+		"image/jpeg": ".jpg",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	},
+}
+
+var Audio = Kind{
+	Name:    "audio",
+	MaxSize: 10 << 20,
+	Types: map[string]string{
+		"audio/mpeg":      ".mp3",
+		"application/ogg": ".ogg",
+		"audio/wave":      ".wav",
+		"video/webm":      ".webm",
+	},
+}
+
+// ParseForm parses both multipart and url encoded forms
+func ParseForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	err := r.ParseMultipartForm(maxMemory)
+	if err == http.ErrNotMultipart {
+		return r.ParseForm()
+	}
+
+	return err
+}
+
+// Store saves the file sent in the form field to the blob store, setting the
+// urlField form value to its URL. Forms without the file keep the URL sent.
+func Store(ctx context.Context, store primitives.BlobStore, r *http.Request, field, urlField string,
+	kind Kind) error {
+
+	if r.MultipartForm == nil {
+		return nil
+	}
+
+	// empty file inputs are sent without a file name
+	files := r.MultipartForm.File[field]
+	if len(files) == 0 || files[0].Filename == "" {
+		return nil
+	}
+
+	if store == nil {
+		return response.NewError(http.StatusBadRequest, "uploads are not enabled")
+	}
+
+	fh := files[0]
+
+	if fh.Size > kind.MaxSize {
+		msg := fmt.Sprintf("%s cannot be larger than %dMB", field, kind.MaxSize>>20)
+		return response.NewError(http.StatusBadRequest, msg)
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return response.WrapError(err, http.StatusBadRequest, "invalid "+field)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(f, kind.MaxSize))
+	if err != nil {
+		return response.WrapError(err, http.StatusBadRequest, "invalid "+field)
+	}
+
+	ctype := sniff(b)
+
+	ext, ok := kind.Types[ctype]
+	if !ok {
+		msg := fmt.Sprintf("%s has an unsupported type %s", field, ctype)
+		return response.NewError(http.StatusBadRequest, msg)
+	}
+
+	// the same file uploaded twice is stored once
+	key := fmt.Sprintf("uploads/%s/%x%s", kind.Name, sha256.Sum256(b), ext)
+
+	err = store.Put(ctx, key, bytes.NewReader(b), ctype)
+	if err != nil {
+		return response.WrapError(err, http.StatusInternalServerError, "failed to store "+field)
+	}
+
+	r.Form.Set(urlField, store.URL(key))
+
+	return nil
+}
+
+// sniff detects the content type without trusting the one sent by the client
+func sniff(b []byte) string {
+	ctype := http.DetectContentType(b)
+
+	if i := strings.Index(ctype, ";"); i >= 0 {
+		ctype = ctype[:i]
+	}
+
+	// mp3 files without ID3 tags start with a frame sync
+	if ctype == "application/octet-stream" && len(b) > 1 && b[0] == 0xFF && b[1]&0xE0 == 0xE0 {
+		return "audio/mpeg"
+	}
+
+	return ctype
+}
@@ -0,0 +1,142 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s[key] = b
+
+	return nil
+}
+
+func (s memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return nil, primitives.ErrBlobNotFound
+}
+
+func (s memStore) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func (s memStore) URL(key string) string {
+	return "/blobs/" + key
+}
+
+func multipartRequest(t *testing.T, field string, content []byte) *http.Request {
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+
+	test.OK(t, mw.WriteField("image_url", "http://example.com/cat.png"))
+
+	if field != "" {
+		fw, err := mw.CreateFormFile(field, "cat.png")
+		test.OK(t, err)
+
+		_, err = fw.Write(content)
+		test.OK(t, err)
+	}
+
+	test.OK(t, mw.Close())
+
+	r := httptest.NewRequest("POST", "/decks/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return r
+}
+
+func TestStore(t *testing.T) {
+	var img bytes.Buffer
+	test.OK(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 3))))
+
+	testCases := []struct {
+		scenario string
+		field    string
+		content  []byte
+		url      string
+		code     int
+	}{
+		{"no file", "", nil, "http://example.com/cat.png", 0},
+		{"image", "image_file", img.Bytes(), "/blobs/uploads/images/", 0},
+		{"not an image", "image_file", []byte("#!/bin/sh"), "", http.StatusBadRequest},
+		{"too large", "image_file", make([]byte, Image.MaxSize+1), "", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			store := memStore{}
+
+			r := multipartRequest(t, tc.field, tc.content)
+			test.OK(t, ParseForm(httptest.NewRecorder(), r))
+
+			err := Store(context.Background(), store, r, "image_file", "image_url", Image)
+
+			if tc.code != 0 {
+				test.Error(t, err)
+				test.Equal(t, "error code", tc.code, err.(response.Error).Code())
+				return
+			}
+
+			test.OK(t, err)
+
+			got := r.Form.Get("image_url")
+			if !strings.HasPrefix(got, tc.url) {
+				t.Errorf("expected image url %q, got %q", tc.url, got)
+			}
+
+			if tc.field != "" {
+				test.Equal(t, "stored files", 1, len(store))
+				test.Equal(t, "extension", true, strings.HasSuffix(got, ".png"))
+			}
+		})
+	}
+
+	t.Run("url encoded form", func(t *testing.T) {
+		form := url.Values{"image_url": {"http://example.com/cat.png"}}
+
+		r := httptest.NewRequest("POST", "/decks/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		test.OK(t, ParseForm(httptest.NewRecorder(), r))
+		test.OK(t, Store(context.Background(), nil, r, "image_file", "image_url", Image))
+		test.Equal(t, "image url", "http://example.com/cat.png", r.Form.Get("image_url"))
+	})
+}
+
+func TestSniff(t *testing.T) {
+	testCases := []struct {
+		content []byte
+		ctype   string
+	}{
+		{[]byte("ID3\x03\x00"), "audio/mpeg"},
+		{[]byte{0xFF, 0xFB, 0x90, 0x00}, "audio/mpeg"},
+		{[]byte("OggS\x00\x02"), "application/ogg"},
+		{[]byte("hello"), "text/plain"},
+	}
+
+	for _, tc := range testCases {
+		test.Equal(t, string(tc.content), tc.ctype, sniff(tc.content))
+	}
+}
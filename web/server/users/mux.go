@@ -7,10 +7,12 @@ import (
 	"gitlab.com/luizbranco/cyberbrain/web"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
-	ub web.URLBuilder, auth primitives.Authenticator) *http.ServeMux {
+	ub web.URLBuilder, auth primitives.Authenticator, resizer worker.ImageResizer,
+	store primitives.BlobStore) *http.ServeMux {
 
 	mux := http.NewServeMux()
 
@@ -24,7 +26,7 @@ func NewServeMux(renderer *middlewares.Renderer, db primitives.Database,
 		case method == "GET" && path == "":
 			handler = New(db, ub)
 		case method == "POST" && path == "":
-			handler = Create(db, ub, auth, renderer.SessionManager)
+			handler = Create(db, ub, auth, renderer.SessionManager, resizer, store)
 		}
 
 		renderer.Render(handler, w, r)
@@ -9,6 +9,8 @@ import (
 	"gitlab.com/luizbranco/cyberbrain/web/html"
 	"gitlab.com/luizbranco/cyberbrain/web/server/middlewares"
 	"gitlab.com/luizbranco/cyberbrain/web/server/response"
+	"gitlab.com/luizbranco/cyberbrain/web/server/uploads"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
@@ -28,8 +30,8 @@ func New(conn primitives.Database, ub web.URLBuilder) response.Handler {
 	}
 }
 
-func Create(conn primitives.Database, ub web.URLBuilder,
-	auth primitives.Authenticator, session web.SessionManager) response.Handler {
+func Create(conn primitives.Database, ub web.URLBuilder, auth primitives.Authenticator,
+	session web.SessionManager, resizer worker.ImageResizer, store primitives.BlobStore) response.Handler {
 
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) response.Responder {
 
@@ -37,21 +39,38 @@ func Create(conn primitives.Database, ub web.URLBuilder,
 			return response.Redirect{Path: "/", Code: http.StatusFound}
 		}
 
-		if err := r.ParseForm(); err != nil {
+		if err := uploads.ParseForm(w, r); err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid form")
 		}
 
+		err := uploads.Store(ctx, store, r, "image_file", "image_url", uploads.Image)
+		if err != nil {
+			return err.(response.Error)
+		}
+
 		user, err := html.NewUserFromForm(r.Form, auth)
 		if err != nil {
 			return response.WrapError(err, http.StatusBadRequest, "invalid user form")
 		}
 
-		err = conn.Create(user)
+		err = conn.Create(ctx, user)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to create user")
 		}
 
-		err = session.LogIn(*user, w)
+		if user.ImageURL != "" {
+			hash, err := ub.EncodeID(user.ID())
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to encode user id")
+			}
+
+			err = resizer.Resize(ctx, user, hash, worker.UserImageSizes)
+			if err != nil {
+				return response.WrapError(err, http.StatusInternalServerError, "failed to enqueue avatar resize job")
+			}
+		}
+
+		err = session.LogIn(ctx, *user, w)
 		if err != nil {
 			return response.WrapError(err, http.StatusInternalServerError, "failed to log in user")
 		}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
@@ -16,12 +17,12 @@ type Manager struct {
 	Secret   string
 }
 
-func (m *Manager) LogIn(u primitives.User, w http.ResponseWriter) error {
+func (m *Manager) LogIn(ctx context.Context, u primitives.User, w http.ResponseWriter) error {
 	s := &session{
 		UserID: u.ID(),
 	}
 
-	err := m.Database.Create(s)
+	err := m.Database.Create(ctx, s)
 	if err != nil {
 		return errors.Wrap(err, "failed to create session")
 	}
@@ -56,6 +57,8 @@ func (m *Manager) LogOut(w http.ResponseWriter) {
 }
 
 func (m *Manager) User(r *http.Request) (*primitives.User, error) {
+	ctx := r.Context()
+
 	var value string
 
 	cookie, err := r.Cookie(cookieName)
@@ -78,12 +81,12 @@ func (m *Manager) User(r *http.Request) (*primitives.User, error) {
 		return nil, errors.Wrap(err, "failed to read session id")
 	}
 
-	s, err := findSession(m.Database, primitives.ID(n))
+	s, err := findSession(ctx, m.Database, primitives.ID(n))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to find session")
 	}
 
-	user, err := db.FindUser(m.Database, s.UserID)
+	user, err := db.FindUser(ctx, m.Database, s.UserID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to find user")
 	}
@@ -91,10 +94,10 @@ func (m *Manager) User(r *http.Request) (*primitives.User, error) {
 	return user, nil
 }
 
-func findSession(db primitives.Database, id primitives.ID) (*session, error) {
+func findSession(ctx context.Context, db primitives.Database, id primitives.ID) (*session, error) {
 	q := &query{id: id}
 
-	r, err := db.Get(q)
+	r, err := db.Get(ctx, q)
 	if err != nil {
 		return nil, err
 	}
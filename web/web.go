@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"io"
 	"net/http"
 
@@ -28,7 +29,7 @@ type URLBuilder interface {
 }
 
 type SessionManager interface {
-	LogIn(primitives.User, http.ResponseWriter) error
+	LogIn(context.Context, primitives.User, http.ResponseWriter) error
 	LogOut(http.ResponseWriter)
 	User(*http.Request) (*primitives.User, error)
 }
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// FindJobs returns the jobs with the given state and name, the most recent
+// first. Empty filters match every job.
+func FindJobs(ctx context.Context, conn primitives.Database, state, name string) ([]*Job, error) {
+	q := &jobQuery{where: make(map[string]interface{})}
+
+	if state != "" {
+		q.where["state"] = state
+	}
+
+	if name != "" {
+		q.where["name"] = name
+	}
+
+	rs, err := conn.Query(ctx, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find jobs")
+	}
+
+	var jobs []*Job
+
+	for _, r := range rs {
+		job, ok := r.(*Job)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func FindJob(ctx context.Context, conn primitives.Database, id primitives.ID) (*Job, error) {
+	q := &jobQuery{where: map[string]interface{}{"id": id}}
+
+	r, err := conn.Get(ctx, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find job %d", id)
+	}
+
+	job, ok := r.(*Job)
+	if !ok {
+		return nil, errors.Errorf("invalid record type %T", r)
+	}
+
+	return job, nil
+}
+
+// RetryJob schedules the job to run now with a fresh set of attempts
+func RetryJob(ctx context.Context, conn primitives.Database, j *Job) error {
+	if !j.Retryable() {
+		return errors.Errorf("job %d is %s and cannot be retried", j.ID(), j.State)
+	}
+
+	q := &transitionQuery{id: j.ID(), from: retryableStates, to: scheduled, reset: true, now: time.Now()}
+
+	return transition(ctx, conn, j, q, "retried")
+}
+
+// CancelJob stops a job waiting to run from being claimed by the pools
+func CancelJob(ctx context.Context, conn primitives.Database, j *Job) error {
+	if !j.Cancelable() {
+		return errors.Errorf("job %d is %s and cannot be canceled", j.ID(), j.State)
+	}
+
+	q := &transitionQuery{id: j.ID(), from: cancelableStates, to: canceled, now: time.Now()}
+
+	return transition(ctx, conn, j, q, "canceled")
+}
+
+// transition changes the job state only if it is still in one of the states
+// allowed, as a pool may have claimed it since it was read
+func transition(ctx context.Context, conn primitives.Database, j *Job, q *transitionQuery,
+	action string) error {
+
+	rs, err := conn.QueryRaw(ctx, q)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update job %d", j.ID())
+	}
+
+	if len(rs) == 0 {
+		return errors.Errorf("job %d changed state and cannot be %s", j.ID(), action)
+	}
+
+	updated, ok := rs[0].(*Job)
+	if !ok {
+		return errors.Errorf("invalid record type %T", rs[0])
+	}
+
+	*j = *updated
+
+	return nil
+}
+
+func DeleteJob(ctx context.Context, conn primitives.Database, j *Job) error {
+	if !j.Deletable() {
+		return errors.Errorf("job %d is %s and cannot be deleted", j.ID(), j.State)
+	}
+
+	return conn.Delete(ctx, j)
+}
+
+type jobQuery struct {
+	where map[string]interface{}
+}
+
+func (q *jobQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *jobQuery) Where() map[string]interface{} {
+	return q.where
+}
+
+func (q *jobQuery) Raw() string {
+	return ""
+}
+
+func (q *jobQuery) SortBy() map[string]string {
+	return map[string]string{
+		"created_at": "DESC",
+	}
+}
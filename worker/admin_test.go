@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestFindJobs(t *testing.T) {
+	ctx := context.Background()
+
+	conn := memory.New()
+
+	for _, j := range []*Job{
+		{Name: "resize", State: failed},
+		{Name: "resize", State: done},
+		{Name: "mail", State: failed},
+	} {
+		test.OK(t, conn.Create(ctx, j))
+	}
+
+	testCases := []struct {
+		scenario string
+		state    string
+		name     string
+		count    int
+	}{
+		{"all", "", "", 3},
+		{"by state", failed, "", 2},
+		{"by name", "", "resize", 2},
+		{"by state and name", failed, "mail", 1},
+		{"none", running, "", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			jobs, err := FindJobs(ctx, conn, tc.state, tc.name)
+			test.OK(t, err)
+			test.Equal(t, "jobs", tc.count, len(jobs))
+		})
+	}
+}
+
+func TestJobActions(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		action   func(context.Context, primitives.Database, *Job) error
+		state    string
+		want     string
+		fail     bool
+	}{
+		{"retry failed", RetryJob, failed, scheduled, false},
+		{"retry canceled", RetryJob, canceled, scheduled, false},
+		{"retry running", RetryJob, running, running, true},
+		{"retry done", RetryJob, done, done, true},
+		{"cancel scheduled", CancelJob, scheduled, canceled, false},
+		{"cancel retry", CancelJob, retry, canceled, false},
+		{"cancel failed", CancelJob, failed, failed, true},
+		{"delete running", DeleteJob, running, running, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			eachDatabase(t, func(t *testing.T, conn primitives.Database) {
+				ctx := context.Background()
+
+				job := &Job{
+					Name:  "resize",
+					State: tc.state,
+					Tries: 3,
+					Error: "timeout",
+					RunAt: time.Now().Add(time.Hour),
+				}
+				test.OK(t, conn.Create(ctx, job))
+
+				err := tc.action(ctx, conn, job)
+				if tc.fail {
+					test.Error(t, err)
+				} else {
+					test.OK(t, err)
+				}
+
+				got, err := FindJob(ctx, conn, job.ID())
+				test.OK(t, err)
+				test.Equal(t, "state", tc.want, got.State)
+
+				if tc.want == scheduled {
+					test.Equal(t, "tries", 0, got.Tries)
+					test.Equal(t, "error", "", got.Error)
+
+					if got.RunAt.After(time.Now()) {
+						t.Errorf("expected job to run now, got %s", got.RunAt)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestJobActions_claimed(t *testing.T) {
+	ctx := context.Background()
+
+	conn := memory.New()
+
+	job := &Job{Name: "resize", State: scheduled}
+	test.OK(t, conn.Create(ctx, job))
+
+	// claimed by a pool after the job was read
+	claimed := *job
+	claimed.State = running
+	test.OK(t, conn.Update(ctx, &claimed))
+
+	test.Error(t, CancelJob(ctx, conn, job))
+
+	got, err := FindJob(ctx, conn, job.ID())
+	test.OK(t, err)
+	test.Equal(t, "state", running, got.State)
+}
+
+func TestDeleteJob(t *testing.T) {
+	ctx := context.Background()
+
+	conn := memory.New()
+
+	job := &Job{Name: "resize", State: failed}
+	test.OK(t, conn.Create(ctx, job))
+
+	test.OK(t, DeleteJob(ctx, conn, job))
+
+	_, err := FindJob(ctx, conn, job.ID())
+	test.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cron is a parsed cron expression with the five standard fields, minute,
+// hour, day of month, month and day of week, evaluated in UTC. Sunday is
+// either 0 or 7.
+type Cron struct {
+	minute, hour, dom, month, dow map[int]bool
+
+	// the day matches if either the day of month or day of week does when
+	// both are restricted, like in cron(8)
+	anyDOM, anyDOW bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseCron parses expressions like "30 3 * * *", "*/15 * * * 1-5" or
+// "@daily"
+func ParseCron(spec string) (*Cron, error) {
+	if s, ok := cronShortcuts[spec]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid cron expression %q, expected 5 fields", spec)
+	}
+
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+	var sets []map[int]bool
+
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron expression %q", spec)
+		}
+
+		sets = append(sets, set)
+	}
+
+	if sets[4][7] {
+		delete(sets[4], 7)
+		sets[4][0] = true
+	}
+
+	c := &Cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDOM: fields[2] == "*",
+		anyDOW: fields[4] == "*",
+	}
+
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid step %q", part)
+			}
+
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, errors.Errorf("invalid range %q", part)
+			}
+
+			hi, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, errors.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, errors.Errorf("invalid value %q", part)
+			}
+
+			lo = n
+
+			// 5/10 is short for 5-59/10
+			if step == 1 {
+				hi = n
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, errors.Errorf("value out of range %q", part)
+		}
+
+		for n := lo; n <= hi; n += step {
+			set[n] = true
+		}
+	}
+
+	return set, nil
+}
+
+// Next returns the first time after t matching the expression
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// every schedule repeats within a few years, leap days included
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if !c.day(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if !c.hour[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) day(t time.Time) bool {
+	dom := c.dom[t.Day()]
+	dow := c.dow[int(t.Weekday())]
+
+	switch {
+	case c.anyDOM && c.anyDOW:
+		return true
+	case c.anyDOM:
+		return dow
+	case c.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
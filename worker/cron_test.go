@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestCron_Next(t *testing.T) {
+	// Monday
+	now := time.Date(2018, time.September, 3, 10, 20, 30, 0, time.UTC)
+
+	testCases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.September, 3, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2018, time.September, 3, 10, 30, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2018, time.September, 4, 3, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2018, time.September, 4, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2018, time.September, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2018, time.September, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2018, time.September, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2018, time.September, 3, 10, 25, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2018, time.September, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5-7", time.Date(2018, time.September, 7, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			c, err := ParseCron(tc.spec)
+			test.OK(t, err)
+
+			test.Equal(t, "next", tc.next, c.Next(now))
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := ParseCron(spec)
+		test.Error(t, err)
+	}
+}
@@ -1,13 +1,56 @@
 package worker
 
-import "gitlab.com/luizbranco/cyberbrain/primitives"
+import (
+	"context"
+
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
 
 type Imager interface {
 	primitives.Identifiable
 	GetImageURL() string
 	SetImageURL(string)
+	SetImageVariant(name, url string)
 }
 
 type ImageResizer interface {
-	Resize(i Imager, name string, width int, height int) error
+	Resize(ctx context.Context, i Imager, name string, sizes []ImageSize) error
+}
+
+// Speaker generates the pronunciation audio of the cards
+type Speaker interface {
+	Speak(ctx context.Context, card *primitives.Card) error
+	SpeakDeck(ctx context.Context, deck *primitives.Deck) error
 }
+
+// FullSize is the image size replacing the record image URL, the other sizes
+// are stored as its variants
+const FullSize = "full"
+
+// ImageSize is a named output of the image resizers
+type ImageSize struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var (
+	// CardImageSizes go from the deck grid thumbnail up to the 2x variant,
+	// double the full size, for high density screens
+	CardImageSizes = []ImageSize{
+		{Name: FullSize, Width: 800, Height: 600},
+		{Name: "thumb", Width: 200, Height: 150},
+		{Name: "review", Width: 640, Height: 480},
+		{Name: "2x", Width: 1600, Height: 1200},
+	}
+
+	DeckImageSizes = []ImageSize{
+		{Name: FullSize, Width: 400, Height: 300},
+		{Name: "thumb", Width: 200, Height: 150},
+	}
+
+	UserImageSizes = []ImageSize{
+		{Name: FullSize, Width: 256, Height: 256},
+		{Name: "thumb", Width: 64, Height: 64},
+	}
+)
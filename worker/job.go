@@ -12,8 +12,12 @@ const (
 	done      = "done"
 	retry     = "retry"
 	failed    = "failed"
+	canceled  = "canceled"
 )
 
+// States lists the job states, in the order they are shown to admins
+var States = []string{failed, retry, scheduled, running, done, canceled}
+
 type Job struct {
 	MetaID        primitives.ID `db:"id"`
 	MetaVersion   int           `db:"version"`
@@ -26,6 +30,49 @@ type Job struct {
 	Args  []byte    `db:"args"`
 	Error string    `db:"error"`
 	Tries int       `db:"tries"`
+
+	// LeaseUntil is extended by the pool running the job, a running job with
+	// an expired lease was abandoned and can be claimed again
+	LeaseUntil time.Time `db:"lease_until"`
+
+	// UniqueKey allows a single pending job with the same key, enqueuing
+	// another one replaces its args
+	UniqueKey string `db:"unique_key"`
+}
+
+var (
+	// retryableStates can be scheduled to run again now, jobs running are
+	// owned by a pool until they finish or their lease expires and jobs done
+	// aren't run twice
+	retryableStates = []string{scheduled, retry, failed, canceled}
+
+	// cancelableStates are still waiting to run
+	cancelableStates = []string{scheduled, retry}
+)
+
+// Retryable reports whether the job can be scheduled to run again now
+func (j Job) Retryable() bool {
+	return hasState(j, retryableStates)
+}
+
+// Cancelable reports whether the job is still waiting to run
+func (j Job) Cancelable() bool {
+	return hasState(j, cancelableStates)
+}
+
+func hasState(j Job, states []string) bool {
+	for _, s := range states {
+		if j.State == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Deletable reports whether the job can be removed from the database
+func (j Job) Deletable() bool {
+	return j.State != running
 }
 
 func (j Job) ID() primitives.ID {
@@ -0,0 +1,248 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxDownloadSize is the largest image file accepted
+	maxDownloadSize = 10 << 20
+
+	// maxPixels guards against small files decoding into huge images
+	maxPixels = 50 * 1000 * 1000
+)
+
+type JobArgs struct {
+	ImagerType string
+	ImagerID   primitives.ID
+	ImageURL   string
+	SourceKey  string
+	Name       string
+	Sizes      []worker.ImageSize
+}
+
+// key is the blob key of the image size, the full size keeps the record name
+func (a JobArgs) key(size string) string {
+	if size == worker.FullSize {
+		return fmt.Sprintf("%ss/%s.png", a.ImagerType, a.Name)
+	}
+
+	return fmt.Sprintf("%ss/%s-%s.png", a.ImagerType, a.Name, size)
+}
+
+// UniqueKey keeps a single pending resize per record, so the latest image
+// wins when it changes again before the job runs
+func (a JobArgs) UniqueKey() string {
+	return fmt.Sprintf("%s:%s:%d", workerName, a.ImagerType, a.ImagerID)
+}
+
+type Job struct {
+	args   JobArgs
+	store  primitives.BlobStore
+	db     primitives.Database
+	client *http.Client
+}
+
+func (j *Job) Run(ctx context.Context) error {
+	src, err := j.download(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, size := range j.args.Sizes {
+		img := fill(src, size.Width, size.Height)
+
+		var buf bytes.Buffer
+
+		err = png.Encode(&buf, img)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode png")
+		}
+
+		key := j.args.key(size.Name)
+
+		err = j.store.Put(ctx, key, &buf, "image/png")
+		if err != nil {
+			return errors.Wrapf(err, "failed to store image %q", key)
+		}
+	}
+
+	imager, err := j.find(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the image changed after the job was enqueued, the newer job updates it
+	if imager.GetImageURL() != j.args.ImageURL {
+		return nil
+	}
+
+	for _, size := range j.args.Sizes {
+		url := j.store.URL(j.args.key(size.Name))
+
+		if size.Name == worker.FullSize {
+			imager.SetImageURL(url)
+		} else {
+			imager.SetImageVariant(size.Name, url)
+		}
+	}
+
+	err = j.db.Update(ctx, imager)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update %s %d image", j.args.ImagerType, j.args.ImagerID)
+	}
+
+	return nil
+}
+
+func (j *Job) download(ctx context.Context) (image.Image, error) {
+	b, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, worker.Permanent(errors.Wrapf(err, "failed to decode image %q", j.args.ImageURL))
+	}
+
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, worker.Permanent(errors.Errorf("image %q too large %dx%d", j.args.ImageURL,
+			cfg.Width, cfg.Height))
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, worker.Permanent(errors.Wrapf(err, "failed to decode image %q", j.args.ImageURL))
+	}
+
+	return img, nil
+}
+
+// fetch reads the image from the blob store when it was uploaded, otherwise
+// downloads it
+func (j *Job) fetch(ctx context.Context) ([]byte, error) {
+	if j.args.SourceKey != "" {
+		r, err := j.store.Get(ctx, j.args.SourceKey)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to read image %q", j.args.SourceKey)
+
+			if errors.Cause(err) == primitives.ErrBlobNotFound {
+				return nil, worker.Permanent(err)
+			}
+
+			return nil, err
+		}
+		defer r.Close()
+
+		return read(r, j.args.SourceKey)
+	}
+
+	req, err := http.NewRequest("GET", j.args.ImageURL, nil)
+	if err != nil {
+		return nil, worker.Permanent(errors.Wrapf(err, "invalid image url %q", j.args.ImageURL))
+	}
+
+	req = req.WithContext(ctx)
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download image %q", j.args.ImageURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errors.Errorf("failed to download image %q [%d]", j.args.ImageURL, resp.StatusCode)
+
+		// client errors won't succeed on a retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, worker.Permanent(err)
+		}
+
+		return nil, err
+	}
+
+	return read(resp.Body, j.args.ImageURL)
+}
+
+func read(r io.Reader, name string) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxDownloadSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read image %q", name)
+	}
+
+	if len(b) > maxDownloadSize {
+		return nil, worker.Permanent(errors.Errorf("image %q larger than %d bytes", name, maxDownloadSize))
+	}
+
+	return b, nil
+}
+
+// imagerRecord is an imager that can be updated in the database
+type imagerRecord interface {
+	primitives.Record
+	GetImageURL() string
+	SetImageURL(string)
+	SetImageVariant(name, url string)
+}
+
+func (j *Job) find(ctx context.Context) (imagerRecord, error) {
+	var imager imagerRecord
+	var err error
+
+	switch j.args.ImagerType {
+	case "card":
+		imager, err = db.FindCard(ctx, j.db, j.args.ImagerID)
+	case "deck":
+		imager, err = db.FindDeck(ctx, j.db, j.args.ImagerID)
+	case "user":
+		imager, err = db.FindUser(ctx, j.db, j.args.ImagerID)
+	default:
+		return nil, worker.Permanent(errors.Errorf("invalid imager type %q", j.args.ImagerType))
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find %s %d", j.args.ImagerType, j.args.ImagerID)
+	}
+
+	return imager, nil
+}
+
+// fill scales the image to cover width x height, cropping the center of the
+// side that doesn't fit, like Blitline resize_to_fill
+func fill(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	crop := b
+
+	if b.Dx()*height > b.Dy()*width {
+		w := b.Dy() * width / height
+		x := b.Min.X + (b.Dx()-w)/2
+		crop = image.Rect(x, b.Min.Y, x+w, b.Max.Y)
+	} else {
+		h := b.Dx() * height / width
+		y := b.Min.Y + (b.Dy()-h)/2
+		crop = image.Rect(b.Min.X, y, b.Max.X, y+h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,170 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s[key] = b
+
+	return nil
+}
+
+func (s memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := s[key]
+	if !ok {
+		return nil, primitives.ErrBlobNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s memStore) Delete(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func (s memStore) URL(key string) string {
+	return "/blobs/" + key
+}
+
+func TestFill(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		width    int
+		height   int
+	}{
+		{"wider", 800, 300},
+		{"taller", 400, 900},
+		{"smaller", 40, 30},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, tc.width, tc.height))
+
+			// only the center of wide images is kept
+			for x := 0; x < tc.width; x++ {
+				for y := 0; y < tc.height; y++ {
+					c := color.RGBA{0, 0, 255, 255}
+					if x < tc.width/8 || x >= tc.width*7/8 {
+						c = color.RGBA{255, 0, 0, 255}
+					}
+					src.Set(x, y, c)
+				}
+			}
+
+			img := fill(src, 400, 300)
+
+			test.Equal(t, "bounds", image.Rect(0, 0, 400, 300), img.Bounds())
+
+			if tc.scenario == "wider" {
+				r, _, _, _ := img.At(0, 150).RGBA()
+				test.Equal(t, "cropped sides", uint32(0), r)
+			}
+		})
+	}
+}
+
+func TestJob_Run(t *testing.T) {
+	var buf bytes.Buffer
+	test.OK(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 600))))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Write(buf.Bytes())
+		case "/text":
+			w.Write([]byte("not an image"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		scenario  string
+		path      string
+		key       string
+		permanent bool
+	}{
+		{"ok", "/cat.png", "", false},
+		{"not found", "/missing.png", "", true},
+		{"not an image", "/text", "", true},
+		{"uploaded", "/blobs/uploads/cat.png", "uploads/cat.png", false},
+		{"upload not found", "/blobs/uploads/dog.png", "uploads/dog.png", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := context.Background()
+
+			conn := memory.New()
+			store := memStore{"uploads/cat.png": buf.Bytes()}
+
+			card := &primitives.Card{DeckID: 1, ImageURL: srv.URL + tc.path}
+			test.OK(t, conn.Create(ctx, card))
+
+			job := &Job{
+				args: JobArgs{
+					ImagerType: "card",
+					ImagerID:   card.ID(),
+					ImageURL:   card.ImageURL,
+					SourceKey:  tc.key,
+					Name:       "AB34",
+					Sizes:      worker.CardImageSizes,
+				},
+				store:  store,
+				db:     conn,
+				client: srv.Client(),
+			}
+
+			err := job.Run(ctx)
+
+			found, ferr := db.FindCard(ctx, conn, card.ID())
+			test.OK(t, ferr)
+
+			if tc.permanent {
+				test.Error(t, err)
+				test.Equal(t, "permanent error", true, worker.IsPermanent(err))
+				test.Equal(t, "image url", card.ImageURL, found.ImageURL)
+				return
+			}
+
+			test.OK(t, err)
+			test.Equal(t, "image url", "/blobs/cards/AB34.png", found.ImageURL)
+
+			img, err := png.Decode(bytes.NewReader(store["cards/AB34.png"]))
+			test.OK(t, err)
+			test.Equal(t, "resized bounds", image.Rect(0, 0, 800, 600), img.Bounds())
+
+			test.Equal(t, "thumb url", "/blobs/cards/AB34-thumb.png", found.GetImageVariant("thumb"))
+
+			img, err = png.Decode(bytes.NewReader(store["cards/AB34-thumb.png"]))
+			test.OK(t, err)
+			test.Equal(t, "thumb bounds", image.Rect(0, 0, 200, 150), img.Bounds())
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+const workerName = "img-resize-local"
+
+// Worker resizes images in process, without external services, storing them
+// in the Store and updating the imager URL in the database. PNG, JPEG, GIF and
+// WebP images are decoded, the sizes are always encoded as PNG since there is
+// no pure Go WebP encoder.
+type Worker struct {
+	Store      primitives.BlobStore
+	Database   primitives.Database
+	WorkerPool primitives.WorkerPool
+
+	// Client downloads the original images, defaults to a client with a 30
+	// seconds timeout
+	Client *http.Client
+}
+
+func (w *Worker) Register() error {
+	if w.WorkerPool == nil {
+		return errors.New("invalid worker pool")
+	}
+
+	if w.Store == nil {
+		return errors.New("invalid blob store")
+	}
+
+	if w.Database == nil {
+		return errors.New("invalid database")
+	}
+
+	err := w.WorkerPool.Register(workerName, w)
+	if err != nil {
+		return errors.Wrap(err, "failed to register local image resize worker")
+	}
+
+	return nil
+}
+
+func (w *Worker) Resize(ctx context.Context, i worker.Imager, name string, sizes []worker.ImageSize) error {
+
+	if w.WorkerPool == nil {
+		return errors.New("invalid worker pool")
+	}
+
+	url := i.GetImageURL()
+
+	args := JobArgs{
+		ImagerType: i.Type(),
+		ImagerID:   i.ID(),
+		ImageURL:   url,
+		Name:       name,
+		Sizes:      sizes,
+	}
+
+	// uploaded images are read from the store, their URL may be relative
+	if w.Store != nil {
+		prefix := w.Store.URL("")
+		if strings.HasPrefix(url, prefix) {
+			args.SourceKey = strings.TrimPrefix(url, prefix)
+		}
+	}
+
+	err := w.WorkerPool.Enqueue(ctx, workerName, args)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enqueue local image resize worker %q %q", url, name)
+	}
+
+	return nil
+}
+
+// Timeout bounds the download, resize and upload of a single image
+func (w *Worker) Timeout() time.Duration {
+	return 2 * time.Minute
+}
+
+func (w *Worker) Spawn(b []byte) (primitives.Job, error) {
+	args := JobArgs{}
+
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal args")
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	j := &Job{
+		args:   args,
+		store:  w.Store,
+		db:     w.Database,
+		client: client,
+	}
+
+	return j, nil
+}
@@ -0,0 +1,111 @@
+package mirror
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// privateNetworks are the loopback, link-local, private and reserved ranges
+// the image URLs given by users must not reach
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+// errPrivateAddress is returned when dialing a private address
+type errPrivateAddress string
+
+func (e errPrivateAddress) Error() string {
+	return "address " + string(e) + " is not public"
+}
+
+// publicClient returns a client connecting only to public addresses. The
+// address is checked after the host is resolved, so DNS names and redirects
+// pointing to private networks are refused as well.
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || private(ip) {
+				return errPrivateAddress(host)
+			}
+
+			return nil
+		},
+	}
+
+	// proxies aren't used, they would be the address checked
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func private(ip net.IP) bool {
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPrivateAddress reports whether a request failed dialing a private address
+func isPrivateAddress(err error) bool {
+	err = errors.Cause(err)
+
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+	}
+
+	_, ok := err.(errPrivateAddress)
+
+	return ok
+}
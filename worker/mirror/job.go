@@ -0,0 +1,187 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+// maxDownloadSize is the largest image file mirrored
+const maxDownloadSize = 10 << 20
+
+// imageTypes are the content types mirrored and their file extensions
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type JobArgs struct {
+	CardID   primitives.ID
+	ImageURL string
+
+	// Name and Sizes resize the mirrored image, jobs without a name, enqueued
+	// by older sweeps, aren't resized
+	Name  string
+	Sizes []worker.ImageSize
+}
+
+// UniqueKey keeps a single pending mirror per card, so the latest image wins
+// when it changes again before the job runs
+func (a JobArgs) UniqueKey() string {
+	return fmt.Sprintf("%s:%d", workerName, a.CardID)
+}
+
+type Job struct {
+	args    JobArgs
+	store   primitives.BlobStore
+	db      primitives.Database
+	resizer worker.ImageResizer
+	client  *http.Client
+}
+
+func (j *Job) Run(ctx context.Context) error {
+	card, err := j.current(ctx)
+	if err != nil || card == nil {
+		return err
+	}
+
+	b, ext, err := j.download(ctx)
+	if err != nil {
+		return j.unreachable(ctx, err)
+	}
+
+	key := fmt.Sprintf("mirrors/%x%s", sha256.Sum256(b), ext)
+
+	err = j.store.Put(ctx, key, bytes.NewReader(b), http.DetectContentType(b))
+	if err != nil {
+		return errors.Wrapf(err, "failed to store image %q", key)
+	}
+
+	// the card is read again, so the edits made during the download are kept
+	card, err = j.current(ctx)
+	if err != nil || card == nil {
+		return err
+	}
+
+	card.ImageSourceURL = j.args.ImageURL
+	card.ImageURL = j.store.URL(key)
+	card.ImageUnreachable = false
+
+	err = j.db.Update(ctx, card)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update card %d image", card.ID())
+	}
+
+	if j.args.Name == "" {
+		return nil
+	}
+
+	err = j.resizer.Resize(ctx, card, j.args.Name, j.args.Sizes)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resize card %d image", card.ID())
+	}
+
+	return nil
+}
+
+// download fetches the image, returning its content and file extension
+func (j *Job) download(ctx context.Context) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", j.args.ImageURL, nil)
+	if err != nil {
+		return nil, "", worker.Permanent(errors.Wrapf(err, "invalid image url %q", j.args.ImageURL))
+	}
+
+	req = req.WithContext(ctx)
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to download image %q", j.args.ImageURL)
+
+		if isPrivateAddress(err) {
+			return nil, "", worker.Permanent(err)
+		}
+
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errors.Errorf("failed to download image %q [%d]", j.args.ImageURL, resp.StatusCode)
+
+		// client errors won't succeed on a retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, "", worker.Permanent(err)
+		}
+
+		return nil, "", err
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read image %q", j.args.ImageURL)
+	}
+
+	if len(b) > maxDownloadSize {
+		return nil, "", worker.Permanent(errors.Errorf("image %q larger than %d bytes",
+			j.args.ImageURL, maxDownloadSize))
+	}
+
+	// the header is often wrong, the content decides
+	ctype := http.DetectContentType(b)
+
+	ext, ok := imageTypes[ctype]
+	if !ok {
+		return nil, "", worker.Permanent(errors.Errorf("invalid image %q content type %q",
+			j.args.ImageURL, ctype))
+	}
+
+	return b, ext, nil
+}
+
+// current returns the card as it is now, or nil when its image changed after
+// the job was enqueued and a newer job mirrors it
+func (j *Job) current(ctx context.Context) (*primitives.Card, error) {
+	card, err := db.FindCard(ctx, j.db, j.args.CardID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find card %d", j.args.CardID)
+	}
+
+	if card.ImageURL != j.args.ImageURL {
+		return nil, nil
+	}
+
+	return card, nil
+}
+
+// unreachable flags the card image as unreachable, returning the download
+// error so the job is retried unless it is permanent
+func (j *Job) unreachable(ctx context.Context, err error) error {
+	card, cerr := j.current(ctx)
+	if cerr != nil {
+		return cerr
+	}
+
+	if card == nil || card.ImageUnreachable {
+		return err
+	}
+
+	card.ImageUnreachable = true
+
+	uerr := j.db.Update(ctx, card)
+	if uerr != nil {
+		return errors.Wrapf(uerr, "failed to flag card %d image as unreachable", card.ID())
+	}
+
+	return err
+}
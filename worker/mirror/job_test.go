@@ -0,0 +1,198 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+func TestJob_Run(t *testing.T) {
+	var buf bytes.Buffer
+	test.OK(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Write(buf.Bytes())
+		case "/page":
+			w.Write([]byte("<html>moved</html>"))
+		case "/down":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		scenario    string
+		path        string
+		name        string
+		changed     bool
+		err         bool
+		permanent   bool
+		unreachable bool
+		resized     bool
+	}{
+		{"mirrored and resized", "/cat.png", "AB34", false, false, false, false, true},
+		{"mirrored by the sweep", "/cat.png", "", false, false, false, false, false},
+		{"image changed", "/cat.png", "AB34", true, false, false, false, false},
+		{"not found", "/missing.png", "AB34", false, true, true, true, false},
+		{"not an image", "/page", "AB34", false, true, true, true, false},
+		{"server error", "/down", "AB34", false, true, false, true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := context.Background()
+
+			conn := memory.New()
+			store := memStore{}
+
+			card := &primitives.Card{DeckID: 1, ImageURL: srv.URL + tc.path}
+			test.OK(t, conn.Create(ctx, card))
+
+			args := JobArgs{
+				CardID:   card.ID(),
+				ImageURL: card.ImageURL,
+				Name:     tc.name,
+				Sizes:    worker.CardImageSizes,
+			}
+
+			if tc.changed {
+				args.ImageURL = srv.URL + "/old.png"
+			}
+
+			resized := false
+
+			job := &Job{
+				args:  args,
+				store: store,
+				db:    conn,
+				resizer: resizerFunc(func(i worker.Imager, name string) error {
+					test.Equal(t, "resize name", tc.name, name)
+					test.Equal(t, "resize url", true, strings.HasPrefix(i.GetImageURL(), "/blobs/mirrors/"))
+					resized = true
+					return nil
+				}),
+				client: srv.Client(),
+			}
+
+			err := job.Run(ctx)
+
+			found, ferr := db.FindCard(ctx, conn, card.ID())
+			test.OK(t, ferr)
+
+			test.Equal(t, "resized", tc.resized, resized)
+			test.Equal(t, "unreachable", tc.unreachable, found.ImageUnreachable)
+
+			if tc.err {
+				test.Error(t, err)
+				test.Equal(t, "permanent error", tc.permanent, worker.IsPermanent(err))
+				test.Equal(t, "image url", card.ImageURL, found.ImageURL)
+				return
+			}
+
+			test.OK(t, err)
+
+			if tc.changed {
+				test.Equal(t, "image url", card.ImageURL, found.ImageURL)
+				test.Equal(t, "stored images", 0, len(store))
+				return
+			}
+
+			test.Equal(t, "source url", card.ImageURL, found.ImageSourceURL)
+			test.Equal(t, "stored images", 1, len(store))
+
+			key := strings.TrimPrefix(found.ImageURL, "/blobs/")
+			test.Equal(t, "image", buf.Bytes(), store[key])
+			test.Equal(t, "extension", true, strings.HasSuffix(key, ".png"))
+		})
+	}
+}
+
+// editingStore edits the card while the image is stored, like a user editing
+// it during the download
+type editingStore struct {
+	memStore
+	edit func()
+}
+
+func (s editingStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	s.edit()
+	return s.memStore.Put(ctx, key, r, contentType)
+}
+
+func TestJob_Run_edited(t *testing.T) {
+	var buf bytes.Buffer
+	test.OK(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	conn := memory.New()
+
+	card := &primitives.Card{DeckID: 1, ImageURL: srv.URL + "/cat.png", Caption: "cat"}
+	test.OK(t, conn.Create(ctx, card))
+
+	store := editingStore{memStore{}, func() {
+		edited := *card
+		edited.Caption = "black cat"
+		test.OK(t, conn.Update(ctx, &edited))
+	}}
+
+	job := &Job{
+		args:    JobArgs{CardID: card.ID(), ImageURL: card.ImageURL},
+		store:   store,
+		db:      conn,
+		resizer: resizerFunc(func(i worker.Imager, name string) error { return nil }),
+		client:  srv.Client(),
+	}
+
+	test.OK(t, job.Run(ctx))
+
+	found, err := db.FindCard(ctx, conn, card.ID())
+	test.OK(t, err)
+	test.Equal(t, "caption", "black cat", found.Caption)
+	test.Equal(t, "source url", card.ImageURL, found.ImageSourceURL)
+}
+
+func TestJob_Run_private(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected private address not to be requested")
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	conn := memory.New()
+
+	card := &primitives.Card{DeckID: 1, ImageURL: srv.URL + "/cat.png"}
+	test.OK(t, conn.Create(ctx, card))
+
+	job := &Job{
+		args:   JobArgs{CardID: card.ID(), ImageURL: card.ImageURL},
+		store:  memStore{},
+		db:     conn,
+		client: publicClient(time.Second),
+	}
+
+	err := job.Run(ctx)
+	test.Error(t, err)
+	test.Equal(t, "permanent error", true, worker.IsPermanent(err))
+}
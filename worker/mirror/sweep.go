@@ -0,0 +1,90 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+type sweepArgs struct{}
+
+// UniqueKey keeps a single pending sweep
+func (a sweepArgs) UniqueKey() string {
+	return sweepName
+}
+
+// sweeper enqueues a mirror and resize job for every card image still hosted
+// elsewhere. Cards already mirrored are skipped, so sweeping again only picks
+// up the ones that failed or were missed.
+type sweeper struct {
+	w *Worker
+}
+
+func (s *sweeper) Spawn(b []byte) (primitives.Job, error) {
+	return s, nil
+}
+
+func (s *sweeper) Run(ctx context.Context) error {
+	q := &cardQuery{where: map[string]interface{}{"image_source_url": ""}}
+
+	rs, err := s.w.Database.Query(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "failed to find cards to mirror")
+	}
+
+	for _, r := range rs {
+		card, ok := r.(*primitives.Card)
+		if !ok {
+			return errors.Errorf("invalid record type %T", r)
+		}
+
+		if !s.w.external(card.ImageURL) {
+			continue
+		}
+
+		args := JobArgs{
+			CardID:   card.ID(),
+			ImageURL: card.ImageURL,
+			Name:     sweepImageName(card.ID()),
+			Sizes:    worker.CardImageSizes,
+		}
+
+		err := s.w.WorkerPool.Enqueue(ctx, workerName, args)
+		if err != nil {
+			return errors.Wrapf(err, "failed to enqueue card %d image mirror", card.ID())
+		}
+	}
+
+	return nil
+}
+
+// sweepImageName names the resized images of the swept cards, the handlers
+// name them by the card hash, which has no dashes, so they never collide
+func sweepImageName(id primitives.ID) string {
+	return fmt.Sprintf("card-%d", id)
+}
+
+type cardQuery struct {
+	where map[string]interface{}
+}
+
+func (q *cardQuery) NewRecord() primitives.Record {
+	return &primitives.Card{}
+}
+
+func (q *cardQuery) Where() map[string]interface{} {
+	return q.where
+}
+
+func (q *cardQuery) Raw() string {
+	return ""
+}
+
+func (q *cardQuery) SortBy() map[string]string {
+	return map[string]string{
+		"id": "ASC",
+	}
+}
@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+const (
+	workerName = "img-mirror"
+	sweepName  = "img-mirror-sweep"
+)
+
+// Worker copies the external card images into the Store, so cards don't
+// break when third-party hosts remove them. It wraps the Resizer, mirroring
+// the card images before resizing them.
+type Worker struct {
+	Store      primitives.BlobStore
+	Database   primitives.Database
+	WorkerPool primitives.WorkerPool
+	Resizer    worker.ImageResizer
+
+	// Client downloads the external images, defaults to a client with a 30
+	// seconds timeout refusing private addresses
+	Client *http.Client
+}
+
+func (w *Worker) Register() error {
+	if w.WorkerPool == nil {
+		return errors.New("invalid worker pool")
+	}
+
+	if w.Store == nil {
+		return errors.New("invalid blob store")
+	}
+
+	if w.Database == nil {
+		return errors.New("invalid database")
+	}
+
+	if w.Resizer == nil {
+		return errors.New("invalid image resizer")
+	}
+
+	err := w.WorkerPool.Register(workerName, w)
+	if err != nil {
+		return errors.Wrap(err, "failed to register image mirror worker")
+	}
+
+	err = w.WorkerPool.Register(sweepName, &sweeper{w})
+	if err != nil {
+		return errors.Wrap(err, "failed to register image mirror sweep worker")
+	}
+
+	return nil
+}
+
+// Resize mirrors external card images and resizes the copy afterwards, other
+// images are resized right away
+func (w *Worker) Resize(ctx context.Context, i worker.Imager, name string, sizes []worker.ImageSize) error {
+	url := i.GetImageURL()
+
+	if i.Type() != "card" || !w.external(url) {
+		return w.Resizer.Resize(ctx, i, name, sizes)
+	}
+
+	args := JobArgs{
+		CardID:   i.ID(),
+		ImageURL: url,
+		Name:     name,
+		Sizes:    sizes,
+	}
+
+	err := w.WorkerPool.Enqueue(ctx, workerName, args)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enqueue image mirror worker %q", url)
+	}
+
+	return nil
+}
+
+// Sweep enqueues a job mirroring the images of all existing cards
+func (w *Worker) Sweep(ctx context.Context) error {
+	err := w.WorkerPool.Enqueue(ctx, sweepName, sweepArgs{})
+	if err != nil {
+		return errors.Wrap(err, "failed to enqueue image mirror sweep")
+	}
+
+	return nil
+}
+
+// external reports whether the image is hosted outside the blob store
+func (w *Worker) external(url string) bool {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return false
+	}
+
+	return !strings.HasPrefix(url, w.Store.URL(""))
+}
+
+// Timeout bounds the download and upload of a single image
+func (w *Worker) Timeout() time.Duration {
+	return 2 * time.Minute
+}
+
+func (w *Worker) Spawn(b []byte) (primitives.Job, error) {
+	args := JobArgs{}
+
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal args")
+	}
+
+	client := w.Client
+	if client == nil {
+		client = publicClient(30 * time.Second)
+	}
+
+	j := &Job{
+		args:    args,
+		store:   w.Store,
+		db:      w.Database,
+		resizer: w.Resizer,
+		client:  client,
+	}
+
+	return j, nil
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/test/mocks"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s[key] = b
+
+	return nil
+}
+
+func (s memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := s[key]
+	if !ok {
+		return nil, primitives.ErrBlobNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s memStore) Delete(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func (s memStore) URL(key string) string {
+	return "/blobs/" + key
+}
+
+type resizerFunc func(i worker.Imager, name string) error
+
+func (fn resizerFunc) Resize(ctx context.Context, i worker.Imager, name string, sizes []worker.ImageSize) error {
+	return fn(i, name)
+}
+
+func TestWorker_Resize(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		imager   worker.Imager
+		mirrored bool
+	}{
+		{"external card", &primitives.Card{ImageURL: "https://example.com/cat.png"}, true},
+		{"uploaded card", &primitives.Card{ImageURL: "/blobs/uploads/images/cat.png"}, false},
+		{"external deck", &primitives.Deck{ImageURL: "https://example.com/cat.png"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			var enqueued, resized bool
+
+			pool := &mocks.WorkerPool{
+				EnqueueFunc: func(name string, v interface{}) error {
+					test.Equal(t, "worker name", workerName, name)
+					test.Equal(t, "args", JobArgs{
+						ImageURL: "https://example.com/cat.png",
+						Name:     "AB34",
+						Sizes:    worker.CardImageSizes,
+					}, v)
+					enqueued = true
+					return nil
+				},
+			}
+
+			w := &Worker{
+				WorkerPool: pool,
+				Store:      memStore{},
+				Resizer: resizerFunc(func(i worker.Imager, name string) error {
+					resized = true
+					return nil
+				}),
+			}
+
+			err := w.Resize(context.Background(), tc.imager, "AB34", worker.CardImageSizes)
+			test.OK(t, err)
+			test.Equal(t, "mirrored", tc.mirrored, enqueued)
+			test.Equal(t, "resized", !tc.mirrored, resized)
+		})
+	}
+}
+
+func TestSweeper_Run(t *testing.T) {
+	ctx := context.Background()
+	conn := memory.New()
+
+	cards := []*primitives.Card{
+		{DeckID: 1, ImageURL: "https://example.com/cat.png"},
+		{DeckID: 1, ImageURL: "/blobs/uploads/images/dog.png"},
+		{DeckID: 1, ImageURL: "/blobs/mirrors/fox.png", ImageSourceURL: "https://example.com/fox.png"},
+	}
+
+	for _, c := range cards {
+		test.OK(t, conn.Create(ctx, c))
+	}
+
+	var enqueued []interface{}
+
+	pool := &mocks.WorkerPool{
+		EnqueueFunc: func(name string, v interface{}) error {
+			test.Equal(t, "worker name", workerName, name)
+			enqueued = append(enqueued, v)
+			return nil
+		},
+	}
+
+	s := &sweeper{&Worker{WorkerPool: pool, Database: conn, Store: memStore{}}}
+
+	err := s.Run(ctx)
+	test.OK(t, err)
+
+	exp := []interface{}{
+		JobArgs{
+			CardID:   cards[0].ID(),
+			ImageURL: "https://example.com/cat.png",
+			Name:     "card-1",
+			Sizes:    worker.CardImageSizes,
+		},
+	}
+
+	test.Equal(t, "enqueued jobs", exp, enqueued)
+}
@@ -1,14 +1,30 @@
 package offline
 
 import (
+	"context"
 	"log"
 
+	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 type ImageOfflineResizer struct{}
 
-func (w *ImageOfflineResizer) Resize(i worker.Imager, name string, width int, height int) error {
+func (w *ImageOfflineResizer) Resize(ctx context.Context, i worker.Imager, name string,
+	sizes []worker.ImageSize) error {
+
 	log.Printf("image resize called for %s\n", name)
 	return nil
 }
+
+type SpeechOfflineGenerator struct{}
+
+func (g *SpeechOfflineGenerator) Speak(ctx context.Context, card *primitives.Card) error {
+	log.Printf("speech called for card %d\n", card.ID())
+	return nil
+}
+
+func (g *SpeechOfflineGenerator) SpeakDeck(ctx context.Context, deck *primitives.Deck) error {
+	log.Printf("speech called for deck %d\n", deck.ID())
+	return nil
+}
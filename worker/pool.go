@@ -3,33 +3,145 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 )
 
+const (
+	// leaseDuration is how long a claimed job is reserved without a
+	// heartbeat before other pools can recover it
+	leaseDuration = time.Minute
+
+	// notifyChannel is used to wake the pools when a job is enqueued
+	notifyChannel = "jobs"
+
+	// pollInterval is how often the pool looks for due jobs, when the
+	// database can notify new jobs it only catches retries and missed
+	// notifications
+	pollInterval       = 5 * time.Second
+	notifyPollInterval = time.Minute
+
+	defaultSlots           = 2
+	defaultTimeout         = 10 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// Timeouter is implemented by workers that bound how long a job can run
+type Timeouter interface {
+	Timeout() time.Duration
+}
+
+// Uniquer is implemented by job args that shouldn't be enqueued twice, while
+// a job with the same key is waiting to run enqueuing replaces its args and
+// run time instead of adding a new job
+type Uniquer interface {
+	UniqueKey() string
+}
+
+// Notifier is implemented by databases that can wake the pools as soon as a
+// job is enqueued
+type Notifier interface {
+	Notify(ctx context.Context, channel string) error
+	Listen(ctx context.Context, channel string) (<-chan struct{}, error)
+}
+
 type WorkerPool struct {
 	workers map[string]primitives.Worker
+	slots   map[string]chan struct{}
+	crons   []cronEntry
+
+	wg sync.WaitGroup
 
 	Database primitives.Database
+
+	// Slots limits the jobs of each name running at the same time, names
+	// not set run up to 2 jobs
+	Slots map[string]int
+
+	// ShutdownTimeout is how long Start waits for running jobs once its
+	// context is done, jobs still running are canceled and scheduled again
+	ShutdownTimeout time.Duration
 }
 
-func (w *WorkerPool) Start() {
-	tick := time.NewTicker(5 * time.Second)
+// Start polls for jobs until the context is done, then waits for the running
+// jobs before returning
+func (w *WorkerPool) Start(ctx context.Context) {
+	interval := pollInterval
+
+	var wake <-chan struct{}
+
+	if n, ok := w.Database.(Notifier); ok {
+		var err error
+
+		wake, err = n.Listen(ctx, notifyChannel)
+		if err != nil {
+			log.Println(errors.Wrap(err, "failed to listen for jobs, polling instead"))
+		} else {
+			interval = notifyPollInterval
+		}
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	// jobs outlive ctx so they can finish during the shutdown timeout
+	jobsCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w.run(ctx, jobsCtx)
 
 	for {
 		select {
 		case <-tick.C:
-			w.run()
+			w.run(ctx, jobsCtx)
+		case _, ok := <-wake:
+			if !ok {
+				wake = nil
+				continue
+			}
+
+			w.run(ctx, jobsCtx)
+		case <-ctx.Done():
+			w.shutdown(cancel)
+			return
 		}
 	}
 }
 
+func (w *WorkerPool) shutdown(cancel context.CancelFunc) {
+	timeout := w.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+		log.Println("worker pool shutdown timeout reached, canceling running jobs")
+	}
+
+	cancel()
+
+	<-done
+}
+
 func (p *WorkerPool) Register(name string, worker primitives.Worker) error {
 	if p.workers == nil {
 		p.workers = make(map[string]primitives.Worker)
+		p.slots = make(map[string]chan struct{})
 	}
 
 	_, ok := p.workers[name]
@@ -37,108 +149,335 @@ func (p *WorkerPool) Register(name string, worker primitives.Worker) error {
 		return errors.Errorf("%s already registered", name)
 	}
 
+	n, ok := p.Slots[name]
+	if !ok || n < 1 {
+		n = defaultSlots
+	}
+
 	p.workers[name] = worker
+	p.slots[name] = make(chan struct{}, n)
+
+	return nil
+}
+
+type cronEntry struct {
+	name string
+	cron *Cron
+	args interface{}
+}
+
+// Schedule runs a job with the given args at the times matching the cron
+// expression. Only the next occurrence is kept as a scheduled job, when it
+// starts running the pool enqueues the following one.
+func (p *WorkerPool) Schedule(name, spec string, v interface{}) error {
+	if _, ok := p.workers[name]; !ok {
+		return errors.Errorf("worker %q not registered", name)
+	}
+
+	c, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	p.crons = append(p.crons, cronEntry{name: name, cron: c, args: v})
 
 	return nil
 }
 
-func (w *WorkerPool) Enqueue(name string, v interface{}) error {
+func (w *WorkerPool) Enqueue(ctx context.Context, name string, v interface{}) error {
+	return w.EnqueueAt(ctx, name, v, time.Now())
+}
+
+// EnqueueIn schedules a job to run after the delay
+func (w *WorkerPool) EnqueueIn(ctx context.Context, name string, v interface{}, d time.Duration) error {
+	return w.EnqueueAt(ctx, name, v, time.Now().Add(d))
+}
+
+// EnqueueAt schedules a job to run at the given time
+func (w *WorkerPool) EnqueueAt(ctx context.Context, name string, v interface{}, t time.Time) error {
+	key := ""
+	if u, ok := v.(Uniquer); ok {
+		key = u.UniqueKey()
+	}
+
+	return w.enqueue(ctx, name, v, t, key)
+}
+
+func (w *WorkerPool) enqueue(ctx context.Context, name string, v interface{}, t time.Time, key string) error {
 	b, err := json.Marshal(v)
 	if err != nil {
 		return errors.Wrapf(err, "failed to marshal job %q", name)
 	}
 
 	job := &Job{
-		Name:  name,
-		Args:  b,
-		State: scheduled,
-		RunAt: time.Now(),
+		Name:      name,
+		Args:      b,
+		State:     scheduled,
+		RunAt:     t,
+		UniqueKey: key,
+	}
+
+	if job.UniqueKey == "" {
+		err = w.Database.Create(ctx, job)
+	} else {
+		q := &uniqueQuery{job: job}
+		_, err = w.Database.QueryRaw(ctx, q, q.args()...)
 	}
 
-	err = w.Database.Create(job)
 	if err != nil {
 		return errors.Wrapf(err, "failed to save job to database %q", name)
 	}
 
+	// the job is saved, polling picks it up if the notification fails
+	if n, ok := w.Database.(Notifier); ok {
+		err := n.Notify(ctx, notifyChannel)
+		if err != nil {
+			log.Println(errors.Wrapf(err, "failed to notify job %q", name))
+		}
+	}
+
 	return nil
 }
 
-func (wp *WorkerPool) run() {
-	q := &query{}
+func (wp *WorkerPool) run(ctx, jobsCtx context.Context) {
+	now := time.Now()
 
-	rs, err := wp.Database.Query(q)
+	rs, err := wp.Database.QueryRaw(ctx, &recoverQuery{now: now})
 	if err != nil {
-		err = errors.Wrap(err, "failed to query scheduled jobs")
+		err = errors.Wrap(err, "failed to recover abandoned jobs")
 		log.Println(err)
-		return
 	}
 
-	var jobs []Job
-
 	for _, r := range rs {
-		job, ok := r.(*Job)
-		if !ok {
-			err := errors.Errorf("invalid record type %T", r)
+		log.Printf("recovered abandoned job %d\n", r.ID())
+	}
+
+	for _, c := range wp.crons {
+		err := wp.scheduleNext(ctx, c, now)
+		if err != nil {
+			log.Println(errors.Wrapf(err, "failed to schedule recurring job %q", c.name))
+		}
+	}
+
+	for name, slots := range wp.slots {
+		free := cap(slots) - len(slots)
+		if free == 0 {
+			continue
+		}
+
+		q := &claimQuery{
+			now:   now,
+			name:  name,
+			limit: free,
+			lease: leaseDuration,
+		}
+
+		rs, err := wp.Database.QueryRaw(ctx, q, q.args()...)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to claim scheduled jobs %q", name)
 			log.Println(err)
-			return
+			continue
+		}
+
+		for _, r := range rs {
+			job, ok := r.(*Job)
+			if !ok {
+				err := errors.Errorf("invalid record type %T", r)
+				log.Println(err)
+				continue
+			}
+
+			wp.runJob(jobsCtx, *job)
 		}
+	}
+}
 
-		jobs = append(jobs, *job)
+// scheduleNext enqueues the next occurrence of a recurring job, unless it is
+// already scheduled. Occurrences are unique by name and time, so the pools of
+// every replica enqueue a single one.
+func (wp *WorkerPool) scheduleNext(ctx context.Context, c cronEntry, now time.Time) error {
+	n, err := wp.Database.Count(ctx, &stateQuery{state: scheduled, name: c.name})
+	if err != nil {
+		return err
 	}
 
-	for _, j := range jobs {
-		wp.runJob(j)
+	if n > 0 {
+		return nil
 	}
+
+	next := c.cron.Next(now)
+	if next.IsZero() {
+		return errors.New("cron expression never matches")
+	}
+
+	key := fmt.Sprintf("cron:%s:%s", c.name, next.Format(time.RFC3339))
+
+	return wp.enqueue(ctx, c.name, c.args, next, key)
 }
 
-func (wp *WorkerPool) runJob(j Job) {
+// runJob runs a job already claimed by the pool in one of its name slots,
+// extending its lease until the job is done
+func (wp *WorkerPool) runJob(ctx context.Context, j Job) {
+	// bookkeeping must succeed even when the job is canceled
+	bg := context.Background()
+
 	worker, ok := wp.workers[j.Name]
 
 	if !ok {
 		err := errors.Errorf("worker %q not registered", j.Name)
-		failedJob(wp.Database, j, err)
+		failedJob(bg, wp.Database, j, Permanent(err), DefaultRetryPolicy)
 		return
 	}
 
-	j.State = running
+	policy := DefaultRetryPolicy
+	if r, ok := worker.(Retrier); ok {
+		policy = r.RetryPolicy()
+	}
 
-	err := updateJob(wp.Database, j)
-	if err != nil {
+	// jobs recovered after a crash may have exhausted their attempts
+	if j.Tries >= policy.MaxAttempts {
+		j.State = failed
+		updateJob(bg, wp.Database, j, j.Tries)
 		return
 	}
 
 	job, err := worker.Spawn(j.Args)
 	if err != nil {
-		failedJob(wp.Database, j, err)
+		failedJob(bg, wp.Database, j, Permanent(err), policy)
 		return
 	}
 
+	timeout := defaultTimeout
+	if t, ok := worker.(Timeouter); ok {
+		timeout = t.Timeout()
+	}
+
+	slots := wp.slots[j.Name]
+	slots <- struct{}{}
+
+	wp.wg.Add(1)
+
 	go func() {
-		err = job.Run(context.Background()) // FIXME
+		defer wp.wg.Done()
+		defer func() { <-slots }()
 
-		if err != nil {
-			failedJob(wp.Database, j, err)
+		jobCtx, cancel := context.WithTimeout(ctx, timeout)
+
+		stop := make(chan struct{})
+		lost := heartbeat(bg, wp.Database, j, stop, cancel)
+
+		err := job.Run(jobCtx)
+		cancel()
+
+		close(stop)
+
+		// the job was canceled or taken over, its state isn't ours anymore
+		if <-lost {
 			return
 		}
 
-		j.State = done
-		updateJob(wp.Database, j)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			requeueJob(bg, wp.Database, j)
+		case err != nil:
+			failedJob(bg, wp.Database, j, err, policy)
+		default:
+			j.State = done
+			updateJob(bg, wp.Database, j, j.Tries)
+		}
+	}()
+}
 
+// heartbeat extends the job lease until stop is closed, then sends whether
+// the lease was lost. Only the lease is updated, so the state changes made by
+// others aren't overwritten, and the job is stopped when it isn't running
+// anymore.
+func heartbeat(ctx context.Context, db primitives.Database, j Job, stop <-chan struct{},
+	cancel context.CancelFunc) <-chan bool {
+
+	lost := make(chan bool, 1)
+
+	go func() {
+		tick := time.NewTicker(leaseDuration / 3)
+		defer tick.Stop()
+
+		expired := false
+
+		for {
+			select {
+			case <-stop:
+				lost <- expired
+				return
+			case <-tick.C:
+				if expired {
+					continue
+				}
+
+				q := &leaseQuery{id: j.ID(), tries: j.Tries, now: time.Now(), lease: leaseDuration}
+
+				rs, err := db.QueryRaw(ctx, q)
+				if err != nil {
+					log.Println(errors.Wrapf(err, "failed to extend job %d %q lease", j.ID(), j.Name))
+					continue
+				}
+
+				if len(rs) == 0 {
+					log.Printf("job %d %q is no longer running, stopping it\n", j.ID(), j.Name)
+
+					expired = true
+					cancel()
+				}
+			}
+		}
 	}()
+
+	return lost
 }
 
-func updateJob(db primitives.Database, j Job) error {
-	err := db.Update(&j)
+// updateJob writes the job outcome if the job is still running the claimed
+// try, otherwise it was canceled or recovered and its state is left alone
+func updateJob(ctx context.Context, db primitives.Database, j Job, tries int) error {
+	q := &finishQuery{job: j, tries: tries, now: time.Now()}
+
+	rs, err := db.QueryRaw(ctx, q, q.args()...)
 	if err != nil {
 		err := errors.Wrapf(err, "failed to update job %d %q", j.ID(), j.Name)
 		log.Println(err)
+		return err
 	}
-	return err
+
+	if len(rs) == 0 {
+		log.Printf("job %d %q is no longer running, keeping its state\n", j.ID(), j.Name)
+	}
+
+	return nil
 }
 
-func failedJob(db primitives.Database, j Job, err error) {
-	j.State = failed
+// requeueJob schedules a job interrupted by the shutdown to run again, it
+// doesn't count as a try
+func requeueJob(ctx context.Context, db primitives.Database, j Job) {
+	tries := j.Tries
+
+	j.State = scheduled
+	j.RunAt = time.Now()
+
+	updateJob(ctx, db, j, tries)
+}
+
+// failedJob schedules the job to run again after a backoff delay, or marks it
+// as failed when the error is permanent or the attempts are exhausted
+func failedJob(ctx context.Context, db primitives.Database, j Job, err error, policy RetryPolicy) {
+	tries := j.Tries
+
+	j.Tries++
 	j.Error = err.Error()
 
-	updateJob(db, j)
+	if policy.Retry(j.Tries, err) {
+		j.State = retry
+		j.RunAt = time.Now().Add(policy.Backoff(j.Tries))
+	} else {
+		j.State = failed
+	}
+
+	updateJob(ctx, db, j, tries)
 }
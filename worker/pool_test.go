@@ -0,0 +1,305 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/db/sqlite"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+// eachDatabase runs the test against the databases with their own versions of
+// the raw queries
+func eachDatabase(t *testing.T, fn func(t *testing.T, conn primitives.Database)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, memory.New())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		conn, err := sqlite.New(":memory:")
+		test.OK(t, err)
+
+		defer conn.Close()
+
+		fn(t, conn)
+	})
+}
+
+func TestFailedJob(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute}
+
+	testCases := []struct {
+		scenario string
+		err      error
+		tries    int
+		state    string
+	}{
+		{"retry", errors.New("timeout"), 1, retry},
+		{"permanent", Permanent(errors.New("bad request")), 1, failed},
+		{"exhausted", errors.New("timeout"), 2, failed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := context.Background()
+
+			conn := memory.New()
+
+			job := &Job{Name: "fail", State: running, Tries: tc.tries - 1, RunAt: time.Now()}
+			test.OK(t, conn.Create(ctx, job))
+
+			failedJob(ctx, conn, *job, tc.err, policy)
+
+			got, err := FindJob(ctx, conn, job.ID())
+			test.OK(t, err)
+
+			test.Equal(t, "state", tc.state, got.State)
+			test.Equal(t, "tries", tc.tries, got.Tries)
+
+			if tc.state == retry && !got.RunAt.After(time.Now()) {
+				t.Errorf("expected run at to be pushed forward, got %s", got.RunAt)
+			}
+		})
+	}
+}
+
+func TestUpdateJob(t *testing.T) {
+	eachDatabase(t, testUpdateJob)
+}
+
+func testUpdateJob(t *testing.T, conn primitives.Database) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		scenario string
+		state    string
+		tries    int
+		want     string
+	}{
+		{"running", running, 0, done},
+		{"canceled", canceled, 0, canceled},
+		{"recovered", running, 1, running},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			job := &Job{Name: "resize", State: tc.state, Tries: tc.tries, RunAt: time.Now()}
+			test.OK(t, conn.Create(ctx, job))
+
+			// the job outcome of the run claimed with no tries
+			j := *job
+			j.State = done
+
+			test.OK(t, updateJob(ctx, conn, j, 0))
+
+			got, err := FindJob(ctx, conn, job.ID())
+			test.OK(t, err)
+			test.Equal(t, "state", tc.want, got.State)
+		})
+	}
+}
+
+func TestWorkerPool_claim(t *testing.T) {
+	eachDatabase(t, testWorkerPoolClaim)
+}
+
+func testWorkerPoolClaim(t *testing.T, conn primitives.Database) {
+	ctx := context.Background()
+
+	now := time.Now()
+
+	jobs := []*Job{
+		{Name: "resize", Error: "due", State: scheduled, RunAt: now.Add(-time.Minute)},
+		{Name: "resize", Error: "retry", State: retry, RunAt: now.Add(-time.Second)},
+		{Name: "resize", Error: "later", State: retry, RunAt: now.Add(time.Hour)},
+		{Name: "resize", Error: "abandoned", State: running, LeaseUntil: now.Add(-time.Second)},
+		{Name: "resize", Error: "leased", State: running, LeaseUntil: now.Add(time.Minute)},
+		{Name: "audio", Error: "other name", State: scheduled, RunAt: now.Add(-time.Minute)},
+	}
+
+	for _, j := range jobs {
+		test.OK(t, conn.Create(ctx, j))
+	}
+
+	rs, err := conn.QueryRaw(ctx, &recoverQuery{now: now})
+	test.OK(t, err)
+	test.Equal(t, "recovered jobs", 1, len(rs))
+	test.Equal(t, "recovered job tries", 1, rs[0].(*Job).Tries)
+
+	rs, err = conn.QueryRaw(ctx, &claimQuery{now: now, name: "resize", limit: 2, lease: time.Minute})
+	test.OK(t, err)
+
+	var claimed []string
+	for _, r := range rs {
+		j := r.(*Job)
+		test.Equal(t, "claimed job state", running, j.State)
+		claimed = append(claimed, j.Error)
+	}
+
+	test.Equal(t, "claimed jobs", []string{"due", "retry"}, claimed)
+
+	rs, err = conn.QueryRaw(ctx, &claimQuery{now: now, name: "resize", limit: 2, lease: time.Minute})
+	test.OK(t, err)
+	test.Equal(t, "jobs left", 1, len(rs))
+
+	rs, err = conn.QueryRaw(ctx, &claimQuery{now: now, name: "resize", limit: 2, lease: time.Minute})
+	test.OK(t, err)
+	test.Equal(t, "jobs claimed twice", 0, len(rs))
+}
+
+func TestLeaseQuery(t *testing.T) {
+	eachDatabase(t, testLeaseQuery)
+}
+
+func testLeaseQuery(t *testing.T, conn primitives.Database) {
+	ctx := context.Background()
+
+	now := time.Now()
+
+	testCases := []struct {
+		scenario string
+		job      *Job
+		tries    int
+		extended bool
+	}{
+		{"running", &Job{Name: "resize", State: running, LeaseUntil: now}, 0, true},
+		{"canceled", &Job{Name: "resize", State: canceled, LeaseUntil: now}, 0, false},
+		{"recovered", &Job{Name: "resize", State: running, Tries: 1, LeaseUntil: now}, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			test.OK(t, conn.Create(ctx, tc.job))
+
+			q := &leaseQuery{id: tc.job.ID(), tries: tc.tries, now: now, lease: time.Minute}
+
+			rs, err := conn.QueryRaw(ctx, q)
+			test.OK(t, err)
+			test.Equal(t, "extended", tc.extended, len(rs) == 1)
+
+			got, err := FindJob(ctx, conn, tc.job.ID())
+			test.OK(t, err)
+			test.Equal(t, "state", tc.job.State, got.State)
+		})
+	}
+}
+
+type blockingWorker struct{}
+
+func (w *blockingWorker) Spawn(b []byte) (primitives.Job, error) {
+	return w, nil
+}
+
+func (w *blockingWorker) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWorkerPool_shutdown(t *testing.T) {
+	ctx := context.Background()
+	conn := memory.New()
+
+	pool := &WorkerPool{
+		Database:        conn,
+		Slots:           map[string]int{"block": 1},
+		ShutdownTimeout: 10 * time.Millisecond,
+	}
+
+	test.OK(t, pool.Register("block", &blockingWorker{}))
+	test.OK(t, pool.Enqueue(ctx, "block", nil))
+	test.OK(t, pool.Enqueue(ctx, "block", nil))
+
+	jobsCtx, cancel := context.WithCancel(ctx)
+	pool.run(ctx, jobsCtx)
+
+	runningJobs, err := findJobs(ctx, conn, running)
+	test.OK(t, err)
+	test.Equal(t, "running jobs limited by slots", 1, len(runningJobs))
+
+	pool.shutdown(cancel)
+
+	scheduledJobs, err := findJobs(ctx, conn, scheduled)
+	test.OK(t, err)
+	test.Equal(t, "requeued jobs", 2, len(scheduledJobs))
+
+	for _, j := range scheduledJobs {
+		test.Equal(t, "requeued job tries", 0, j.Tries)
+	}
+}
+
+func TestWorkerPool_Schedule(t *testing.T) {
+	ctx := context.Background()
+	conn := memory.New()
+
+	pool := &WorkerPool{Database: conn}
+
+	test.OK(t, pool.Register("purge", &blockingWorker{}))
+	test.Error(t, pool.Schedule("unknown", "@daily", nil))
+	test.Error(t, pool.Schedule("purge", "daily", nil))
+	test.OK(t, pool.Schedule("purge", "@daily", nil))
+
+	now := time.Date(2018, time.September, 3, 10, 20, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		test.OK(t, pool.scheduleNext(ctx, pool.crons[0], now))
+	}
+
+	jobs, err := findJobs(ctx, conn, scheduled)
+	test.OK(t, err)
+	test.Equal(t, "scheduled jobs", 1, len(jobs))
+	test.Equal(t, "run at", time.Date(2018, time.September, 4, 0, 0, 0, 0, time.UTC), jobs[0].RunAt.UTC())
+	test.Equal(t, "unique key", "cron:purge:2018-09-04T00:00:00Z", jobs[0].UniqueKey)
+
+	// replicas that checked before the job was scheduled enqueue it again
+	next := jobs[0].RunAt.UTC()
+	test.OK(t, pool.enqueue(ctx, "purge", nil, next, jobs[0].UniqueKey))
+
+	jobs, err = findJobs(ctx, conn, scheduled)
+	test.OK(t, err)
+	test.Equal(t, "scheduled jobs after race", 1, len(jobs))
+}
+
+type uniqueArgs struct {
+	Key string
+	URL string
+}
+
+func (a uniqueArgs) UniqueKey() string {
+	return a.Key
+}
+
+func TestWorkerPool_EnqueueUnique(t *testing.T) {
+	eachDatabase(t, testWorkerPoolEnqueueUnique)
+}
+
+func testWorkerPoolEnqueueUnique(t *testing.T, conn primitives.Database) {
+	ctx := context.Background()
+
+	pool := &WorkerPool{Database: conn}
+
+	test.OK(t, pool.Enqueue(ctx, "resize", uniqueArgs{Key: "resize:card:1", URL: "a.png"}))
+	test.OK(t, pool.Enqueue(ctx, "resize", uniqueArgs{Key: "resize:card:1", URL: "b.png"}))
+	test.OK(t, pool.Enqueue(ctx, "resize", uniqueArgs{Key: "resize:card:2", URL: "c.png"}))
+
+	jobs, err := FindJobs(ctx, conn, scheduled, "resize")
+	test.OK(t, err)
+	test.Equal(t, "scheduled jobs", 2, len(jobs))
+
+	job, err := FindJob(ctx, conn, 1)
+	test.OK(t, err)
+	test.Equal(t, "replaced args", `{"Key":"resize:card:1","URL":"b.png"}`, string(job.Args))
+
+	// a running job no longer blocks new jobs with its key
+	job.State = running
+	test.OK(t, conn.Update(ctx, job))
+
+	test.OK(t, pool.Enqueue(ctx, "resize", uniqueArgs{Key: "resize:card:1", URL: "d.png"}))
+
+	jobs, err = FindJobs(ctx, conn, scheduled, "resize")
+	test.OK(t, err)
+	test.Equal(t, "scheduled jobs", 2, len(jobs))
+}
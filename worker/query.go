@@ -1,23 +1,579 @@
 package worker
 
-import "gitlab.com/luizbranco/cyberbrain/primitives"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
-type query struct{}
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
 
-func (q *query) NewRecord() primitives.Record {
+// jobColumns selects the jobs in the order they are scanned
+var jobColumns = db.Columns(&Job{}, "j")
+
+// claimQuery atomically moves the due scheduled and retrying jobs to running,
+// skipping the rows locked by other pools so each job is claimed only once
+type claimQuery struct {
+	now   time.Time
+	name  string
+	limit int
+	lease time.Duration
+}
+
+func (q *claimQuery) NewRecord() primitives.Record {
 	return &Job{}
 }
 
-func (q *query) Where() map[string]interface{} {
-	return map[string]interface{}{
-		"state": scheduled,
+func (q *claimQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *claimQuery) Raw() string {
+	return fmt.Sprintf(`UPDATE jobs
+	SET state = '%s', lease_until = NOW() + INTERVAL '%d milliseconds', updated_at = NOW()
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE name = $1 AND state IN ('%s', '%s') AND run_at <= NOW()
+		ORDER BY run_at
+		LIMIT %d
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *;`, running, q.lease/time.Millisecond, scheduled, retry, q.limit)
+}
+
+// args are bound to the query placeholders
+func (q *claimQuery) args() []interface{} {
+	return []interface{}{q.name}
+}
+
+func (q *claimQuery) SortBy() map[string]string {
+	return nil
+}
+
+// SQLite claims the jobs in a transaction, SQLite runs one at a time
+func (q *claimQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	due, err := conn.Select(ctx, q, fmt.Sprintf(`SELECT %s FROM jobs j
+	WHERE j.name = ?1 AND j.state IN ('%s', '%s') AND julianday(j.run_at) <= julianday(?2)
+	ORDER BY julianday(j.run_at)
+	LIMIT ?3;`, jobColumns, scheduled, retry), q.name, q.now, q.limit)
+
+	if err != nil || len(due) == 0 {
+		return nil, err
 	}
+
+	lease := q.now.Add(q.lease)
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(`UPDATE jobs
+	SET state = '%s', lease_until = ?1, updated_at = ?2
+	WHERE id IN (%s);`, running, db.IDs(due)), lease, q.now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range due {
+		j := r.(*Job)
+		j.State = running
+		j.LeaseUntil = lease
+		j.MetaUpdatedAt = q.now
+	}
+
+	return due, nil
 }
 
-func (q *query) Raw() string {
-	return ""
+// Eval claims the jobs for the in-memory database, used by a single process so
+// there are no concurrent claims
+func (q *claimQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	var due []*Job
+
+	for _, state := range []string{scheduled, retry} {
+		jobs, err := findJobs(ctx, conn, state)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, j := range jobs {
+			if j.Name == q.name && !j.RunAt.After(q.now) {
+				due = append(due, j)
+			}
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+
+	if len(due) > q.limit {
+		due = due[:q.limit]
+	}
+
+	var claimed []primitives.Record
+
+	for _, j := range due {
+		j.State = running
+		j.LeaseUntil = q.now.Add(q.lease)
+
+		err := conn.Update(ctx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		claimed = append(claimed, j)
+	}
+
+	return claimed, nil
+}
+
+// recoverQuery moves the running jobs with an expired lease, abandoned by a
+// crashed pool, back to retry
+type recoverQuery struct {
+	now time.Time
+}
+
+func (q *recoverQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *recoverQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *recoverQuery) Raw() string {
+	return fmt.Sprintf(`UPDATE jobs
+	SET state = '%s', tries = tries + 1, error = 'lease expired', run_at = NOW(), updated_at = NOW()
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE state = '%s' AND lease_until < NOW()
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *;`, retry, running)
+}
+
+func (q *recoverQuery) SortBy() map[string]string {
+	return nil
+}
+
+func (q *recoverQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	expired, err := conn.Select(ctx, q, fmt.Sprintf(`SELECT %s FROM jobs j
+	WHERE j.state = '%s' AND julianday(j.lease_until) < julianday(?1);`, jobColumns, running), q.now)
+
+	if err != nil || len(expired) == 0 {
+		return nil, err
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(`UPDATE jobs
+	SET state = '%s', tries = tries + 1, error = 'lease expired', run_at = ?1, updated_at = ?1
+	WHERE id IN (%s);`, retry, db.IDs(expired)), q.now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range expired {
+		j := r.(*Job)
+		j.State = retry
+		j.Tries++
+		j.Error = "lease expired"
+		j.RunAt = q.now
+		j.MetaUpdatedAt = q.now
+	}
+
+	return expired, nil
+}
+
+func (q *recoverQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	jobs, err := findJobs(ctx, conn, running)
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []primitives.Record
+
+	for _, j := range jobs {
+		if !j.LeaseUntil.Before(q.now) {
+			continue
+		}
+
+		j.State = retry
+		j.Tries++
+		j.Error = "lease expired"
+		j.RunAt = q.now
+
+		err := conn.Update(ctx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		recovered = append(recovered, j)
+	}
+
+	return recovered, nil
+}
+
+// leaseQuery extends the lease of a job while it is still running in the same
+// attempt. It returns no job when the job was canceled, or recovered by
+// another pool, so the pool running it must stop.
+type leaseQuery struct {
+	id    primitives.ID
+	tries int
+	now   time.Time
+	lease time.Duration
+}
+
+func (q *leaseQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *leaseQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *leaseQuery) Raw() string {
+	return fmt.Sprintf(`UPDATE jobs
+	SET lease_until = NOW() + INTERVAL '%d milliseconds', updated_at = NOW()
+	WHERE id = %d AND state = '%s' AND tries = %d
+	RETURNING *;`, q.lease/time.Millisecond, q.id, running, q.tries)
+}
+
+func (q *leaseQuery) SortBy() map[string]string {
+	return nil
+}
+
+func (q *leaseQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	n, err := conn.Exec(ctx, fmt.Sprintf(`UPDATE jobs
+	SET lease_until = ?1, updated_at = ?2
+	WHERE id = ?3 AND state = '%s' AND tries = ?4;`, running), q.now.Add(q.lease), q.now, q.id, q.tries)
+
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	return conn.Select(ctx, q, "SELECT "+jobColumns+" FROM jobs j WHERE j.id = ?1;", q.id)
+}
+
+func (q *leaseQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	j, err := FindJob(ctx, conn, q.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.State != running || j.Tries != q.tries {
+		return nil, nil
+	}
+
+	j.LeaseUntil = q.now.Add(q.lease)
+
+	err = conn.Update(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+
+	return []primitives.Record{j}, nil
+}
+
+// finishQuery writes the outcome of a job run while the job is still running
+// the claimed try, so jobs canceled or recovered by others keep their state
+type finishQuery struct {
+	job   Job
+	tries int
+	now   time.Time
+}
+
+func (q *finishQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *finishQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *finishQuery) Raw() string {
+	return fmt.Sprintf(`UPDATE jobs
+	SET state = $1, run_at = $2, tries = $3, error = $4, updated_at = NOW()
+	WHERE id = %d AND state = '%s' AND tries = %d
+	RETURNING *;`, q.job.ID(), running, q.tries)
+}
+
+func (q *finishQuery) args() []interface{} {
+	return []interface{}{q.job.State, q.job.RunAt, q.job.Tries, q.job.Error}
+}
+
+func (q *finishQuery) SortBy() map[string]string {
+	return nil
+}
+
+func (q *finishQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	n, err := conn.Exec(ctx, fmt.Sprintf(`UPDATE jobs
+	SET state = ?1, run_at = ?2, tries = ?3, error = ?4, updated_at = ?5
+	WHERE id = ?6 AND state = '%s' AND tries = ?7;`, running),
+		q.job.State, q.job.RunAt, q.job.Tries, q.job.Error, q.now, q.job.ID(), q.tries)
+
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	return conn.Select(ctx, q, "SELECT "+jobColumns+" FROM jobs j WHERE j.id = ?1;", q.job.ID())
+}
+
+func (q *finishQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	j, err := FindJob(ctx, conn, q.job.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	if j.State != running || j.Tries != q.tries {
+		return nil, nil
+	}
+
+	j.State = q.job.State
+	j.RunAt = q.job.RunAt
+	j.Tries = q.job.Tries
+	j.Error = q.job.Error
+
+	err = conn.Update(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+
+	return []primitives.Record{j}, nil
+}
+
+// transitionQuery moves a job to another state if it is in one of the from
+// states, resetting its attempts to run now when reset is set
+type transitionQuery struct {
+	id    primitives.ID
+	from  []string
+	to    string
+	reset bool
+	now   time.Time
+}
+
+func (q *transitionQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *transitionQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *transitionQuery) Raw() string {
+	set := ""
+	if q.reset {
+		set = ", run_at = NOW(), tries = 0, error = ''"
+	}
+
+	return fmt.Sprintf(`UPDATE jobs
+	SET state = '%s'%s, updated_at = NOW()
+	WHERE id = %d AND state IN (%s)
+	RETURNING *;`, q.to, set, q.id, states(q.from))
+}
+
+func (q *transitionQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	set := ""
+	if q.reset {
+		set = ", run_at = ?2, tries = 0, error = ''"
+	}
+
+	n, err := conn.Exec(ctx, fmt.Sprintf(`UPDATE jobs
+	SET state = '%s'%s, updated_at = ?2
+	WHERE id = ?1 AND state IN (%s);`, q.to, set, states(q.from)), q.id, q.now)
+
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	return conn.Select(ctx, q, "SELECT "+jobColumns+" FROM jobs j WHERE j.id = ?1;", q.id)
+}
+
+func (q *transitionQuery) SortBy() map[string]string {
+	return nil
+}
+
+func (q *transitionQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	j, err := FindJob(ctx, conn, q.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasState(*j, q.from) {
+		return nil, nil
+	}
+
+	j.State = q.to
+
+	if q.reset {
+		j.RunAt = q.now
+		j.Tries = 0
+		j.Error = ""
+	}
+
+	err = conn.Update(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+
+	return []primitives.Record{j}, nil
+}
+
+// uniqueQuery inserts a job, or replaces the args and run time of the pending
+// job with the same unique key
+type uniqueQuery struct {
+	job *Job
+}
+
+func (q *uniqueQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *uniqueQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *uniqueQuery) Raw() string {
+	j := q.job
+
+	return fmt.Sprintf(`INSERT INTO jobs (run_at, name, state, args, error, tries, unique_key)
+	VALUES ($1, $2, '%s', $3, '', 0, $4)
+	ON CONFLICT (unique_key) WHERE unique_key <> '' AND state IN ('%s', '%s')
+	DO UPDATE SET args = EXCLUDED.args, run_at = EXCLUDED.run_at, state = EXCLUDED.state,
+		error = '', tries = 0, updated_at = NOW()
+	RETURNING *;`, j.State, scheduled, retry)
+}
+
+// args are bound to the query placeholders
+func (q *uniqueQuery) args() []interface{} {
+	j := q.job
+	return []interface{}{j.RunAt, j.Name, j.Args, j.UniqueKey}
 }
 
-func (q *query) SortBy() map[string]string {
+func (q *uniqueQuery) SortBy() map[string]string {
 	return nil
 }
+
+func (q *uniqueQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	j := q.job
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO jobs
+	(version, created_at, updated_at, run_at, name, state, args, error, tries, unique_key)
+	VALUES (1, ?5, ?5, ?1, ?2, '%s', ?3, '', 0, ?4)
+	ON CONFLICT (unique_key) WHERE unique_key <> '' AND state IN ('%s', '%s')
+	DO UPDATE SET args = excluded.args, run_at = excluded.run_at, state = excluded.state,
+		error = '', tries = 0, updated_at = excluded.updated_at;`, j.State, scheduled, retry),
+		j.RunAt, j.Name, j.Args, j.UniqueKey, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.Select(ctx, q, fmt.Sprintf(`SELECT %s FROM jobs j
+	WHERE j.unique_key = ?1 AND j.state IN ('%s', '%s');`, jobColumns, scheduled, retry), j.UniqueKey)
+}
+
+func (q *uniqueQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	for _, state := range []string{scheduled, retry} {
+		where := map[string]interface{}{
+			"state":      state,
+			"unique_key": q.job.UniqueKey,
+		}
+
+		rs, err := conn.Query(ctx, &jobQuery{where: where})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rs) == 0 {
+			continue
+		}
+
+		j, ok := rs[0].(*Job)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", rs[0])
+		}
+
+		j.Args = q.job.Args
+		j.RunAt = q.job.RunAt
+		j.State = q.job.State
+		j.Error = ""
+		j.Tries = 0
+
+		err = conn.Update(ctx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		return []primitives.Record{j}, nil
+	}
+
+	err := conn.Create(ctx, q.job)
+	if err != nil {
+		return nil, err
+	}
+
+	return []primitives.Record{q.job}, nil
+}
+
+func findJobs(ctx context.Context, conn primitives.Database, state string) ([]*Job, error) {
+	rs, err := conn.Query(ctx, &stateQuery{state: state})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+
+	for _, r := range rs {
+		job, ok := r.(*Job)
+		if !ok {
+			return nil, errors.Errorf("invalid record type %T", r)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// states returns the job states as a SQL list, they are constants and never
+// user input
+func states(l []string) string {
+	quoted := make([]string, len(l))
+	for i, s := range l {
+		quoted[i] = "'" + s + "'"
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+type stateQuery struct {
+	state string
+	name  string
+}
+
+func (q *stateQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *stateQuery) Where() map[string]interface{} {
+	where := map[string]interface{}{
+		"state": q.state,
+	}
+
+	if q.name != "" {
+		where["name"] = q.name
+	}
+
+	return where
+}
+
+func (q *stateQuery) Raw() string {
+	return ""
+}
+
+func (q *stateQuery) SortBy() map[string]string {
+	return map[string]string{
+		"run_at": "ASC",
+	}
+}
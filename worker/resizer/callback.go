@@ -0,0 +1,170 @@
+package resizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+// callbackTTL covers the job retries and Blitline processing time
+const callbackTTL = 24 * time.Hour
+
+// SignCallback returns the query string authenticating the Blitline callback
+// of the record image until it expires
+func SignCallback(secret, imagerType, name string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	q := url.Values{
+		"expires":   {exp},
+		"signature": {signature(secret, imagerType, name, exp)},
+	}
+
+	return q.Encode()
+}
+
+// VerifyCallback checks the callback query string was signed by
+// SignCallback for the record image and hasn't expired
+func VerifyCallback(secret, imagerType, name string, q url.Values, now time.Time) error {
+	// anyone could sign callbacks with an empty secret
+	if secret == "" {
+		return errors.New("callback secret not set")
+	}
+
+	exp := q.Get("expires")
+
+	sig, err := hex.DecodeString(q.Get("signature"))
+	if err != nil {
+		return errors.Wrap(err, "invalid callback signature")
+	}
+
+	expected, _ := hex.DecodeString(signature(secret, imagerType, name, exp))
+
+	if !hmac.Equal(sig, expected) {
+		return errors.New("invalid callback signature")
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "invalid callback expiration")
+	}
+
+	if now.After(time.Unix(unix, 0)) {
+		return errors.Errorf("callback expired at %s", time.Unix(unix, 0).UTC())
+	}
+
+	return nil
+}
+
+func signature(secret, imagerType, name, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s", imagerType, name, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyResult checks the image returned by Blitline is one of the sizes
+// requested for the record, saved at its path inside the bucket, returning
+// the size name
+func VerifyResult(bucket, imagerType, name, id, s3URL string) (string, error) {
+	size, ok := sizeName(name, id)
+	if !ok {
+		return "", errors.Errorf("invalid image identifier %q for %q", id, name)
+	}
+
+	u, err := url.Parse(s3URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image url %q", s3URL)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", errors.Errorf("invalid image url %q", s3URL)
+	}
+
+	// both virtual hosted and path style urls are accepted, eg
+	// bucket.s3.amazonaws.com/key and s3.amazonaws.com/bucket/key, in the
+	// global or a regional endpoint
+	var key string
+
+	switch {
+	case strings.HasPrefix(u.Host, bucket+".") && s3Endpoint(strings.TrimPrefix(u.Host, bucket+".")):
+		key = strings.TrimPrefix(u.Path, "/")
+	case s3Endpoint(u.Host) && strings.HasPrefix(u.Path, "/"+bucket+"/"):
+		key = strings.TrimPrefix(u.Path, "/"+bucket+"/")
+	default:
+		return "", errors.Errorf("image url %q outside of bucket %q", s3URL, bucket)
+	}
+
+	if key != s3Path(imagerType, id) {
+		return "", errors.Errorf("invalid image key %q, expected %q", key, s3Path(imagerType, id))
+	}
+
+	return size, nil
+}
+
+// s3Endpoint reports whether the host is the S3 global endpoint or a regional
+// one, like s3.eu-west-1.amazonaws.com
+func s3Endpoint(host string) bool {
+	if host == "s3.amazonaws.com" {
+		return true
+	}
+
+	if !strings.HasPrefix(host, "s3.") || !strings.HasSuffix(host, ".amazonaws.com") {
+		return false
+	}
+
+	region := strings.TrimSuffix(strings.TrimPrefix(host, "s3."), ".amazonaws.com")
+	if region == "" {
+		return false
+	}
+
+	for _, r := range region {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// identifier names the Blitline result of each size, the full size keeps the
+// record name so its path is the same as before sizes
+func identifier(name, size string) string {
+	if size == worker.FullSize {
+		return name
+	}
+
+	return name + "-" + size
+}
+
+// sizeName is the reverse of identifier
+func sizeName(name, id string) (string, bool) {
+	if id == name {
+		return worker.FullSize, true
+	}
+
+	if !strings.HasPrefix(id, name+"-") {
+		return "", false
+	}
+
+	size := id[len(name)+1:]
+
+	for _, c := range size {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "", false
+		}
+	}
+
+	return size, size != ""
+}
+
+func s3Path(imagerType, id string) string {
+	return fmt.Sprintf("%ss/%s.png", imagerType, id)
+}
@@ -0,0 +1,89 @@
+package resizer
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestVerifyCallback(t *testing.T) {
+	now := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	signed := func(secret, name string, expires time.Time) url.Values {
+		q, err := url.ParseQuery(SignCallback(secret, "card", name, expires))
+		test.OK(t, err)
+		return q
+	}
+
+	tampered := signed("s3cr3t", "AB34", now.Add(time.Hour))
+	tampered.Set("expires", "9999999999")
+
+	testCases := []struct {
+		scenario string
+		secret   string
+		query    url.Values
+		valid    bool
+	}{
+		{"valid", "s3cr3t", signed("s3cr3t", "AB34", now.Add(time.Hour)), true},
+		{"expired", "s3cr3t", signed("s3cr3t", "AB34", now.Add(-time.Second)), false},
+		{"other record", "s3cr3t", signed("s3cr3t", "CD56", now.Add(time.Hour)), false},
+		{"other secret", "s3cr3t", signed("secret", "AB34", now.Add(time.Hour)), false},
+		{"extended expiration", "s3cr3t", tampered, false},
+		{"unsigned", "s3cr3t", url.Values{}, false},
+		{"empty secret", "", signed("", "AB34", now.Add(time.Hour)), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			err := VerifyCallback(tc.secret, "card", "AB34", tc.query, now)
+
+			if tc.valid {
+				test.OK(t, err)
+			} else {
+				test.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyResult(t *testing.T) {
+	testCases := []struct {
+		scenario   string
+		identifier string
+		url        string
+		size       string
+	}{
+		{"path style", "AB34", "https://s3.amazonaws.com/example-bucket/cards/AB34.png", "full"},
+		{"virtual hosted", "AB34", "https://example-bucket.s3.amazonaws.com/cards/AB34.png", "full"},
+		{"regional", "AB34", "https://example-bucket.s3.eu-west-1.amazonaws.com/cards/AB34.png", "full"},
+		{"thumbnail", "AB34-thumb", "https://s3.amazonaws.com/example-bucket/cards/AB34-thumb.png", "thumb"},
+		{"other size key", "AB34-thumb", "https://s3.amazonaws.com/example-bucket/cards/AB34.png", ""},
+		{"invalid size", "AB34-../x", "https://s3.amazonaws.com/example-bucket/cards/AB34-../x.png", ""},
+		{"other identifier", "CD56", "https://s3.amazonaws.com/example-bucket/cards/AB34.png", ""},
+		{"other key", "AB34", "https://s3.amazonaws.com/example-bucket/cards/CD56.png", ""},
+		{"other bucket", "AB34", "https://s3.amazonaws.com/evil-bucket/cards/AB34.png", ""},
+		{"other bucket host", "AB34", "https://evil-bucket.s3.amazonaws.com/cards/AB34.png", ""},
+		{"bucket prefix host", "AB34", "https://example-bucket.s3x.evil.amazonaws.com/cards/AB34.png", ""},
+		{"bucket subdomain host", "AB34", "https://example-bucket.s3.evil.example.amazonaws.com/cards/AB34.png", ""},
+		{"other s3 host", "AB34", "https://s3evil.amazonaws.com/example-bucket/cards/AB34.png", ""},
+		{"regional path style", "AB34", "https://s3.eu-west-1.amazonaws.com/example-bucket/cards/AB34.png", "full"},
+		{"other host", "AB34", "https://example.com/example-bucket/cards/AB34.png", ""},
+		{"javascript", "AB34", "javascript:alert(1)", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			size, err := VerifyResult("example-bucket", "card", "AB34", tc.identifier, tc.url)
+
+			if tc.size == "" {
+				test.Error(t, err)
+				return
+			}
+
+			test.OK(t, err)
+			test.Equal(t, "size", tc.size, size)
+		})
+	}
+}
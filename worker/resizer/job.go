@@ -10,16 +10,34 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 type JobArgs struct {
+	ImagerType  string
 	ImagerID    string
 	CallbackURL string
 	Poll        bool
 	ImageURL    string
-	S3Path      string
-	Width       int
-	Height      int
+	Sizes       []worker.ImageSize
+
+	// Width and Height are the full size of the jobs enqueued before Sizes
+	Width  int `json:",omitempty"`
+	Height int `json:",omitempty"`
+}
+
+func (a JobArgs) sizes() []worker.ImageSize {
+	if len(a.Sizes) == 0 {
+		return []worker.ImageSize{{Name: worker.FullSize, Width: a.Width, Height: a.Height}}
+	}
+
+	return a.Sizes
+}
+
+// UniqueKey keeps a single pending resize per record, so the latest image
+// wins when it changes again before the job runs
+func (a JobArgs) UniqueKey() string {
+	return fmt.Sprintf("%s:%s:%s", workerName, a.ImagerType, a.ImagerID)
 }
 
 type Job struct {
@@ -34,23 +52,30 @@ func (j *Job) Run(ctx context.Context) error {
 		ApplicationID: j.blitlineID,
 		Version:       blitlineVersion,
 		ImageURL:      j.args.ImageURL,
-		Functions: []BlitlineFunction{
-			{
-				Name: "resize_to_fill",
-				Params: map[string]int{
-					"width":  j.args.Width,
-					"height": j.args.Height,
-				},
-				Save: map[string]interface{}{
-					"extension":        ".png",
-					"image_identifier": j.args.ImagerID,
-					"s3_destination": map[string]string{
-						"key":    j.args.S3Path,
-						"bucket": j.awsBucket,
-					},
+	}
+
+	// each size is saved with its own identifier, telling the callback which
+	// size each result is
+	for _, size := range j.args.sizes() {
+		id := identifier(j.args.ImagerID, size.Name)
+
+		fn := BlitlineFunction{
+			Name: "resize_to_fill",
+			Params: map[string]int{
+				"width":  size.Width,
+				"height": size.Height,
+			},
+			Save: map[string]interface{}{
+				"extension":        ".png",
+				"image_identifier": id,
+				"s3_destination": map[string]string{
+					"key":    s3Path(j.args.ImagerType, id),
+					"bucket": j.awsBucket,
 				},
 			},
-		},
+		}
+
+		payload.Functions = append(payload.Functions, fn)
 	}
 
 	if !j.args.Poll {
@@ -84,7 +109,14 @@ func (j *Job) Run(ctx context.Context) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("failed to send request to Blitline [%d] %s", resp.StatusCode, body)
+		err := errors.Errorf("failed to send request to Blitline [%d] %s", resp.StatusCode, body)
+
+		// client errors won't succeed on a retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return worker.Permanent(err)
+		}
+
+		return err
 	}
 
 	if !j.args.Poll {
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 func TestJob_Run(t *testing.T) {
@@ -18,7 +19,7 @@ func TestJob_Run(t *testing.T) {
 
 			test.OK(t, err)
 
-			payload := `{"application_id":"fake-app-id","src":"https://placeimg.com/400/300","v":1.21,"postback_url":"http://www.example.com/blitline/cards/AB34","functions":[{"name":"resize_to_fill","params":{"height":300,"width":400},"save":{"extension":".png","image_identifier":"AB34","s3_destination":{"bucket":"example-bucket","key":"cards/AB34.png"}}}]}`
+			payload := `{"application_id":"fake-app-id","src":"https://placeimg.com/400/300","v":1.21,"postback_url":"http://www.example.com/blitline/cards/AB34","functions":[{"name":"resize_to_fill","params":{"height":300,"width":400},"save":{"extension":".png","image_identifier":"AB34","s3_destination":{"bucket":"example-bucket","key":"cards/AB34.png"}}},{"name":"resize_to_fill","params":{"height":150,"width":200},"save":{"extension":".png","image_identifier":"AB34-thumb","s3_destination":{"bucket":"example-bucket","key":"cards/AB34-thumb.png"}}}]}`
 
 			test.Equal(t, "payload", payload, string(b))
 
@@ -27,12 +28,14 @@ func TestJob_Run(t *testing.T) {
 		}))
 
 		args := JobArgs{
+			ImagerType:  "card",
 			ImagerID:    "AB34",
 			ImageURL:    "https://placeimg.com/400/300",
-			S3Path:      "cards/AB34.png",
 			CallbackURL: "http://www.example.com/blitline/cards/AB34",
-			Width:       400,
-			Height:      300,
+			Sizes: []worker.ImageSize{
+				{Name: worker.FullSize, Width: 400, Height: 300},
+				{Name: "thumb", Width: 200, Height: 150},
+			},
 		}
 
 		job := &Job{
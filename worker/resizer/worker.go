@@ -1,8 +1,10 @@
 package resizer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"gitlab.com/luizbranco/cyberbrain/primitives"
@@ -17,6 +19,10 @@ type Worker struct {
 	CallbackURL string
 	Poll        bool
 
+	// CallbackSecret signs the callback URLs, so only Blitline results for
+	// the requested images are accepted
+	CallbackSecret string
+
 	WorkerPool primitives.WorkerPool
 }
 
@@ -33,6 +39,10 @@ func (w *Worker) Register() error {
 		return errors.New("AWSBucket cannot be empty")
 	}
 
+	if w.CallbackSecret == "" {
+		return errors.New("CallbackSecret cannot be empty")
+	}
+
 	err := w.WorkerPool.Register(workerName, w)
 	if err != nil {
 		return errors.Wrap(err, "failed to register image resize worker")
@@ -41,28 +51,27 @@ func (w *Worker) Register() error {
 	return nil
 }
 
-func (w *Worker) Resize(i worker.Imager, name string, width, height int) error {
+func (w *Worker) Resize(ctx context.Context, i worker.Imager, name string, sizes []worker.ImageSize) error {
 
 	if w.WorkerPool == nil {
 		return errors.New("invalid worker pool")
 	}
 
-	callback := fmt.Sprintf("%s/%ss/%s", w.CallbackURL, i.Type(), name)
-	s3Path := fmt.Sprintf("%ss/%s.png", i.Type(), name)
+	token := SignCallback(w.CallbackSecret, i.Type(), name, time.Now().Add(callbackTTL))
+	callback := fmt.Sprintf("%s/%ss/%s?%s", w.CallbackURL, i.Type(), name, token)
 
 	url := i.GetImageURL()
 
 	args := JobArgs{
+		ImagerType:  i.Type(),
 		ImagerID:    name,
 		ImageURL:    url,
 		CallbackURL: callback,
 		Poll:        w.Poll,
-		S3Path:      s3Path,
-		Width:       width,
-		Height:      height,
+		Sizes:       sizes,
 	}
 
-	err := w.WorkerPool.Enqueue(workerName, args)
+	err := w.WorkerPool.Enqueue(ctx, workerName, args)
 	if err != nil {
 		return errors.Wrapf(err, "failed to enqueue image resize worker %q %q", url, name)
 	}
@@ -70,6 +79,20 @@ func (w *Worker) Resize(i worker.Imager, name string, width, height int) error {
 	return nil
 }
 
+// RetryPolicy gives Blitline about an hour to recover from outages
+func (w *Worker) RetryPolicy() worker.RetryPolicy {
+	return worker.RetryPolicy{
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    30 * time.Minute,
+	}
+}
+
+// Timeout leaves room for polling Blitline results
+func (w *Worker) Timeout() time.Duration {
+	return pollDeadline + time.Minute
+}
+
 func (w *Worker) Spawn(b []byte) (primitives.Job, error) {
 	args := JobArgs{}
 
@@ -1,12 +1,16 @@
 package resizer
 
 import (
+	"context"
 	"encoding/json"
+	"net/url"
 	"testing"
+	"time"
 
 	"gitlab.com/luizbranco/cyberbrain/primitives"
 	"gitlab.com/luizbranco/cyberbrain/test"
 	"gitlab.com/luizbranco/cyberbrain/test/mocks"
+	"gitlab.com/luizbranco/cyberbrain/worker"
 )
 
 func TestWorker_Register(t *testing.T) {
@@ -14,9 +18,10 @@ func TestWorker_Register(t *testing.T) {
 		pool := &mocks.WorkerPool{}
 
 		w := &Worker{
-			WorkerPool: pool,
-			BlitlineID: "123",
-			AWSBucket:  "example-bucket",
+			WorkerPool:     pool,
+			BlitlineID:     "123",
+			AWSBucket:      "example-bucket",
+			CallbackSecret: "s3cr3t",
 		}
 
 		pool.RegisterFunc = func(name string, worker primitives.Worker) error {
@@ -36,6 +41,17 @@ func TestWorker_Register(t *testing.T) {
 		test.Error(t, err)
 	})
 
+	t.Run("callback secret is not defined", func(t *testing.T) {
+		w := &Worker{
+			WorkerPool: &mocks.WorkerPool{},
+			BlitlineID: "123",
+			AWSBucket:  "example-bucket",
+		}
+
+		err := w.Register()
+		test.Error(t, err)
+	})
+
 	t.Run("worker fails to enqueue", func(t *testing.T) {
 		pool := &mocks.WorkerPool{}
 
@@ -57,10 +73,11 @@ func TestWorker_Resize(t *testing.T) {
 		pool := &mocks.WorkerPool{}
 
 		w := &Worker{
-			WorkerPool:  pool,
-			CallbackURL: "http://www.example.com/blitline",
-			BlitlineID:  "fake-app-id",
-			AWSBucket:   "example-bucket",
+			WorkerPool:     pool,
+			CallbackURL:    "http://www.example.com/blitline",
+			BlitlineID:     "fake-app-id",
+			AWSBucket:      "example-bucket",
+			CallbackSecret: "s3cr3t",
 		}
 
 		pool.EnqueueFunc = func(name string, v interface{}) error {
@@ -71,13 +88,19 @@ func TestWorker_Resize(t *testing.T) {
 				t.Fatalf("invalid job args %v", v)
 			}
 
+			callback, err := url.Parse(args.CallbackURL)
+			test.OK(t, err)
+			test.OK(t, VerifyCallback("s3cr3t", "card", "AB34", callback.Query(), time.Now()))
+
+			callback.RawQuery = ""
+			args.CallbackURL = callback.String()
+
 			exp := JobArgs{
+				ImagerType:  "card",
 				ImagerID:    "AB34",
 				ImageURL:    "https://placeimg.com/400/300",
-				S3Path:      "cards/AB34.png",
 				CallbackURL: "http://www.example.com/blitline/cards/AB34",
-				Width:       400,
-				Height:      300,
+				Sizes:       worker.CardImageSizes,
 			}
 
 			test.Equal(t, "job args", exp, args)
@@ -85,14 +108,14 @@ func TestWorker_Resize(t *testing.T) {
 			return nil
 		}
 
-		err := w.Resize(&imager, "AB34", 400, 300)
+		err := w.Resize(context.Background(), &imager, "AB34", worker.CardImageSizes)
 		test.OK(t, err)
 	})
 
 	t.Run("worker pool not defined", func(t *testing.T) {
 		w := &Worker{}
 
-		err := w.Resize(&imager, "AB34", 400, 300)
+		err := w.Resize(context.Background(), &imager, "AB34", worker.CardImageSizes)
 		test.Error(t, err)
 	})
 
@@ -103,7 +126,7 @@ func TestWorker_Resize(t *testing.T) {
 			WorkerPool: pool,
 		}
 
-		err := w.Resize(&imager, "AB34", 400, 300)
+		err := w.Resize(context.Background(), &imager, "AB34", worker.CardImageSizes)
 		test.Error(t, err)
 	})
 }
@@ -113,10 +136,8 @@ func TestWorker_Spawn(t *testing.T) {
 		args := JobArgs{
 			ImagerID:    "AB34",
 			ImageURL:    "https://placeimg.com/400/300",
-			S3Path:      "cards/AB34.png",
 			CallbackURL: "http://www.example.com/blitline/cards/AB34",
-			Width:       400,
-			Height:      300,
+			Sizes:       worker.CardImageSizes,
 		}
 
 		b, err := json.Marshal(args)
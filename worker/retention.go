@@ -0,0 +1,293 @@
+package worker
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+// housekeepingName is the name of the built-in job that purges old jobs
+const housekeepingName = "jobs-housekeeping"
+
+const (
+	day = 24 * time.Hour
+
+	defaultBatchSize = 500
+)
+
+// RetentionPolicy controls how long finished jobs are kept
+type RetentionPolicy struct {
+	// MaxAge is how long after their last update the jobs of each state are
+	// kept, states not listed are kept forever
+	MaxAge map[string]time.Duration
+
+	// Archive moves the old jobs to archived_jobs instead of deleting them
+	Archive bool
+
+	// BatchSize limits the jobs purged by each query, defaults to 500
+	BatchSize int
+}
+
+// DefaultRetentionPolicy keeps done and canceled jobs for a week and failed
+// jobs for three months
+var DefaultRetentionPolicy = RetentionPolicy{
+	MaxAge: map[string]time.Duration{
+		done:     7 * day,
+		canceled: 7 * day,
+		failed:   90 * day,
+	},
+}
+
+// archivedCounter and deletedCounter are published to expvar, keyed by the
+// job state
+var (
+	archivedCounter = expvar.NewMap("worker_jobs_archived")
+	deletedCounter  = expvar.NewMap("worker_jobs_deleted")
+)
+
+// Housekeep registers the built-in job that purges the jobs older than the
+// policy allows, running at the times matching the cron expression
+func (p *WorkerPool) Housekeep(spec string, policy RetentionPolicy) error {
+	h := &housekeeper{db: p.Database, policy: policy}
+
+	err := p.Register(housekeepingName, h)
+	if err != nil {
+		return errors.Wrap(err, "failed to register housekeeping job")
+	}
+
+	return p.Schedule(housekeepingName, spec, nil)
+}
+
+type housekeeper struct {
+	db     primitives.Database
+	policy RetentionPolicy
+}
+
+func (h *housekeeper) Spawn(b []byte) (primitives.Job, error) {
+	return h, nil
+}
+
+// Run purges the old jobs of each state in batches, so a large backlog
+// doesn't hold locks on the jobs table for long
+func (h *housekeeper) Run(ctx context.Context) error {
+	size := h.policy.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	var states []string
+	for state := range h.policy.MaxAge {
+		states = append(states, state)
+	}
+
+	sort.Strings(states)
+
+	for _, state := range states {
+		q := &purgeQuery{
+			now:     time.Now(),
+			state:   state,
+			age:     h.policy.MaxAge[state],
+			limit:   size,
+			archive: h.policy.Archive,
+		}
+
+		n, err := purge(ctx, h.db, q)
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge %s jobs", state)
+		}
+
+		if n > 0 {
+			log.Printf("purged %d %s jobs\n", n, state)
+		}
+	}
+
+	return nil
+}
+
+func purge(ctx context.Context, db primitives.Database, q *purgeQuery) (int, error) {
+	counter := deletedCounter
+	if q.archive {
+		counter = archivedCounter
+	}
+
+	total := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		rs, err := db.QueryRaw(ctx, q, q.args()...)
+		if err != nil {
+			return total, err
+		}
+
+		total += len(rs)
+		counter.Add(q.state, int64(len(rs)))
+
+		if len(rs) < q.limit {
+			return total, nil
+		}
+	}
+}
+
+// purgeQuery deletes a batch of jobs in a state last updated before their
+// max age, copying them to archived_jobs when archiving
+type purgeQuery struct {
+	now     time.Time
+	state   string
+	age     time.Duration
+	limit   int
+	archive bool
+}
+
+func (q *purgeQuery) NewRecord() primitives.Record {
+	return &Job{}
+}
+
+func (q *purgeQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *purgeQuery) Raw() string {
+	del := fmt.Sprintf(`DELETE FROM jobs
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE state = $1 AND updated_at < NOW() - INTERVAL '%d milliseconds'
+		ORDER BY id
+		LIMIT %d
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *`, q.age/time.Millisecond, q.limit)
+
+	if !q.archive {
+		return del + ";"
+	}
+
+	return fmt.Sprintf(`WITH old AS (%s), archived AS (
+		INSERT INTO archived_jobs (%s)
+		SELECT %s FROM old
+	)
+	SELECT * FROM old;`, del, archivedColumns, archivedColumns)
+}
+
+// args are bound to the query placeholders
+func (q *purgeQuery) args() []interface{} {
+	return []interface{}{q.state}
+}
+
+// archivedColumns are copied to archived_jobs, which has its own ids
+const archivedColumns = "version, created_at, updated_at, run_at, name, state, args, " +
+	"error, tries, lease_until, unique_key"
+
+func (q *purgeQuery) SortBy() map[string]string {
+	return nil
+}
+
+func (q *purgeQuery) SQLite(ctx context.Context, conn db.SQLite) ([]primitives.Record, error) {
+	old, err := conn.Select(ctx, q, `SELECT `+jobColumns+` FROM jobs j
+	WHERE j.state = ?1 AND julianday(j.updated_at) < julianday(?2)
+	ORDER BY j.id
+	LIMIT ?3;`, q.state, q.now.Add(-q.age), q.limit)
+
+	if err != nil || len(old) == 0 {
+		return nil, err
+	}
+
+	ids := db.IDs(old)
+
+	if q.archive {
+		_, err = conn.Exec(ctx, fmt.Sprintf(`INSERT INTO archived_jobs (%s)
+		SELECT %s FROM jobs WHERE id IN (%s);`, archivedColumns, archivedColumns, ids))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = conn.Exec(ctx, "DELETE FROM jobs WHERE id IN ("+ids+");")
+	if err != nil {
+		return nil, err
+	}
+
+	return old, nil
+}
+
+func (q *purgeQuery) Eval(ctx context.Context, conn primitives.Database) ([]primitives.Record, error) {
+	jobs, err := findJobs(ctx, conn, q.state)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID() < jobs[j].ID()
+	})
+
+	before := q.now.Add(-q.age)
+
+	var purged []primitives.Record
+
+	for _, j := range jobs {
+		if len(purged) == q.limit {
+			break
+		}
+
+		if !j.MetaUpdatedAt.Before(before) {
+			continue
+		}
+
+		// the copy gets new timestamps, unlike the archived_jobs rows
+		// inserted by the SQL query
+		if q.archive {
+			a := archivedJob(*j)
+
+			err := conn.Create(ctx, &a)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err := conn.Delete(ctx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		purged = append(purged, j)
+	}
+
+	return purged, nil
+}
+
+// archivedJob is a job moved to archived_jobs by the housekeeping job
+type archivedJob Job
+
+func (j archivedJob) ID() primitives.ID {
+	return j.MetaID
+}
+
+func (j archivedJob) Type() string {
+	return "archived_job"
+}
+
+func (j *archivedJob) SetID(id primitives.ID) {
+	j.MetaID = id
+}
+
+func (j *archivedJob) SetVersion(v int) {
+	j.MetaVersion = v
+}
+
+func (j *archivedJob) SetCreatedAt(t time.Time) {
+	j.MetaCreatedAt = t
+}
+
+func (j *archivedJob) SetUpdatedAt(t time.Time) {
+	j.MetaUpdatedAt = t
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestPurge(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		archive  bool
+		archived int
+	}{
+		{"delete", false, 0},
+		{"archive", true, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			eachDatabase(t, func(t *testing.T, conn primitives.Database) {
+				ctx := context.Background()
+
+				for _, state := range []string{done, done, done, failed, scheduled} {
+					test.OK(t, conn.Create(ctx, &Job{Name: "resize", State: state}))
+				}
+
+				q := &purgeQuery{
+					now:     time.Now().Add(2 * day),
+					state:   done,
+					age:     day,
+					limit:   2,
+					archive: tc.archive,
+				}
+
+				n, err := purge(ctx, conn, q)
+				test.OK(t, err)
+				test.Equal(t, "purged jobs", 3, n)
+
+				jobs, err := FindJobs(ctx, conn, "", "")
+				test.OK(t, err)
+				test.Equal(t, "remaining jobs", 2, len(jobs))
+
+				rs, err := conn.Query(ctx, &archivedQuery{})
+				test.OK(t, err)
+				test.Equal(t, "archived jobs", tc.archived, len(rs))
+			})
+		})
+	}
+
+	t.Run("recent jobs", func(t *testing.T) {
+		ctx := context.Background()
+
+		conn := memory.New()
+
+		test.OK(t, conn.Create(ctx, &Job{Name: "resize", State: done}))
+
+		q := &purgeQuery{now: time.Now(), state: done, age: day, limit: 2}
+
+		n, err := purge(ctx, conn, q)
+		test.OK(t, err)
+		test.Equal(t, "purged jobs", 0, n)
+	})
+}
+
+type archivedQuery struct{}
+
+func (q *archivedQuery) NewRecord() primitives.Record {
+	return &archivedJob{}
+}
+
+func (q *archivedQuery) Where() map[string]interface{} {
+	return nil
+}
+
+func (q *archivedQuery) Raw() string {
+	return ""
+}
+
+func (q *archivedQuery) SortBy() map[string]string {
+	return nil
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how many times a failed job runs again and how long
+// it waits between attempts
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+
+	// MaxDelay caps the backoff, zero for no cap
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by workers that don't implement Retrier
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// Retrier is implemented by workers with their own retry policy
+type Retrier interface {
+	RetryPolicy() RetryPolicy
+}
+
+// Backoff returns the delay before the next attempt, doubling the base delay
+// after each try with up to half of it as random jitter
+func (p RetryPolicy) Backoff(tries int) time.Duration {
+	d := p.BaseDelay
+
+	for i := 1; i < tries && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		// uncapped delays stop doubling before overflowing
+		if d > math.MaxInt64/2 {
+			break
+		}
+
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Retry reports whether a job that failed with err after the given number of
+// tries should run again
+func (p RetryPolicy) Retry(tries int, err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+
+	return tries < p.MaxAttempts
+}
+
+type permanentError struct {
+	error
+}
+
+// Permanent marks an error as non-retryable, the job fails right away
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err}
+}
+
+// IsPermanent reports whether the error, or its cause, was marked with
+// Permanent
+func IsPermanent(err error) bool {
+	if _, ok := err.(permanentError); ok {
+		return true
+	}
+
+	_, ok := errors.Cause(err).(permanentError)
+
+	return ok
+}
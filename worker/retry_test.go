@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+
+	testCases := []struct {
+		tries int
+		max   time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{10, time.Minute},
+	}
+
+	for _, tc := range testCases {
+		d := p.Backoff(tc.tries)
+
+		if d < tc.max/2 || d > tc.max {
+			t.Errorf("expected backoff for %d tries between %s and %s, got %s", tc.tries, tc.max/2, tc.max, d)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff_Uncapped(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second}
+
+	d := p.Backoff(3)
+	if d < 20*time.Second || d > 40*time.Second {
+		t.Errorf("expected uncapped backoff for 3 tries between 20s and 40s, got %s", d)
+	}
+
+	if d := p.Backoff(100); d <= 0 {
+		t.Errorf("expected uncapped backoff for 100 tries not to overflow, got %s", d)
+	}
+}
+
+func TestRetryPolicy_Retry(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3}
+
+	err := errors.New("timeout")
+
+	test.Equal(t, "first try", true, p.Retry(1, err))
+	test.Equal(t, "last try", false, p.Retry(3, err))
+	test.Equal(t, "permanent", false, p.Retry(1, Permanent(err)))
+	test.Equal(t, "wrapped permanent", false, p.Retry(1, errors.Wrap(Permanent(err), "failed")))
+}
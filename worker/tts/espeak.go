@@ -0,0 +1,43 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Espeak synthesizes speech offline with the espeak-ng command line, or any
+// command taking the same arguments
+type Espeak struct {
+	// Command defaults to espeak-ng
+	Command string
+}
+
+func (e *Espeak) Synthesize(ctx context.Context, text, lang string) ([]byte, string, error) {
+	name := e.Command
+	if name == "" {
+		name = "espeak-ng"
+	}
+
+	// the text is read from stdin, so it is never taken as an option
+	cmd := exec.CommandContext(ctx, name, "-v", lang, "--stdout", "--stdin")
+	cmd.Stdin = strings.NewReader(text)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to run %s %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return nil, "", errors.Errorf("%s returned no audio for language %q", name, lang)
+	}
+
+	return stdout.Bytes(), "audio/wav", nil
+}
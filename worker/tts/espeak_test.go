@@ -0,0 +1,47 @@
+package tts
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/test"
+)
+
+func TestEspeak_Synthesize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "espeak")
+	test.OK(t, err)
+	defer os.RemoveAll(dir)
+
+	// stand-in echoing its arguments and the text read from stdin
+	script := filepath.Join(dir, "espeak")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\"\ncat\n"), 0755)
+	test.OK(t, err)
+
+	e := &Espeak{Command: script}
+
+	audio, ctype, err := e.Synthesize(context.Background(), "-v gato", "pt")
+	test.OK(t, err)
+	test.Equal(t, "content type", "audio/wav", ctype)
+	test.Equal(t, "command output", "-v pt --stdout --stdin\n-v gato", string(audio))
+
+	t.Run("command error", func(t *testing.T) {
+		e := &Espeak{Command: filepath.Join(dir, "missing")}
+
+		_, _, err := e.Synthesize(context.Background(), "gato", "pt")
+		test.Error(t, err)
+	})
+
+	t.Run("espeak-ng", func(t *testing.T) {
+		if _, err := exec.LookPath("espeak-ng"); err != nil {
+			t.Skip("espeak-ng not installed")
+		}
+
+		audio, _, err := (&Espeak{}).Synthesize(context.Background(), "gato", "pt")
+		test.OK(t, err)
+		test.Equal(t, "wav header", "RIFF", string(audio[:4]))
+	})
+}
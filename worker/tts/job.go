@@ -0,0 +1,125 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+// audioTypes are the content types returned by the providers and their file
+// extensions
+var audioTypes = map[string]string{
+	"audio/wav":  ".wav",
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".ogg",
+}
+
+type JobArgs struct {
+	CardID primitives.ID
+}
+
+// UniqueKey keeps a single pending generation per card
+func (a JobArgs) UniqueKey() string {
+	return fmt.Sprintf("%s:%d", workerName, a.CardID)
+}
+
+type Job struct {
+	args     JobArgs
+	provider Provider
+	store    primitives.BlobStore
+	db       primitives.Database
+}
+
+func (j *Job) Run(ctx context.Context) error {
+	card, err := db.FindCard(ctx, j.db, j.args.CardID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find card %d", j.args.CardID)
+	}
+
+	// sounds set by the users are kept
+	if card.SoundURL != "" && !card.SoundGenerated {
+		return nil
+	}
+
+	deck, err := db.FindDeck(ctx, j.db, card.DeckID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find deck %d", card.DeckID)
+	}
+
+	if deck.SpeechLanguage == "" {
+		return nil
+	}
+
+	if deck.SpeechField < 0 || deck.SpeechField >= len(card.Definitions) {
+		return worker.Permanent(errors.Errorf("invalid deck %d speech field %d", deck.ID(), deck.SpeechField))
+	}
+
+	text := strings.TrimSpace(card.Definitions[deck.SpeechField])
+	if text == "" {
+		return nil
+	}
+
+	audio, ctype, err := j.provider.Synthesize(ctx, text, deck.SpeechLanguage)
+	if err != nil {
+		return errors.Wrapf(err, "failed to synthesize card %d speech", card.ID())
+	}
+
+	mediatype, _, _ := mime.ParseMediaType(ctype)
+
+	ext, ok := audioTypes[mediatype]
+	if !ok {
+		return worker.Permanent(errors.Errorf("invalid speech content type %q", ctype))
+	}
+
+	// identical audio is stored once
+	key := fmt.Sprintf("sounds/%x%s", sha256.Sum256(audio), ext)
+
+	err = j.store.Put(ctx, key, bytes.NewReader(audio), mediatype)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store sound %q", key)
+	}
+
+	// the card is read again, so the edits made during the synthesis are kept
+	card, err = j.current(ctx, card.SoundURL, deck.SpeechField, text)
+	if err != nil || card == nil {
+		return err
+	}
+
+	card.SoundURL = j.store.URL(key)
+	card.SoundGenerated = true
+
+	err = j.db.Update(ctx, card)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update card %d sound", card.ID())
+	}
+
+	return nil
+}
+
+// current returns the card as it is now, or nil when its sound or speech text
+// changed during the synthesis, as the edit keeps the user sound or enqueues a
+// newer job
+func (j *Job) current(ctx context.Context, soundURL string, field int, text string) (*primitives.Card, error) {
+	card, err := db.FindCard(ctx, j.db, j.args.CardID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find card %d", j.args.CardID)
+	}
+
+	if card.SoundURL != soundURL {
+		return nil, nil
+	}
+
+	if field >= len(card.Definitions) || strings.TrimSpace(card.Definitions[field]) != text {
+		return nil, nil
+	}
+
+	return card, nil
+}
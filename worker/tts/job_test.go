@@ -0,0 +1,261 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/db/memory"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+	"gitlab.com/luizbranco/cyberbrain/test"
+	"gitlab.com/luizbranco/cyberbrain/test/mocks"
+	"gitlab.com/luizbranco/cyberbrain/worker"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s[key] = b
+
+	return nil
+}
+
+func (s memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return nil, primitives.ErrBlobNotFound
+}
+
+func (s memStore) Delete(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func (s memStore) URL(key string) string {
+	return "/blobs/" + key
+}
+
+type providerFunc func(text, lang string) ([]byte, string, error)
+
+func (fn providerFunc) Synthesize(ctx context.Context, text, lang string) ([]byte, string, error) {
+	return fn(text, lang)
+}
+
+func TestJob_Run(t *testing.T) {
+	wav := func(text, lang string) ([]byte, string, error) {
+		return []byte("RIFF " + lang + " " + text), "audio/wav", nil
+	}
+
+	testCases := []struct {
+		scenario  string
+		language  string
+		field     int
+		soundURL  string
+		provider  providerFunc
+		err       bool
+		permanent bool
+		sound     string
+	}{
+		{"ok", "pt", 1, "", wav, false, false, "RIFF pt gato"},
+		{"speech disabled", "", 1, "", wav, false, false, ""},
+		{"sound set by user", "pt", 1, "/blobs/cat.mp3", wav, false, false, ""},
+		{"invalid field", "pt", 2, "", wav, true, true, ""},
+		{"provider error", "pt", 1, "", func(text, lang string) ([]byte, string, error) {
+			return nil, "", errors.New("engine not found")
+		}, true, false, ""},
+		{"invalid content type", "pt", 1, "", func(text, lang string) ([]byte, string, error) {
+			return []byte("<html>"), "text/html", nil
+		}, true, true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := context.Background()
+
+			conn := memory.New()
+			store := memStore{}
+
+			deck := &primitives.Deck{
+				Name:           "Animals",
+				Fields:         []string{"English", "Portuguese"},
+				SpeechField:    tc.field,
+				SpeechLanguage: tc.language,
+			}
+			test.OK(t, conn.Create(ctx, deck))
+
+			card := &primitives.Card{
+				DeckID:      deck.ID(),
+				Definitions: []string{"cat", "gato"},
+				ImageURL:    "/blobs/cat.png",
+				SoundURL:    tc.soundURL,
+			}
+			test.OK(t, conn.Create(ctx, card))
+
+			job := &Job{
+				args:     JobArgs{CardID: card.ID()},
+				provider: tc.provider,
+				store:    store,
+				db:       conn,
+			}
+
+			err := job.Run(ctx)
+
+			found, ferr := db.FindCard(ctx, conn, card.ID())
+			test.OK(t, ferr)
+
+			if tc.err {
+				test.Error(t, err)
+				test.Equal(t, "permanent error", tc.permanent, worker.IsPermanent(err))
+				test.Equal(t, "sound url", "", found.SoundURL)
+				return
+			}
+
+			test.OK(t, err)
+
+			if tc.sound == "" {
+				test.Equal(t, "sound url", tc.soundURL, found.SoundURL)
+				test.Equal(t, "stored sounds", 0, len(store))
+				return
+			}
+
+			key := strings.TrimPrefix(found.SoundURL, "/blobs/")
+			test.Equal(t, "extension", true, strings.HasSuffix(key, ".wav"))
+			test.Equal(t, "sound", tc.sound, string(store[key]))
+		})
+	}
+}
+
+func TestJob_Run_generated(t *testing.T) {
+	ctx := context.Background()
+	conn := memory.New()
+	store := memStore{}
+
+	deck := &primitives.Deck{Name: "Animals", Fields: []string{"English"}, SpeechLanguage: "en"}
+	test.OK(t, conn.Create(ctx, deck))
+
+	card := &primitives.Card{
+		DeckID:         deck.ID(),
+		Definitions:    []string{"cat"},
+		ImageURL:       "/blobs/cat.png",
+		SoundURL:       "/blobs/sounds/old.wav",
+		SoundGenerated: true,
+	}
+	test.OK(t, conn.Create(ctx, card))
+
+	job := &Job{
+		args: JobArgs{CardID: card.ID()},
+		provider: providerFunc(func(text, lang string) ([]byte, string, error) {
+			return []byte("RIFF " + text), "audio/wav", nil
+		}),
+		store: store,
+		db:    conn,
+	}
+
+	test.OK(t, job.Run(ctx))
+
+	found, err := db.FindCard(ctx, conn, card.ID())
+	test.OK(t, err)
+
+	key := strings.TrimPrefix(found.SoundURL, "/blobs/")
+	test.Equal(t, "sound", "RIFF cat", string(store[key]))
+	test.Equal(t, "generated", true, found.SoundGenerated)
+}
+
+func TestJob_Run_edited(t *testing.T) {
+	testCases := []struct {
+		scenario string
+		edit     func(*primitives.Card)
+	}{
+		{"sound set", func(c *primitives.Card) { c.SoundURL = "/blobs/cat.mp3" }},
+		{"speech field changed", func(c *primitives.Card) { c.Definitions = []string{"kitten"} }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := context.Background()
+			conn := memory.New()
+
+			deck := &primitives.Deck{Name: "Animals", Fields: []string{"English"}, SpeechLanguage: "en"}
+			test.OK(t, conn.Create(ctx, deck))
+
+			card := &primitives.Card{DeckID: deck.ID(), Definitions: []string{"cat"}, ImageURL: "/blobs/cat.png"}
+			test.OK(t, conn.Create(ctx, card))
+
+			// the card is edited while its speech is synthesized
+			job := &Job{
+				args: JobArgs{CardID: card.ID()},
+				provider: providerFunc(func(text, lang string) ([]byte, string, error) {
+					edited, err := db.FindCard(ctx, conn, card.ID())
+					if err != nil {
+						return nil, "", err
+					}
+
+					tc.edit(edited)
+
+					return []byte("RIFF " + text), "audio/wav", conn.Update(ctx, edited)
+				}),
+				store: memStore{},
+				db:    conn,
+			}
+
+			test.OK(t, job.Run(ctx))
+
+			found, err := db.FindCard(ctx, conn, card.ID())
+			test.OK(t, err)
+
+			edited := *card
+			tc.edit(&edited)
+
+			test.Equal(t, "sound url", edited.SoundURL, found.SoundURL)
+			test.Equal(t, "definitions", edited.Definitions, found.Definitions)
+			test.Equal(t, "generated", false, found.SoundGenerated)
+		})
+	}
+}
+
+func TestDeckJob_Run(t *testing.T) {
+	ctx := context.Background()
+	conn := memory.New()
+
+	deck := &primitives.Deck{Name: "Animals", Fields: []string{"English"}, SpeechLanguage: "en"}
+	test.OK(t, conn.Create(ctx, deck))
+
+	cards := []*primitives.Card{
+		{DeckID: deck.ID(), Definitions: []string{"cat"}, ImageURL: "/blobs/cat.png"},
+		{DeckID: deck.ID(), Definitions: []string{"dog"}, ImageURL: "/blobs/dog.png", SoundURL: "/blobs/dog.mp3"},
+		{DeckID: deck.ID(), Definitions: []string{"bird"}, ImageURL: "/blobs/bird.png",
+			SoundURL: "/blobs/sounds/bird.wav", SoundGenerated: true},
+	}
+
+	for _, c := range cards {
+		test.OK(t, conn.Create(ctx, c))
+	}
+
+	var enqueued []interface{}
+
+	pool := &mocks.WorkerPool{
+		EnqueueFunc: func(name string, v interface{}) error {
+			test.Equal(t, "worker name", workerName, name)
+			enqueued = append(enqueued, v)
+			return nil
+		},
+	}
+
+	j := &deckJob{
+		args: deckArgs{DeckID: deck.ID()},
+		w:    &Worker{Database: conn, WorkerPool: pool},
+	}
+
+	test.OK(t, j.Run(ctx))
+	test.Equal(t, "enqueued jobs", []interface{}{
+		JobArgs{CardID: cards[2].ID()},
+		JobArgs{CardID: cards[0].ID()},
+	}, enqueued)
+}
@@ -0,0 +1,158 @@
+package tts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/luizbranco/cyberbrain/db"
+	"gitlab.com/luizbranco/cyberbrain/primitives"
+)
+
+const (
+	workerName     = "tts"
+	deckWorkerName = "tts-deck"
+)
+
+// Provider synthesizes speech from the text in the language, returning the
+// audio and its content type
+type Provider interface {
+	Synthesize(ctx context.Context, text, lang string) ([]byte, string, error)
+}
+
+// Worker generates the pronunciation audio of the cards from the deck speech
+// field, storing it in the Store and setting the card sound URL
+type Worker struct {
+	Provider   Provider
+	Store      primitives.BlobStore
+	Database   primitives.Database
+	WorkerPool primitives.WorkerPool
+}
+
+func (w *Worker) Register() error {
+	if w.WorkerPool == nil {
+		return errors.New("invalid worker pool")
+	}
+
+	if w.Provider == nil {
+		return errors.New("invalid speech provider")
+	}
+
+	if w.Store == nil {
+		return errors.New("invalid blob store")
+	}
+
+	if w.Database == nil {
+		return errors.New("invalid database")
+	}
+
+	err := w.WorkerPool.Register(workerName, w)
+	if err != nil {
+		return errors.Wrap(err, "failed to register speech worker")
+	}
+
+	err = w.WorkerPool.Register(deckWorkerName, &deckWorker{w})
+	if err != nil {
+		return errors.Wrap(err, "failed to register deck speech worker")
+	}
+
+	return nil
+}
+
+// Speak enqueues the audio generation of the card
+func (w *Worker) Speak(ctx context.Context, card *primitives.Card) error {
+	err := w.WorkerPool.Enqueue(ctx, workerName, JobArgs{CardID: card.ID()})
+	if err != nil {
+		return errors.Wrapf(err, "failed to enqueue card %d speech", card.ID())
+	}
+
+	return nil
+}
+
+// SpeakDeck enqueues the audio generation of all deck cards without a sound
+// set by the users
+func (w *Worker) SpeakDeck(ctx context.Context, deck *primitives.Deck) error {
+	err := w.WorkerPool.Enqueue(ctx, deckWorkerName, deckArgs{DeckID: deck.ID()})
+	if err != nil {
+		return errors.Wrapf(err, "failed to enqueue deck %d speech", deck.ID())
+	}
+
+	return nil
+}
+
+// Timeout bounds the speech synthesis and upload of a single card
+func (w *Worker) Timeout() time.Duration {
+	return time.Minute
+}
+
+func (w *Worker) Spawn(b []byte) (primitives.Job, error) {
+	args := JobArgs{}
+
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal args")
+	}
+
+	j := &Job{
+		args:     args,
+		provider: w.Provider,
+		store:    w.Store,
+		db:       w.Database,
+	}
+
+	return j, nil
+}
+
+type deckArgs struct {
+	DeckID primitives.ID
+}
+
+// UniqueKey keeps a single pending generation per deck
+func (a deckArgs) UniqueKey() string {
+	return fmt.Sprintf("%s:%d", deckWorkerName, a.DeckID)
+}
+
+// deckWorker enqueues a job for every deck card without sound or with a
+// generated one, which may be from older deck speech settings, so each card is
+// retried on its own
+type deckWorker struct {
+	w *Worker
+}
+
+func (d *deckWorker) Spawn(b []byte) (primitives.Job, error) {
+	args := deckArgs{}
+
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal args")
+	}
+
+	return &deckJob{args: args, w: d.w}, nil
+}
+
+type deckJob struct {
+	args deckArgs
+	w    *Worker
+}
+
+func (j *deckJob) Run(ctx context.Context) error {
+	cards, err := db.FindCardsByDeck(ctx, j.w.Database, j.args.DeckID, true)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find deck %d cards", j.args.DeckID)
+	}
+
+	for i := range cards {
+		if cards[i].SoundURL != "" && !cards[i].SoundGenerated {
+			continue
+		}
+
+		err := j.w.Speak(ctx, &cards[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}